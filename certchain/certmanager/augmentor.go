@@ -33,10 +33,19 @@ type Augmentor struct {
 	orSource OCSPRespSource
 	outMu    sync.RWMutex
 	out      chan *certchain.AugmentedChain
+	requests chan refreshRequest
 	killer   *chanutil.Killer
 }
 
 var _ Producer = (*Augmentor)(nil)
+var _ Refresher = (*Augmentor)(nil)
+
+// refreshRequest is a request from RefreshOCSPResp or RenewRawChain to the
+// goroutine spawned by Start.
+type refreshRequest struct {
+	renew bool // RenewRawChain if true; RefreshOCSPResp otherwise.
+	done  chan<- error
+}
 
 // RawChainSource provides a RawChain. It is designed to be called repeatedly:
 // the Fetch method does not just return the latest certificate chain, but
@@ -98,11 +107,10 @@ func NewAugmentor(rcSource RawChainSource, orSource OCSPRespSource) *Augmentor {
 func (a *Augmentor) Start() error {
 	a.outMu.Lock()
 	a.out = make(chan *certchain.AugmentedChain, 1)
-	a.outMu.Unlock()
-
 	a.killer = chanutil.NewKiller()
+	a.outMu.Unlock()
 
-	rcNext, _, err := a.maintainRawChain()
+	rcNext, _, err := a.maintainRawChain(false)
 	if err != nil {
 		return err
 	}
@@ -126,17 +134,25 @@ func (a *Augmentor) Start() error {
 		<-orNext.Chan()
 	}
 
-	go a.daemon(rcNext, orNext)
+	requests := make(chan refreshRequest)
+	a.outMu.Lock()
+	a.requests = requests
+	killer := a.killer
+	a.outMu.Unlock()
+
+	go a.daemon(rcNext, orNext, requests, killer)
 	return nil
 }
 
-func (a *Augmentor) daemon(rcNext, orNext futureevent.Event) {
+// daemon takes requests and killer as parameters, rather than reading them
+// from a, since Start and Stop may replace them in the meantime.
+func (a *Augmentor) daemon(rcNext, orNext futureevent.Event, requests <-chan refreshRequest, killer *chanutil.Killer) {
 	for {
 		var err error
 		select {
 		case <-rcNext.Chan():
 			var updated bool
-			rcNext, updated, err = a.maintainRawChain()
+			rcNext, updated, err = a.maintainRawChain(false)
 			if err != nil {
 				log.Printf("cannot update the certificate: %v", err)
 			}
@@ -156,7 +172,19 @@ func (a *Augmentor) daemon(rcNext, orNext futureevent.Event) {
 			} else {
 				log.Printf("successfully updated OCSP response")
 			}
-		case <-a.killer.C:
+		case req := <-requests:
+			if req.renew {
+				rcNext.Cancel()
+				rcNext, _, err = a.maintainRawChain(true)
+				if err != nil {
+					req.done <- err
+					continue
+				}
+			}
+			orNext.Cancel()
+			orNext, err = a.maintainOCSPResp()
+			req.done <- err
+		case <-killer.C:
 			rcNext.Cancel()
 			orNext.Cancel()
 			return
@@ -164,8 +192,15 @@ func (a *Augmentor) daemon(rcNext, orNext futureevent.Event) {
 	}
 }
 
-func (a *Augmentor) maintainRawChain() (nextRun futureevent.Event, updated bool, err error) {
-	newChain, nextRun, err := a.rcSource.Fetch(a.rawChain, timeutil.Now)
+// maintainRawChain fetches the RawChain. With force, it passes nil to
+// rcSource so rcSource provides a new RawChain even when the current one
+// is still up-to-date.
+func (a *Augmentor) maintainRawChain(force bool) (nextRun futureevent.Event, updated bool, err error) {
+	chain := a.rawChain
+	if force {
+		chain = nil
+	}
+	newChain, nextRun, err := a.rcSource.Fetch(chain, timeutil.Now)
 	if err != nil {
 		return nextRun, false, err
 	}
@@ -190,6 +225,41 @@ func (a *Augmentor) maintainOCSPResp() (futureevent.Event, error) {
 	return nextRun, nil
 }
 
+// RefreshOCSPResp fetches a new OCSP response immediately, rather than waiting
+// for the time OCSPRespSource has scheduled, and produces a new AugmentedChain
+// with it. It blocks until the production completes or fails.
+func (a *Augmentor) RefreshOCSPResp() error {
+	return a.request(false)
+}
+
+// RenewRawChain fetches a new RawChain immediately, rather than waiting for
+// the time RawChainSource has scheduled, then the OCSP response for it, and
+// produces a new AugmentedChain. RawChainSource is called with no current
+// RawChain, so acmeclient.Client, for example, obtains a new certificate
+// even if the current one is not due for renewal. It blocks until the
+// production completes or fails.
+func (a *Augmentor) RenewRawChain() error {
+	return a.request(true)
+}
+
+func (a *Augmentor) request(renew bool) error {
+	a.outMu.RLock()
+	requests, killer := a.requests, a.killer
+	a.outMu.RUnlock()
+	if requests == nil {
+		return ErrNotRunning // Never started.
+	}
+
+	// killer is already killed if a has been stopped.
+	done := make(chan error, 1)
+	select {
+	case requests <- refreshRequest{renew, done}:
+		return <-done
+	case <-killer.C:
+		return ErrNotRunning
+	}
+}
+
 // Stop kills the goroutine spawned by Start to stop producing AugmentedChains.
 func (a *Augmentor) Stop() {
 	a.outMu.Lock()
@@ -185,3 +185,74 @@ func TestFactory(t *testing.T) {
 		}
 	}
 }
+
+func TestAugmentorRefresh(t *testing.T) {
+	cert0401 := certchaintest.MustReadRawChainFile("../../testdata/certs/chain/certmanager_0401.pem")
+	cert0415 := certchaintest.MustReadRawChainFile("../../testdata/certs/chain/certmanager_0415.pem")
+	ocsp0409 := certchaintest.MustReadOCSPRespFile("../../testdata/ocsp/certmanager_0401_0409.ocsp")
+	ocsp0413 := certchaintest.MustReadOCSPRespFile("../../testdata/ocsp/certmanager_0401_0413.ocsp")
+	ocsp0415 := certchaintest.MustReadOCSPRespFile("../../testdata/ocsp/certmanager_0415_0415.ocsp")
+	augm0413 := certchaintest.MustReadAugmentedChainFile("../../testdata/certs/cbor/certmanager_0401_0413.cbor")
+	augm0415 := certchaintest.MustReadAugmentedChainFile("../../testdata/certs/cbor/certmanager_0415_0415.cbor")
+
+	certSource := newStubRawChainSource(cert0401, cert0415)
+	ocspSource := newStubOCSPRespSource(ocsp0409, ocsp0413, ocsp0415)
+
+	a := certmanager.NewAugmentor(certSource, ocspSource)
+
+	if err := a.RefreshOCSPResp(); err != certmanager.ErrNotRunning {
+		t.Errorf("a.RefreshOCSPResp() before Start = %v, want ErrNotRunning", err)
+	}
+
+	if err := a.Start(); err != nil {
+		t.Fatalf("a.Start() = error(%q), want success", err)
+	}
+	defer a.Stop()
+	<-certSource.OnFetchDone
+	<-ocspSource.OnFetchDone
+	<-a.Out()
+
+	if err := a.RefreshOCSPResp(); err != nil {
+		t.Fatalf("a.RefreshOCSPResp() = error(%q), want success", err)
+	}
+	<-ocspSource.OnFetchDone
+	if diff := cmp.Diff(augm0413, <-a.Out(), certComparer); diff != "" {
+		t.Errorf("<-a.Out() after RefreshOCSPResp mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := a.RenewRawChain(); err != nil {
+		t.Fatalf("a.RenewRawChain() = error(%q), want success", err)
+	}
+	<-certSource.OnFetchDone
+	<-ocspSource.OnFetchDone
+	if diff := cmp.Diff(augm0415, <-a.Out(), certComparer); diff != "" {
+		t.Errorf("<-a.Out() after RenewRawChain mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestAugmentorStartStop is meant to be run with -race as well.
+func TestAugmentorStartStop(t *testing.T) {
+	cert0401 := certchaintest.MustReadRawChainFile("../../testdata/certs/chain/certmanager_0401.pem")
+	ocsp0409 := certchaintest.MustReadOCSPRespFile("../../testdata/ocsp/certmanager_0401_0409.ocsp")
+	ocsp0413 := certchaintest.MustReadOCSPRespFile("../../testdata/ocsp/certmanager_0401_0413.ocsp")
+
+	certSource := newStubRawChainSource(cert0401, cert0401)
+	ocspSource := newStubOCSPRespSource(ocsp0409, ocsp0413)
+
+	a := certmanager.NewAugmentor(certSource, ocspSource)
+
+	// Start again after Stop.
+	for i := 0; i < 2; i++ {
+		if err := a.Start(); err != nil {
+			t.Fatalf("a.Start() = error(%q), want success", err)
+		}
+		<-certSource.OnFetchDone
+		<-ocspSource.OnFetchDone
+		<-a.Out()
+
+		a.Stop()
+		if err := a.RefreshOCSPResp(); err != certmanager.ErrNotRunning {
+			t.Errorf("a.RefreshOCSPResp() after Stop = %v, want ErrNotRunning", err)
+		}
+	}
+}
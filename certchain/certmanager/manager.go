@@ -54,6 +54,25 @@ type Producer interface {
 	Stop()
 }
 
+// Refresher is implemented by Producers which can produce a new
+// AugmentedChain on demand, such as Augmentor.
+type Refresher interface {
+	// RefreshOCSPResp produces a new AugmentedChain with a new OCSP
+	// response immediately.
+	RefreshOCSPResp() error
+	// RenewRawChain produces a new AugmentedChain with a new certificate
+	// chain immediately.
+	RenewRawChain() error
+}
+
+// ErrNotRefreshable is returned by Manager.RefreshOCSPResp and
+// Manager.RenewRawChain if the Producer does not implement Refresher.
+var ErrNotRefreshable = errors.New("certmanager: producer does not support refreshing")
+
+// ErrNotRunning is returned by Refresher methods if the Producer has not been
+// started or has been stopped.
+var ErrNotRunning = errors.New("certmanager: producer not running")
+
 // ErrNotFound is returned by Read if it is unable to find the AugmentedChain
 // using the provided digest.
 var ErrNotFound = errors.New("certmanager: no certificate chain found for the specified digest")
@@ -109,8 +128,11 @@ func (m *Manager) Start() error {
 		return err
 	}
 
-	m.data = <-m.producer.Out()
-	go m.onReceive(m.data)
+	data := <-m.producer.Out()
+	m.dataMu.Lock()
+	m.data = data
+	m.dataMu.Unlock()
+	go m.onReceive(data)
 
 	m.killer = chanutil.NewKiller()
 	go m.daemon()
@@ -155,3 +177,25 @@ func (m *Manager) GetAugmentedChain() *certchain.AugmentedChain {
 	defer m.dataMu.RUnlock()
 	return m.data
 }
+
+// RefreshOCSPResp makes the Producer fetch a new OCSP response immediately.
+// The new AugmentedChain is received by m asynchronously. It returns
+// ErrNotRefreshable if the Producer does not implement Refresher.
+func (m *Manager) RefreshOCSPResp() error {
+	r, ok := m.producer.(Refresher)
+	if !ok {
+		return ErrNotRefreshable
+	}
+	return r.RefreshOCSPResp()
+}
+
+// RenewRawChain makes the Producer fetch a new certificate chain immediately.
+// The new AugmentedChain is received by m asynchronously. It returns
+// ErrNotRefreshable if the Producer does not implement Refresher.
+func (m *Manager) RenewRawChain() error {
+	r, ok := m.producer.(Refresher)
+	if !ok {
+		return ErrNotRefreshable
+	}
+	return r.RenewRawChain()
+}
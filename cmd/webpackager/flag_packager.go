@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -30,9 +31,13 @@ import (
 	"github.com/google/webpackager/exchange"
 	"github.com/google/webpackager/exchange/vprule"
 	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/fetch/harfetch"
 	"github.com/google/webpackager/internal/customflag"
+	"github.com/google/webpackager/mediatype"
 	"github.com/google/webpackager/processor"
 	"github.com/google/webpackager/processor/complexproc"
+	"github.com/google/webpackager/processor/execproc"
+	"github.com/google/webpackager/processor/htmlproc"
 	"github.com/google/webpackager/processor/htmlproc/htmltask"
 	"github.com/google/webpackager/resource/cache"
 	"github.com/google/webpackager/resource/cache/filewrite"
@@ -45,17 +50,44 @@ var (
 	// RequestTweaker
 	flagRequestHeader = customflag.MultiString("request_header", `Request headers, e.g. "Accept-Language: en-US, en;q=0.5". (repeatable)`)
 
+	// FetchClient
+	flagHARReplay              = flag.String("har_replay", "", `HAR file to replay the responses from, instead of fetching them from the server. Use with --date for reproducible results.`)
+	flagHARMatchHeader         = customflag.MultiString("har_match_header", `Request header to match in addition to the method and the URL when replaying --har_replay, e.g. "Accept-Language". (repeatable)`)
+	flagHARRecord              = flag.String("har_record", "", `HAR file to record the fetched responses into.`)
+	flagLocalDir               = customflag.MultiString("local_dir", `URL prefix and local directory to serve the URLs from, e.g. "https://example.com/=./public", instead of fetching them from the server. (repeatable)`)
+	flagFetchRate              = flag.Float64("fetch_rate", 0, `Maximum number of requests per second to send to each host. 0 sets no limit.`)
+	flagFetchBurst             = flag.Int("fetch_burst", 1, `Maximum number of requests to send to each host at once, ahead of --fetch_rate.`)
+	flagFetchMaxConcurrency    = flag.Int("fetch_max_concurrency", 0, `Maximum number of in-flight requests to each host. 0 sets no limit.`)
+	flagFetchRespectRetryAfter = flag.Bool("fetch_respect_retry_after", false, `Hold requests to the host after a 429 or 503 response with the Retry-After header, until the specified time.`)
+	flagFetchMaxRetryAfter     = flag.String("fetch_max_retry_after", "1m", `Maximum duration to hold requests by --fetch_respect_retry_after.`)
+	flagFetchMaxRetries        = flag.Int("fetch_max_retries", 0, `Maximum number of retries for each GET request failed with a network error or --fetch_retry_status_codes. 0 disables retries.`)
+	flagFetchRetryStatusCodes  = flag.String("fetch_retry_status_codes", "502,503,504", `Comma-separated HTTP status codes to retry requests on.`)
+	flagFetchBreakerThreshold  = flag.Int("fetch_breaker_threshold", 0, `Number of consecutive failures for a host to stop sending requests to the host for --fetch_breaker_cooldown. 0 disables the circuit breaker.`)
+	flagFetchBreakerCooldown   = flag.String("fetch_breaker_cooldown", "30s", `Duration to stop sending requests to the host after --fetch_breaker_threshold failures.`)
+
 	// ExchangeFactory
-	flagVersion      = flag.String("version", "1b3", `Signed exchange version.`)
-	flagMIRecordSize = flag.String("mi_record_size", "4096", `Merkle Integration content encoding record size.`)
-	flagCertCBOR     = flag.String("cert_cbor", "", `Certificate chain CBOR file. Fetched from --cert_url when unspecified.`)
-	flagCertURL      = flag.String("cert_url", "", `Certficiate chain URL. (required)`)
-	flagPrivateKey   = flag.String("private_key", "", `Private key PEM file. (required)`)
+	flagVersion            = flag.String("version", "1b3", `Signed exchange version.`)
+	flagMIRecordSize       = flag.String("mi_record_size", "4096", `Merkle Integration content encoding record size.`)
+	flagCertCBOR           = flag.String("cert_cbor", "", `Certificate chain CBOR file. Fetched from --cert_url when unspecified.`)
+	flagCertURL            = flag.String("cert_url", "", `Certficiate chain URL. (required)`)
+	flagPrivateKey         = flag.String("private_key", "", `Private key PEM file. (required)`)
+	flagPreloadCrossOrigin = flag.Bool("preload_cross_origin", false, `Sign the resources preloaded from other origins covered by the certificate (e.g. "static.example.com" for "www.example.com"). Each resource is then signed only if the certificate covers its hostname.`)
 
 	// Processor
-	flagSizeLimit  = flag.String("size_limit", "4194304", `Maximum size of resources in bytes allowed for signed exchanges, or "none" to set no limit.`)
-	flagPreloadCSS = flag.Bool("preload_css", true, `Get CSS preloaded.`)
-	flagPreloadJS  = flag.Bool("preload_js", false, `Get JavaScript preloaded. USE WITH CAUTION: your scripts may remain cached and used until the expiry, even if you find security issues later.`)
+	flagSizeLimit        = flag.String("size_limit", "4194304", `Maximum size of resources in bytes allowed for signed exchanges, or "none" to set no limit.`)
+	flagContentEncoding  = flag.String("content_encoding", "", `Content-coding ("gzip" or "deflate") to apply to the payload of signed exchanges. Not applied when unspecified. The content-coding sent by the server is always decoded before processing.`)
+	flagPreloadCSS       = flag.Bool("preload_css", true, `Get CSS preloaded.`)
+	flagPreloadJS        = flag.Bool("preload_js", false, `Get JavaScript preloaded. USE WITH CAUTION: your scripts may remain cached and used until the expiry, even if you find security issues later.`)
+	flagPreloadJSWithSRI = flag.Bool("preload_js_with_integrity", false, `Get JavaScript preloaded only if the <script> has an integrity attribute. The scripts are verified against the integrity before signing.`)
+	flagPreloadLCPImages = flag.Int("preload_lcp_images", 0, `Maximum number of images likely to be the Largest Contentful Paint (e.g. hero images) to get preloaded per document. 0 disables the preloading.`)
+	flagLCPImageBudget   = flag.Int("lcp_image_budget", 0, `Maximum total size in bytes of the images preloaded by --preload_lcp_images per document. 0 sets no limit.`)
+	flagPreloadOptInAttr = flag.String("preload_opt_in_attr", "", `Only promote <link rel="preload"> elements with this attribute (e.g. "data-sxg-preload") to Link headers. Elements with data-sxg-no-header are never promoted.`)
+	flagAMPProfile       = flag.String("amp_profile", "ignore", `How to handle AMP documents: "ignore" (treat like other HTML), "skip" (do not sign), or "strict" (require the AMP SXG constraints).`)
+	flagPlugin           = customflag.MultiString("plugin", `Path to an external processor to run for each response, e.g. "/path/to/plugin". See the processor/execproc package for the protocol. (repeatable)`)
+	flagPluginArg        = customflag.MultiString("plugin_arg", `Command-line argument to pass to --plugin, e.g. "--mode=sxg". Passed to every --plugin in order. (repeatable)`)
+	flagPluginMediaType  = customflag.MultiString("plugin_media_type", `Media type to run --plugin for, e.g. "text/html" or "image/*". Runs for all media types when unspecified. (repeatable)`)
+	flagPluginTimeout    = flag.String("plugin_timeout", "10s", `Maximum time to wait for each --plugin to exit.`)
+	flagPluginSizeLimit  = flag.String("plugin_size_limit", "4194304", `Maximum size of payloads in bytes to send to and accept from --plugin, or "none" to set no limit.`)
 
 	// ValidPeriodRule
 	flagExpiry           = flag.String("expiry", "72h", `Lifetime of signed exchanges. This value is not applied to JavaScript (see: --js_expiry). Maximum is "168h".`)
@@ -72,6 +104,14 @@ var (
 	flagValidityDir = flag.String("validity_dir", "", `Directory to output validity files. (unimplemented)`)
 )
 
+// retryClient is set by getFetchClientFromFlags when retries or the circuit
+// breaker are enabled, to report the stats at the end.
+var retryClient *fetch.RetryClient
+
+// harRecorder is set by getFetchClientFromFlags with --har_record, to write
+// the recorded responses at the end.
+var harRecorder *harfetch.Recorder
+
 const (
 	noSizeLimitString = "none"
 
@@ -86,6 +126,8 @@ func getConfigFromFlags() (*webpackager.Config, error) {
 
 	cfg.RequestTweaker, err = getRequestTweakerFromFlags()
 	errs = multierror.Append(errs, err)
+	cfg.FetchClient, err = getFetchClientFromFlags()
+	errs = multierror.Append(errs, err)
 	cfg.PhysicalURLRule, err = getPhysicalURLRuleFromFlags()
 	errs = multierror.Append(errs, err)
 	cfg.ValidityURLRule, err = getValidityURLRuleFromFlags()
@@ -94,7 +136,7 @@ func getConfigFromFlags() (*webpackager.Config, error) {
 	errs = multierror.Append(errs, err)
 	cfg.ValidPeriodRule, err = getValidPeriodRuleFromFlags()
 	errs = multierror.Append(errs, err)
-	cfg.ExchangeFactory, err = getExchangeFactoryFromFlags()
+	cfg.ExchangeFactory, err = getExchangeFactoryProviderFromFlags()
 	errs = multierror.Append(errs, err)
 	cfg.ResourceCache, err = getResourceCacheFromFlags()
 	errs = multierror.Append(errs, err)
@@ -185,6 +227,159 @@ func getRequestTweakerFromFlags() (fetch.RequestTweaker, error) {
 	return t, nil
 }
 
+func getFetchClientFromFlags() (fetch.FetchClient, error) {
+	var config fetch.PolitenessConfig
+	var err error
+	errs := new(multierror.Error)
+
+	if *flagFetchRate < 0 {
+		errs = multierror.Append(errs, errors.New("invalid --fetch_rate: value must not be negative"))
+	}
+	config.RequestsPerSecond = *flagFetchRate
+	if *flagFetchBurst <= 0 {
+		errs = multierror.Append(errs, errors.New("invalid --fetch_burst: value must be positive"))
+	}
+	config.Burst = *flagFetchBurst
+	if *flagFetchMaxConcurrency < 0 {
+		errs = multierror.Append(errs, errors.New("invalid --fetch_max_concurrency: value must not be negative"))
+	}
+	config.MaxConcurrency = *flagFetchMaxConcurrency
+	config.RespectRetryAfter = *flagFetchRespectRetryAfter
+	config.MaxRetryAfter, err = time.ParseDuration(*flagFetchMaxRetryAfter)
+	if err == nil && config.MaxRetryAfter <= 0 {
+		err = errors.New("duration must be positive")
+	}
+	if err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid --fetch_max_retry_after: %v", err))
+	}
+
+	retryConfig, err := getRetryConfigFromFlags()
+	errs = multierror.Append(errs, err)
+	fileClients, err := getFileClientsFromFlags()
+	errs = multierror.Append(errs, err)
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	var client fetch.FetchClient = fetch.DefaultFetchClient
+	if *flagHARReplay != "" {
+		h, err := harfetch.ReadFile(*flagHARReplay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --har_replay: %v", err)
+		}
+		client = harfetch.NewReplayClient(h, *flagHARMatchHeader)
+	}
+	if config.RequestsPerSecond > 0 || config.MaxConcurrency > 0 || config.RespectRetryAfter {
+		client = fetch.WithPoliteness(client, config)
+	}
+	if retryConfig.MaxRetries > 0 || retryConfig.BreakerThreshold > 0 {
+		retryClient = fetch.WithRetry(client, retryConfig)
+		client = retryClient
+	}
+	if *flagHARRecord != "" {
+		harRecorder = harfetch.NewRecorder(client)
+		client = harRecorder
+	}
+	if len(fileClients) != 0 {
+		client = &localDirClient{fileClients, client}
+	}
+	return client, nil
+}
+
+func getFileClientsFromFlags() ([]fetch.FetchClient, error) {
+	var clients []fetch.FetchClient
+	errs := new(multierror.Error)
+
+	for _, s := range *flagLocalDir {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --local_dir %q: must be URL_PREFIX=DIR", s))
+			continue
+		}
+		prefix, err := url.Parse(s[:i])
+		if err == nil && (!prefix.IsAbs() || prefix.Host == "") {
+			err = errors.New("must be an absolute url")
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --local_dir %q: %v", s, err))
+			continue
+		}
+		if fi, err := os.Stat(s[i+1:]); err != nil || !fi.IsDir() {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --local_dir %q: not a directory", s))
+			continue
+		}
+		clients = append(clients, fetch.NewFileClient(fetch.FileClientConfig{
+			URLPrefix: prefix,
+			Root:      s[i+1:],
+			IndexFile: *flagIndexFile,
+		}))
+	}
+
+	return clients, errs.ErrorOrNil()
+}
+
+// localDirClient serves the URLs covered by --local_dir from the files,
+// and the other URLs from the server.
+type localDirClient struct {
+	files  []fetch.FetchClient
+	server fetch.FetchClient
+}
+
+func (c *localDirClient) Do(req *http.Request) (*http.Response, error) {
+	for _, f := range c.files {
+		resp, err := f.Do(req)
+		if !errors.Is(err, fetch.ErrURLMismatch) {
+			return resp, err
+		}
+	}
+	return c.server.Do(req)
+}
+
+func getRetryConfigFromFlags() (fetch.RetryConfig, error) {
+	var config fetch.RetryConfig
+	var err error
+	errs := new(multierror.Error)
+
+	switch {
+	case *flagFetchMaxRetries < 0:
+		errs = multierror.Append(errs, errors.New("invalid --fetch_max_retries: value must not be negative"))
+	case *flagFetchMaxRetries == 0:
+		config.MaxRetries = -1 // Disabled.
+	default:
+		config.MaxRetries = *flagFetchMaxRetries
+	}
+	config.RetryStatusCodes = []int{}
+	for _, s := range strings.Split(*flagFetchRetryStatusCodes, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --fetch_retry_status_codes: bad status code %q", s))
+			continue
+		}
+		config.RetryStatusCodes = append(config.RetryStatusCodes, code)
+	}
+	switch {
+	case *flagFetchBreakerThreshold < 0:
+		errs = multierror.Append(errs, errors.New("invalid --fetch_breaker_threshold: value must not be negative"))
+	case *flagFetchBreakerThreshold == 0:
+		config.BreakerThreshold = -1 // Disabled.
+	default:
+		config.BreakerThreshold = *flagFetchBreakerThreshold
+	}
+	config.BreakerCooldown, err = time.ParseDuration(*flagFetchBreakerCooldown)
+	if err == nil && config.BreakerCooldown <= 0 {
+		err = errors.New("duration must be positive")
+	}
+	if err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid --fetch_breaker_cooldown: %v", err))
+	}
+
+	return config, errs.ErrorOrNil()
+}
+
 func getPhysicalURLRuleFromFlags() (urlrewrite.Rule, error) {
 	rule := urlrewrite.RuleSequence{
 		urlrewrite.CleanPath(),
@@ -207,7 +402,24 @@ func getProcessorFromFlags() (processor.Processor, error) {
 		errs = multierror.Append(errs, fmt.Errorf("invalid --size_limit: %v", err))
 	}
 
-	cfg.HTML.TaskSet = getHTMLTaskSetFromFlags()
+	switch *flagContentEncoding {
+	case "", "gzip", "deflate":
+		cfg.ContentEncoding = *flagContentEncoding
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid --content_encoding %q", *flagContentEncoding))
+	}
+
+	cfg.HTML.TaskSet, err = getHTMLTaskSetFromFlags()
+	errs = multierror.Append(errs, err)
+
+	cfg.HTML.AMP, err = htmlproc.ParseAMPProfile(*flagAMPProfile)
+	if err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid --amp_profile: %v", err))
+	}
+
+	plugins, err := getPluginsFromFlags()
+	errs = multierror.Append(errs, err)
+	cfg.CustomPreprocessors = append(cfg.CustomPreprocessors, plugins...)
 
 	if err := errs.ErrorOrNil(); err != nil {
 		return nil, err
@@ -215,19 +427,95 @@ func getProcessorFromFlags() (processor.Processor, error) {
 	return complexproc.NewComprehensiveProcessor(cfg), nil
 }
 
-func getHTMLTaskSetFromFlags() []htmltask.HTMLTask {
+func getPluginsFromFlags() ([]processor.Processor, error) {
+	if len(*flagPlugin) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	errs := new(multierror.Error)
+
+	config := execproc.Config{}
+	config.Timeout, err = time.ParseDuration(*flagPluginTimeout)
+	if err == nil && config.Timeout <= 0 {
+		err = errors.New("duration must be positive")
+	}
+	if err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid --plugin_timeout: %v", err))
+	}
+	config.MaxPayloadSize, err = parseSizeLimit(*flagPluginSizeLimit)
+	if err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid --plugin_size_limit: %v", err))
+	}
+	for _, mt := range *flagPluginMediaType {
+		if mediatype.Candidates(mt) == nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --plugin_media_type %q", mt))
+		}
+	}
+
+	var plugins []processor.Processor
+	config.Args = *flagPluginArg
+	for _, s := range *flagPlugin {
+		if s == "" {
+			errs = multierror.Append(errs, fmt.Errorf("invalid --plugin %q", s))
+			continue
+		}
+		config.Command = s
+		var proc processor.Processor = execproc.NewExecProcessor(config)
+		if len(*flagPluginMediaType) != 0 {
+			mp := make(processor.MultiplexedProcessor)
+			for _, mt := range *flagPluginMediaType {
+				mp[strings.ToLower(mt)] = proc
+			}
+			proc = mp
+		}
+		plugins = append(plugins, proc)
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return plugins, nil
+}
+
+func getHTMLTaskSetFromFlags() ([]htmltask.HTMLTask, error) {
 	var tasks []htmltask.HTMLTask
 
-	tasks = append(tasks, htmltask.ConservativeTaskSet...)
+	if *flagPreloadOptInAttr == "" {
+		tasks = append(tasks, htmltask.ConservativeTaskSet...)
+	} else {
+		tasks = append(tasks,
+			htmltask.ExtractSubContentTypes(),
+			htmltask.ExtractOptInPreloadTags(*flagPreloadOptInAttr),
+		)
+	}
 
 	if *flagPreloadCSS {
 		tasks = append(tasks, htmltask.PreloadStylesheets())
 	}
+	// Run PreloadScriptsWithIntegrity first: InsecurePreloadScripts skips the
+	// scripts already preloaded, so those with the integrity attribute are
+	// never signed without the verification.
+	if *flagPreloadJSWithSRI {
+		tasks = append(tasks, htmltask.PreloadScriptsWithIntegrity())
+	}
 	if *flagPreloadJS {
 		tasks = append(tasks, htmltask.InsecurePreloadScripts())
 	}
+	if *flagPreloadLCPImages < 0 {
+		return nil, errors.New("invalid --preload_lcp_images: value must not be negative")
+	}
+	if *flagLCPImageBudget < 0 {
+		return nil, errors.New("invalid --lcp_image_budget: value must not be negative")
+	}
+	if *flagPreloadLCPImages > 0 {
+		tasks = append(tasks, htmltask.PreloadLCPImages(htmltask.LCPImageConfig{
+			MaxCount:   *flagPreloadLCPImages,
+			ByteBudget: *flagLCPImageBudget,
+		}))
+	}
 
-	return tasks
+	return tasks, nil
 }
 
 func getValidPeriodRuleFromFlags() (vprule.Rule, error) {
@@ -262,6 +550,19 @@ func getValidPeriodRuleFromFlags() (vprule.Rule, error) {
 	return rule, nil
 }
 
+func getExchangeFactoryProviderFromFlags() (exchange.FactoryProvider, error) {
+	fty, err := getExchangeFactoryFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	if !*flagPreloadCrossOrigin {
+		return fty, nil
+	}
+	// Select the Factory per URL, so the certificate is verified to cover
+	// the hostname of each resource, including those of other origins.
+	return exchange.NewMultiCertFactoryProvider(fty), nil
+}
+
 func getExchangeFactoryFromFlags() (*exchange.Factory, error) {
 	fty := new(exchange.Factory)
 	var err error
@@ -21,6 +21,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/google/webpackager"
@@ -51,6 +52,16 @@ func run() error {
 			errs = multierror.Append(errs, err)
 		}
 	}
+	if harRecorder != nil {
+		if err := harRecorder.HAR().WriteFile(*flagHARRecord); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to write --har_record: %v", err))
+		}
+	}
+	if retryClient != nil {
+		stats := retryClient.Stats()
+		log.Printf("sent %d requests with %d retries; %d failed (%d rejected by circuit breaker)",
+			stats.Requests, stats.Retries, stats.Failures, stats.Rejected)
+	}
 	return errs.ErrorOrNil()
 }
 
@@ -18,11 +18,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/google/webpackager/server"
 	"github.com/google/webpackager/server/tomlconfig"
@@ -44,6 +49,35 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	admin, err := server.AdminServerFromTOMLConfig(s, c)
+	if err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnHangup(s, hup)
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-term
+		shutdownErr <- shutdown(s, admin, c.Listen.GetShutdownTimeout())
+	}()
+
+	if admin != nil {
+		ln, err := net.Listen("tcp", admin.Addr)
+		if err != nil {
+			return err
+		}
+		log.Printf("Admin listening at %s", ln.Addr())
+		go func() {
+			if err := admin.Serve(ln); err != http.ErrServerClosed {
+				log.Printf("Admin server stopped: %v", err)
+			}
+		}()
+	}
 
 	// Create a Listener by ourselves to show the precise listener address,
 	// especially when Listen.Port is unspecified in TOML config.
@@ -53,10 +87,49 @@ func run() error {
 	}
 	if s.TLSConfig == nil {
 		log.Printf("Listening at %s", ln.Addr())
-		return s.Serve(ln)
+		err = s.Serve(ln)
 	} else {
 		log.Printf("Listening TLS at %s", ln.Addr())
-		return s.ServeTLS(ln, "", "")
+		err = s.ServeTLS(ln, "", "")
+	}
+	if err == http.ErrServerClosed {
+		return <-shutdownErr
+	}
+	return err
+}
+
+// shutdown gracefully shuts down s and admin, if not nil, waiting for the
+// requests in flight up to timeout. Zero timeout means no limit.
+func shutdown(s *server.Server, admin *http.Server, timeout time.Duration) error {
+	log.Print("Shutting down")
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if admin != nil {
+		if err := admin.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down admin server: %v", err)
+		}
+	}
+	return s.Shutdown(ctx)
+}
+
+// reloadOnHangup reloads the config file into s on every SIGHUP. When the
+// config file is invalid, s keeps running with the old config.
+func reloadOnHangup(s *server.Server, sig <-chan os.Signal) {
+	for range sig {
+		log.Printf("Reloading %s", *flagConfig)
+		c, err := tomlconfig.ReadFromFile(*flagConfig)
+		if err == nil {
+			err = s.ReloadTOMLConfig(c)
+		}
+		if err != nil {
+			log.Printf("Failed to reload %s; keeping the old config: %v", *flagConfig, err)
+			continue
+		}
+		log.Printf("Reloaded %s", *flagConfig)
 	}
 }
 
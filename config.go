@@ -80,7 +80,10 @@ type Config struct {
 	// ExchangeFactory specifies encoding parameters and signing materials
 	// for producing signed exchanges. If you use the same certificate and
 	// private key for the whole lifetime of the Packager, you can specify
-	// an *exchange.Factory directly.
+	// an *exchange.Factory directly. If you sign resources on multiple
+	// origins covered by different certificates, you can specify an
+	// exchange.URLFactoryProvider (e.g. exchange.MultiCertFactoryProvider)
+	// to select the certificate per resource.
 	//
 	// ExchangeFactory must be set to non-nil.
 	ExchangeFactory exchange.FactoryProvider
@@ -96,6 +99,15 @@ type Config struct {
 	// the process would produce signed exchanges and store them in memory,
 	// then throw them away at the termination.
 	ResourceCache cache.ResourceCache
+
+	// CacheVaryHeaders lists the request header fields the resources may
+	// vary on besides the URL, such as those which RequestTweaker forwards
+	// from the clients to the origin servers. The Packager records their
+	// values in resource.Resource.VaryHeader so ResourceCache can tell the
+	// variants apart.
+	//
+	// nil implies the resources vary only on the URL.
+	CacheVaryHeaders []string
 }
 
 func (cfg *Config) populateDefaults() {
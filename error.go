@@ -42,3 +42,17 @@ func (e *Error) Error() string {
 
 // Unwrap returns the wrapped error.
 func (e *Error) Unwrap() error { return e.Err }
+
+// RedirectError is returned (wrapped in an Error) when the resource is
+// redirected to another location.
+type RedirectError struct {
+	// StatusCode is the HTTP status code of the redirect, such as 301.
+	StatusCode int
+	// Location is the absolute URL of the redirect destination.
+	Location *url.URL
+}
+
+// Error implements the error interface.
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirected to %v", e.Location)
+}
@@ -89,6 +89,14 @@ func (fty *Factory) Verify(e *signedexchange.Exchange, date time.Time) ([]byte,
 	return payload, nil
 }
 
+// VerifyHostname returns nil if fty.CertChain is valid for the provided
+// hostname, that is, the end-entity certificate has the hostname in the
+// Subject Alternative Names. Otherwise, it returns an error describing the
+// mismatch.
+func (fty *Factory) VerifyHostname(hostname string) error {
+	return fty.CertChain.Leaf.VerifyHostname(hostname)
+}
+
 // Get returns fty. It implements FactoryProvider and allows Factory to be
 // set directory to ExchangeFactory in webpackager.Config.
 func (fty *Factory) Get() (*Factory, error) { return fty, nil }
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// URLFactoryProvider is a FactoryProvider which can provide a different
+// Factory depending on the URL of the resource to sign. webpackager.Packager
+// calls GetForURL, instead of Get, for each resource when ExchangeFactory
+// implements URLFactoryProvider.
+type URLFactoryProvider interface {
+	FactoryProvider
+
+	// GetForURL returns the Factory to produce signed exchanges for u.
+	GetForURL(u *url.URL) (*Factory, error)
+}
+
+// MultiCertFactoryProvider is a URLFactoryProvider to sign resources on
+// multiple origins covered by different certificates. It selects the Factory
+// (i.e. the certificate chain, the private key, and the cert-url) by the
+// hostname of the request URL.
+type MultiCertFactoryProvider struct {
+	// Providers is the list of FactoryProviders to select from. GetForURL
+	// returns the first Factory whose end-entity certificate is valid for
+	// the hostname in the order of Providers.
+	Providers []FactoryProvider
+}
+
+var _ URLFactoryProvider = (*MultiCertFactoryProvider)(nil)
+
+// NewMultiCertFactoryProvider creates and initializes a new
+// MultiCertFactoryProvider with the provided FactoryProviders.
+func NewMultiCertFactoryProvider(providers ...FactoryProvider) *MultiCertFactoryProvider {
+	return &MultiCertFactoryProvider{providers}
+}
+
+// Get returns the Factory from the first provider.
+func (m *MultiCertFactoryProvider) Get() (*Factory, error) {
+	if len(m.Providers) == 0 {
+		return nil, errors.New("no factory providers")
+	}
+	return m.Providers[0].Get()
+}
+
+// GetForURL returns the first Factory which can sign u, that is, whose
+// end-entity certificate has the hostname of u in the Subject Alternative
+// Names. It returns an error when no such Factory is found.
+func (m *MultiCertFactoryProvider) GetForURL(u *url.URL) (*Factory, error) {
+	var errs *multierror.Error
+
+	for _, p := range m.Providers {
+		fty, err := p.Get()
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		if fty.VerifyHostname(u.Hostname()) == nil {
+			return fty, nil
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, fmt.Errorf("no certificate available for %q: %v", u.Hostname(), err)
+	}
+	return nil, fmt.Errorf("no certificate available for %q", u.Hostname())
+}
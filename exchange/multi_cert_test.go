@@ -0,0 +1,102 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange_test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/google/webpackager/certchain"
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/internal/certchaintest"
+	"github.com/google/webpackager/internal/urlutil"
+)
+
+// newFactoryForHosts creates a Factory whose end-entity certificate claims
+// hosts in the Subject Alternative Names. Note the claim is not reflected
+// to the raw certificate, thus not to the signed exchanges.
+func newFactoryForHosts(certURL string, hosts ...string) *exchange.Factory {
+	chain := certchaintest.MustReadAugmentedChainFile("../testdata/certs/cbor/ecdsap256_nosct.cbor")
+
+	leaf := *chain.Leaf
+	leaf.DNSNames = hosts
+	raw := *chain.RawChain
+	raw.Leaf = &leaf
+	raw.Certs = append([]*x509.Certificate{&leaf}, raw.Certs[1:]...)
+
+	return exchange.NewFactory(exchange.Config{
+		CertChain:  certchain.NewAugmentedChain(&raw, chain.OCSPResp, chain.SCTList),
+		CertURL:    urlutil.MustParse(certURL),
+		PrivateKey: certchaintest.MustReadPrivateKeyFile("../testdata/keys/ecdsap256.key"),
+	})
+}
+
+func TestMultiCertFactoryProvider(t *testing.T) {
+	provider := exchange.NewMultiCertFactoryProvider(
+		newFactoryForHosts("https://example.com/cert1.cbor", "example.com", "www.example.com"),
+		newFactoryForHosts("https://example.com/cert2.cbor", "*.example.com"),
+		newFactoryForHosts("https://example.org/cert3.cbor", "example.org"),
+	)
+
+	tests := []struct {
+		url     string
+		certURL string
+	}{
+		{
+			url:     "https://www.example.com/index.html",
+			certURL: "https://example.com/cert1.cbor",
+		},
+		{
+			url:     "https://static.example.com/style.css",
+			certURL: "https://example.com/cert2.cbor",
+		},
+		{
+			url:     "https://example.org:8443/index.html",
+			certURL: "https://example.org/cert3.cbor",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			fty, err := provider.GetForURL(urlutil.MustParse(test.url))
+			if err != nil {
+				t.Fatalf("GetForURL() = error(%q), want success", err)
+			}
+			if got := fty.CertURL.String(); got != test.certURL {
+				t.Errorf("GetForURL().CertURL = %q, want %q", got, test.certURL)
+			}
+		})
+	}
+}
+
+func TestMultiCertFactoryProvider_Error(t *testing.T) {
+	provider := exchange.NewMultiCertFactoryProvider(
+		newFactoryForHosts("https://example.com/cert1.cbor", "example.com"),
+		newFactoryForHosts("https://example.com/cert2.cbor", "*.example.com"),
+	)
+
+	tests := []string{
+		"https://example.org/index.html",
+		"https://static.cdn.example.com/style.css",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			if _, err := provider.GetForURL(urlutil.MustParse(test)); err == nil {
+				t.Errorf("GetForURL() = success, want error")
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ import (
 const (
 	// See htmltask.ExtractSubContentTypes.
 	SubContentType = "Webpackager-Sub-Content-Type"
+	// See jsproc.ExtractModuleImports.
+	ScriptType = "Webpackager-Script-Type"
 )
 
 const linkHeader = "Link"
@@ -20,12 +20,17 @@ import (
 	"time"
 
 	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/mediatype"
 )
 
 // PerContentType specifies a Rule per media type. rules is a map from
 // media types to Rules; ruleElse is the Rule applied to other media types.
 // The map keys should be all in lowercase and include no media parameters
 // (e.g. "text/html", not "text/HTML" or "text/html; charset=utf-8").
+// The map keys may also be patterns with wildcards (e.g. "image/*") or
+// structured syntax suffixes (e.g. "application/*+json"), in which case the
+// most specific key matching the media type is used; see mediatype.Candidates
+// for the precedence rule.
 //
 // PerContentType looks for a rule applicable to the resp's Content-Type
 // first. If there is none, PerContentType also looks for a rule for each
@@ -61,5 +66,12 @@ func (p *perContentType) lookup(mimeType string) Rule {
 		log.Printf("warning: invalid MIME type %q: %v", mimeType, err)
 		return nil
 	}
-	return p.rules[mediaType]
+	key, ok := mediatype.Lookup(mediaType, func(k string) bool {
+		_, ok := p.rules[k]
+		return ok
+	})
+	if !ok {
+		return nil
+	}
+	return p.rules[key]
 }
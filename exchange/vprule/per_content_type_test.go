@@ -132,6 +132,48 @@ func TestPreContentType(t *testing.T) {
 				time.Date(2020, time.January, 15, 19, 30, 0, 0, time.UTC),
 				time.Date(2020, time.January, 16, 19, 30, 0, 0, time.UTC)),
 		},
+		{
+			name: "ContentType_Wildcard",
+			resp: fmt.Sprint(
+				"HTTP/1.1 200 OK\r\n",
+				"Content-Length: 4\r\n",
+				"Content-Type: image/png\r\n",
+				"\r\n",
+				"\x89PNG",
+			),
+			rule: vprule.PerContentType(
+				map[string]vprule.Rule{
+					"image/*":       rule2Day,
+					"image/svg+xml": rule1Day,
+				},
+				rule7Day,
+			),
+			date: time.Date(2020, time.January, 15, 19, 30, 0, 0, time.UTC),
+			want: exchange.NewValidPeriod(
+				time.Date(2020, time.January, 15, 19, 30, 0, 0, time.UTC),
+				time.Date(2020, time.January, 17, 19, 30, 0, 0, time.UTC)),
+		},
+		{
+			name: "ContentType_Suffix",
+			resp: fmt.Sprint(
+				"HTTP/1.1 200 OK\r\n",
+				"Content-Length: 2\r\n",
+				"Content-Type: application/ld+json\r\n",
+				"\r\n",
+				"{}",
+			),
+			rule: vprule.PerContentType(
+				map[string]vprule.Rule{
+					"application/*":      rule2Day,
+					"application/*+json": rule1Day,
+				},
+				rule7Day,
+			),
+			date: time.Date(2020, time.January, 15, 19, 30, 0, 0, time.UTC),
+			want: exchange.NewValidPeriod(
+				time.Date(2020, time.January, 15, 19, 30, 0, 0, time.UTC),
+				time.Date(2020, time.January, 16, 19, 30, 0, 0, time.UTC)),
+		},
 	}
 
 	url := "https://example.com/"
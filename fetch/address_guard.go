@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrForbiddenAddress is returned (wrapped) by the clients created with
+// NewGuardedFetchClient when the request host resolves to a forbidden IP
+// address. Use errors.Is to test for it.
+var ErrForbiddenAddress = errors.New("fetch: forbidden IP address")
+
+// forbiddenNets is the list of the IP address ranges AddressGuard rejects by
+// default: loopback, private, link-local, multicast, and other special-purpose
+// ranges not routable on the public Internet. IPv4-mapped IPv6 addresses are
+// matched against the IPv4 ranges.
+var forbiddenNets = mustParseCIDRs(
+	// IPv4.
+	"0.0.0.0/8",       // "This network"
+	"10.0.0.0/8",      // Private-use
+	"100.64.0.0/10",   // Shared address space (CGNAT)
+	"127.0.0.0/8",     // Loopback
+	"169.254.0.0/16",  // Link-local
+	"172.16.0.0/12",   // Private-use
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // Documentation (TEST-NET-1)
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // Private-use
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation (TEST-NET-2)
+	"203.0.113.0/24",  // Documentation (TEST-NET-3)
+	"224.0.0.0/4",     // Multicast
+	"240.0.0.0/4",     // Reserved, including the limited broadcast
+	// IPv6.
+	"::/128",        // Unspecified
+	"::1/128",       // Loopback
+	"64:ff9b::/96",  // IPv4/IPv6 translation
+	"100::/64",      // Discard-only
+	"2001::/23",     // IETF protocol assignments, including Teredo
+	"2001:db8::/32", // Documentation
+	"2002::/16",     // 6to4
+	"fc00::/7",      // Unique local
+	"fe80::/10",     // Link-local
+	"fec0::/10",     // Site-local (deprecated)
+	"ff00::/8",      // Multicast
+)
+
+// AddressGuard is a dialer which refuses to connect to forbidden IP
+// addresses, such as loopback and private network addresses, to protect
+// the internal network from server-side request forgery (SSRF).
+//
+// AddressGuard resolves the hostname by itself, checks all the resolved
+// addresses, then connects to one of them by the IP address. The connection
+// is thus pinned to the checked address: DNS rebinding cannot redirect the
+// request after the check.
+type AddressGuard struct {
+	// AllowedNets is the list of the networks to allow even though they
+	// are in the forbidden ranges, e.g. the internal network hosting the
+	// origin servers.
+	AllowedNets []*net.IPNet
+
+	// Resolver is used to look up the IP addresses. nil implies
+	// net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// Dialer is used to connect to the checked IP addresses. nil implies
+	// a net.Dialer with the same settings as http.DefaultTransport.
+	Dialer *net.Dialer
+}
+
+// NewGuardedFetchClient creates an http.Client set up with NeverRedirect,
+// like DefaultFetchClient, which connects to the servers through guard.
+// The client ignores the proxy settings in the environment variables, since
+// the guard would only check the address of the proxy.
+func NewGuardedFetchClient(guard *AddressGuard) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = guard.DialContext
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: NeverRedirect,
+	}
+}
+
+// IsAllowed reports whether guard allows connecting to ip.
+func (guard *AddressGuard) IsAllowed(ip net.IP) bool {
+	for _, n := range guard.AllowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	for _, n := range forbiddenNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// DialContext connects to address on the named network, like
+// net.Dialer.DialContext, if all the IP addresses the host resolves to are
+// allowed. Otherwise it returns an error wrapping ErrForbiddenAddress.
+func (guard *AddressGuard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := guard.lookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// Reject the host entirely when any of the addresses is forbidden,
+	// rather than trying the others, as the mix is suspicious by itself.
+	for _, ip := range ips {
+		if !guard.IsAllowed(ip) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, ip)
+		}
+	}
+
+	dialer := guard.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+	}
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func (guard *AddressGuard) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	resolver := guard.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/webpackager/fetch"
+)
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestAddressGuard_IsAllowed(t *testing.T) {
+	guard := &fetch.AddressGuard{
+		AllowedNets: []*net.IPNet{mustParseCIDR("10.1.0.0/16")},
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.0.0.5", false},
+		{"10.1.2.3", true}, // In AllowedNets.
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			if got := guard.IsAllowed(net.ParseIP(test.ip)); got != test.want {
+				t.Errorf("IsAllowed(%s) = %v, want %v", test.ip, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewGuardedFetchClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed []*net.IPNet
+		wantErr bool
+	}{
+		{
+			name:    "Loopback",
+			url:     server.URL,
+			wantErr: true,
+		},
+		{
+			name:    "Localhost",
+			url:     "http://localhost:" + port,
+			wantErr: true,
+		},
+		{
+			name:    "AllowedLoopback",
+			url:     server.URL,
+			allowed: []*net.IPNet{mustParseCIDR("127.0.0.0/8")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fetch.NewGuardedFetchClient(&fetch.AddressGuard{
+				AllowedNets: test.allowed,
+			})
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if test.wantErr {
+				if !errors.Is(err, fetch.ErrForbiddenAddress) {
+					t.Errorf("Do() = error(%v), want ErrForbiddenAddress", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() = error(%q), want success", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("resp.StatusCode = %v, want %v", resp.StatusCode, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/webpackager/internal/urlutil"
+)
+
+// DefaultIndexFile is the default value for FileClientConfig.IndexFile.
+const DefaultIndexFile = "index.html"
+
+// FileClientConfig configures NewFileClient.
+type FileClientConfig struct {
+	// URLPrefix specifies the URLs to serve from Root: those which have the
+	// same scheme and host as URLPrefix and whose path starts with the path
+	// of URLPrefix. URLPrefix must be an absolute URL; a path not ending
+	// with a slash is treated as if it did.
+	URLPrefix *url.URL
+
+	// Root is the local directory corresponding to URLPrefix.
+	Root string
+
+	// IndexFile is the filename assumed for slash-ended URLs, just like
+	// urlrewrite.IndexRule. Empty implies DefaultIndexFile.
+	IndexFile string
+}
+
+// NewFileClient creates and initializes a new FetchClient serving files
+// from a local directory, as if a static web server were running there.
+// It is useful to package a static website without running a web server.
+//
+// The returned client responds to GET and HEAD requests for URLs under
+// config.URLPrefix with the contents of the corresponding files. The
+// responses have Content-Type determined by the file extension (falling
+// back to content sniffing), Last-Modified from the modification time, and
+// Content-Length. The client responds with 404 (Not Found) for missing
+// files, and redirects to the slash-ended URL for directories, like most
+// web servers do. It returns ErrURLMismatch for URLs not under URLPrefix.
+func NewFileClient(config FileClientConfig) FetchClient {
+	if config.IndexFile == "" {
+		config.IndexFile = DefaultIndexFile
+	}
+	prefix := *config.URLPrefix
+	if !strings.HasSuffix(prefix.Path, "/") {
+		prefix.Path += "/"
+	}
+	config.URLPrefix = &prefix
+	return &fileClient{config}
+}
+
+type fileClient struct {
+	FileClientConfig
+}
+
+func (c *fileClient) Do(req *http.Request) (*http.Response, error) {
+	name, ok := c.filename(req.URL)
+	if !ok {
+		return nil, ErrURLMismatch
+	}
+	if req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp := newTextResponse(req, http.StatusMethodNotAllowed)
+		resp.Header.Set("Allow", "GET, HEAD")
+		return resp, nil
+	}
+
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return newTextResponse(req, http.StatusNotFound), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		if urlutil.IsDir(req.URL) {
+			// The directory lacks the index file.
+			return newTextResponse(req, http.StatusNotFound), nil
+		}
+		resp := newTextResponse(req, http.StatusMovedPermanently)
+		loc := *req.URL
+		loc.Path += "/"
+		resp.Header.Set("Location", loc.String())
+		return resp, nil
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ctype := mime.TypeByExtension(filepath.Ext(name))
+	if ctype == "" {
+		ctype = http.DetectContentType(data)
+	}
+
+	resp := newResponse(req, http.StatusOK, data)
+	resp.Header.Set("Content-Type", ctype)
+	resp.Header.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	return resp, nil
+}
+
+// filename returns the local filename for u, or false if u is not under
+// c.URLPrefix.
+func (c *fileClient) filename(u *url.URL) (string, bool) {
+	if !strings.EqualFold(u.Scheme, c.URLPrefix.Scheme) ||
+		!strings.EqualFold(u.Host, c.URLPrefix.Host) {
+		return "", false
+	}
+	p := urlutil.GetCleanPath(u)
+	var rel string
+	switch {
+	case strings.HasPrefix(p, c.URLPrefix.Path):
+		rel = p[len(c.URLPrefix.Path):]
+	case p+"/" == c.URLPrefix.Path:
+		rel = "" // The root directory without the trailing slash.
+	default:
+		return "", false
+	}
+	if strings.HasSuffix(p, "/") {
+		rel = path.Join(rel, c.IndexFile)
+	}
+	// GetCleanPath has resolved any ".." already, so rel never goes out of
+	// the root directory.
+	return filepath.Join(c.Root, filepath.FromSlash(rel)), true
+}
+
+func newResponse(req *http.Request, code int, body []byte) *http.Response {
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp
+}
+
+func newTextResponse(req *http.Request, code int) *http.Response {
+	resp := newResponse(req, code, []byte(http.StatusText(code)+"\n"))
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/internal/urlutil"
+)
+
+func setUpDocRoot(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "docroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"index.html":       "<!doctype html><p>top</p>",
+		"about/index.html": "<!doctype html><p>about</p>",
+		"style.css":        "body { color: black; }",
+		"data.unknown":     "<!doctype html><p>sniffed</p>",
+		"empty/.keep":      "",
+	}
+	mtime := time.Date(2020, time.May, 1, 12, 0, 0, 0, time.UTC)
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileClient(t *testing.T) {
+	root := setUpDocRoot(t)
+	defer os.RemoveAll(root)
+
+	client := fetch.NewFileClient(fetch.FileClientConfig{
+		URLPrefix: urlutil.MustParse("https://example.com/site"),
+		Root:      root,
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+		wantType   string
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:       "Index",
+			url:        "https://example.com/site/",
+			wantStatus: http.StatusOK,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   "<!doctype html><p>top</p>",
+			wantHeader: map[string]string{
+				"Last-Modified":  "Fri, 01 May 2020 12:00:00 GMT",
+				"Content-Length": "25",
+			},
+		},
+		{
+			name:       "SubdirectoryIndex",
+			url:        "https://example.com/site/about/",
+			wantStatus: http.StatusOK,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   "<!doctype html><p>about</p>",
+		},
+		{
+			name:       "ContentTypeFromExtension",
+			url:        "https://example.com/site/style.css?v=1",
+			wantStatus: http.StatusOK,
+			wantType:   "text/css; charset=utf-8",
+			wantBody:   "body { color: black; }",
+		},
+		{
+			name:       "ContentTypeSniffed",
+			url:        "https://example.com/site/data.unknown",
+			wantStatus: http.StatusOK,
+			wantType:   "text/html; charset=utf-8",
+			wantBody:   "<!doctype html><p>sniffed</p>",
+		},
+		{
+			name:       "DotDot",
+			url:        "https://example.com/site/about/../../site/style.css",
+			wantStatus: http.StatusOK,
+			wantType:   "text/css; charset=utf-8",
+			wantBody:   "body { color: black; }",
+		},
+		{
+			name:       "NotFound",
+			url:        "https://example.com/site/missing.html",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "NoIndexFile",
+			url:        "https://example.com/site/empty/",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "DirectoryRedirect",
+			url:        "https://example.com/site/about",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: map[string]string{
+				"Location": "https://example.com/site/about/",
+			},
+		},
+		{
+			name:       "RootRedirect",
+			url:        "https://example.com/site",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: map[string]string{
+				"Location": "https://example.com/site/",
+			},
+		},
+		{
+			name:       "Head",
+			method:     http.MethodHead,
+			url:        "https://example.com/site/style.css",
+			wantStatus: http.StatusOK,
+			wantType:   "text/css; charset=utf-8",
+			wantBody:   "",
+			wantHeader: map[string]string{
+				"Content-Length": "22",
+			},
+		},
+		{
+			name:       "MethodNotAllowed",
+			method:     http.MethodPost,
+			url:        "https://example.com/site/style.css",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() = error(%q), want success", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("resp.StatusCode = %v, want %v", resp.StatusCode, test.wantStatus)
+			}
+			for key, want := range test.wantHeader {
+				if got := resp.Header.Get(key); got != want {
+					t.Errorf("resp.Header.Get(%q) = %q, want %q", key, got, want)
+				}
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			if got := resp.Header.Get("Content-Type"); got != test.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, test.wantType)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.wantBody {
+				t.Errorf("resp.Body = %q, want %q", body, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestFileClient_URLMismatch(t *testing.T) {
+	client := fetch.NewFileClient(fetch.FileClientConfig{
+		URLPrefix: urlutil.MustParse("https://example.com/site/"),
+		Root:      "/nonexistent",
+	})
+
+	tests := []string{
+		"https://example.org/site/index.html",
+		"http://example.com/site/index.html",
+		"https://example.com/sitemap.xml",
+		"https://example.com/site/../secret.txt",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.Do(req); err != fetch.ErrURLMismatch {
+				t.Errorf("Do() = error(%v), want ErrURLMismatch", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package harfetch implements FetchClients to replay HTTP responses from, and
+// record them into, HAR (HTTP Archive) files. Used together with a fixed
+// signing date, they allow running the packager deterministically against
+// the origin state captured earlier, e.g. for regression testing.
+//
+// The package supports the subset of HAR 1.2 relevant to the packager:
+// the request method, URL, and headers, and the response status, headers,
+// and content. HAR files exported from web browsers can be replayed as well.
+//
+// See http://www.softwareishard.com/blog/har-12-spec/ for the format.
+package harfetch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/google/renameio"
+)
+
+var errMissingLog = errors.New("harfetch: missing log object")
+
+// HAR is the root object of HAR files.
+type HAR struct {
+	Log *Log `json:"log"`
+}
+
+// Log represents the log object.
+type Log struct {
+	Version string   `json:"version"`
+	Creator *Creator `json:"creator"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Creator represents the creator object.
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry represents an entry object, i.e. an HTTP request/response pair.
+type Entry struct {
+	StartedDateTime string    `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *Request  `json:"request"`
+	Response        *Response `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+}
+
+// Request represents the request object.
+type Request struct {
+	Method      string        `json:"method"`
+	URL         string        `json:"url"`
+	HTTPVersion string        `json:"httpVersion"`
+	Headers     []NameValue   `json:"headers"`
+	QueryString []NameValue   `json:"queryString"`
+	Cookies     []interface{} `json:"cookies"`
+	HeadersSize int           `json:"headersSize"`
+	BodySize    int           `json:"bodySize"`
+}
+
+// Response represents the response object.
+type Response struct {
+	Status      int           `json:"status"`
+	StatusText  string        `json:"statusText"`
+	HTTPVersion string        `json:"httpVersion"`
+	Headers     []NameValue   `json:"headers"`
+	Cookies     []interface{} `json:"cookies"`
+	Content     Content       `json:"content"`
+	RedirectURL string        `json:"redirectURL"`
+	HeadersSize int           `json:"headersSize"`
+	BodySize    int           `json:"bodySize"`
+}
+
+// NameValue represents a header or a query parameter.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Content represents the content object.
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+
+	// Encoded is a custom field (hence the underscore) indicating Text is
+	// still encoded with the Content-Encoding of the response. The HAR
+	// specification requires Text to be decoded otherwise.
+	Encoded bool `json:"_encoded,omitempty"`
+}
+
+// Timings represents the timings object. The packager does not use it, but
+// "send", "wait", and "receive" are required by the specification.
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ReadFile reads a HAR file.
+func ReadFile(filename string) (*HAR, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses data into HAR.
+func Parse(data []byte) (*HAR, error) {
+	h := new(HAR)
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	if h.Log == nil {
+		return nil, errMissingLog
+	}
+	return h, nil
+}
+
+// WriteFile writes h into filename atomically.
+func (h *HAR) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(filename, data, os.FileMode(0644))
+}
+
+// Body returns the decoded content text.
+func (c *Content) Body() ([]byte, error) {
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+	return []byte(c.Text), nil
+}
+
+func toNameValues(h http.Header) []NameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nvs := []NameValue{}
+	for _, name := range names {
+		for _, value := range h[name] {
+			nvs = append(nvs, NameValue{name, value})
+		}
+	}
+	return nvs
+}
+
+func fromNameValues(nvs []NameValue) http.Header {
+	h := make(http.Header)
+	for _, nv := range nvs {
+		h.Add(nv.Name, nv.Value)
+	}
+	return h
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harfetch_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/fetch/harfetch"
+)
+
+type stubClient map[string]string
+
+func (c stubClient) Do(req *http.Request) (*http.Response, error) {
+	body, ok := c[req.URL.String()]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Cache-Control": []string{"public, max-age=3600"},
+			"Content-Type":  []string{http.DetectContentType([]byte(body))},
+		},
+		Body:    ioutil.NopCloser(strings.NewReader(body)),
+		Request: req,
+	}
+	return resp, nil
+}
+
+func get(t *testing.T, client interface {
+	Do(*http.Request) (*http.Response, error)
+}, url string, header http.Header) (*http.Response, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body), nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	stub := stubClient{
+		"https://example.com/":         "<!doctype html><p>hello</p>",
+		"https://example.com/icon.png": "\x89PNG\r\n\x1a\n\x00\x00\xff\xfe",
+		"https://example.com/?q=1&a=2": "query",
+	}
+	recorder := harfetch.NewRecorder(stub)
+	for url := range stub {
+		if _, _, err := get(t, recorder, url, nil); err != nil {
+			t.Fatalf("recorder.Do(%q) = error(%q), want success", url, err)
+		}
+	}
+	if _, _, err := get(t, recorder, "https://example.com/missing", nil); err == nil {
+		t.Errorf("recorder.Do() = success, want error")
+	}
+
+	dir, err := ioutil.TempDir("", "harfetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.har")
+	if err := recorder.HAR().WriteFile(filename); err != nil {
+		t.Fatalf("WriteFile() = error(%q), want success", err)
+	}
+	h, err := harfetch.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile() = error(%q), want success", err)
+	}
+	if got := len(h.Log.Entries); got != len(stub) {
+		t.Errorf("len(h.Log.Entries) = %v, want %v", got, len(stub))
+	}
+
+	replay := harfetch.NewReplayClient(h, nil)
+	for url, want := range stub {
+		resp, body, err := get(t, replay, url, nil)
+		if err != nil {
+			t.Errorf("replay.Do(%q) = error(%q), want success", url, err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("resp.StatusCode = %v, want 200", resp.StatusCode)
+		}
+		wantHeader := http.Header{
+			"Cache-Control":  []string{"public, max-age=3600"},
+			"Content-Length": []string{fmt.Sprint(len(want))},
+			"Content-Type":   []string{http.DetectContentType([]byte(want))},
+		}
+		if diff := cmp.Diff(wantHeader, resp.Header); diff != "" {
+			t.Errorf("resp.Header mismatch (-want +got):\n%s", diff)
+		}
+		if body != want {
+			t.Errorf("resp.Body = %q, want %q", body, want)
+		}
+	}
+
+	_, _, err = get(t, replay, "https://example.com/missing", nil)
+	if !errors.Is(err, harfetch.ErrNotRecorded) {
+		t.Errorf("replay.Do() = error(%v), want ErrNotRecorded", err)
+	}
+}
+
+func TestRecord_RedactCredentials(t *testing.T) {
+	stub := stubClient{"https://example.com/": "<!doctype html><p>hello</p>"}
+	recorder := harfetch.NewRecorder(stub)
+	header := http.Header{
+		"Accept-Language": []string{"ja"},
+		"Authorization":   []string{"Bearer s3cret"},
+		"Cookie":          []string{"session=s3cret"},
+	}
+	if _, _, err := get(t, recorder, "https://example.com/", header); err != nil {
+		t.Fatalf("recorder.Do() = error(%q), want success", err)
+	}
+
+	want := []harfetch.NameValue{
+		{Name: "Accept-Language", Value: "ja"},
+		{Name: "Authorization", Value: "REDACTED"},
+		{Name: "Cookie", Value: "REDACTED"},
+	}
+	got := recorder.HAR().Log.Entries[0].Request.Headers
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Request.Headers mismatch (-want +got):\n%s", diff)
+	}
+	// The request itself is left intact.
+	if got := header.Get("Authorization"); got != "Bearer s3cret" {
+		t.Errorf("[Authorization] = %q, want %q", got, "Bearer s3cret")
+	}
+}
+
+const browserHAR = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "browser", "version": "1.0"},
+    "entries": [
+      {
+        "request": {
+          "method": "GET",
+          "url": "https://example.com/",
+          "headers": [{"name": "accept-language", "value": "ja"}]
+        },
+        "response": {
+          "status": 200,
+          "statusText": "OK",
+          "headers": [
+            {"name": "content-type", "value": "text/html"},
+            {"name": "content-encoding", "value": "gzip"}
+          ],
+          "content": {"size": 12, "mimeType": "text/html", "text": "<p>ja</p>"}
+        }
+      },
+      {
+        "request": {
+          "method": "GET",
+          "url": "https://example.com/",
+          "headers": [{"name": "accept-language", "value": "en"}]
+        },
+        "response": {
+          "status": 200,
+          "statusText": "OK",
+          "headers": [{"name": "content-type", "value": "text/html"}],
+          "content": {"size": 9, "mimeType": "text/html", "text": "PHA+ZW48L3A+", "encoding": "base64"}
+        }
+      }
+    ]
+  }
+}`
+
+func TestReplay_MatchHeaders(t *testing.T) {
+	h, err := harfetch.Parse([]byte(browserHAR))
+	if err != nil {
+		t.Fatalf("Parse() = error(%q), want success", err)
+	}
+
+	tests := []struct {
+		name         string
+		matchHeaders []string
+		header       http.Header
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:   "FirstMatch",
+			header: http.Header{"Accept-Language": []string{"en"}},
+			want:   "<p>ja</p>",
+		},
+		{
+			name:         "MatchJA",
+			matchHeaders: []string{"Accept-Language"},
+			header:       http.Header{"Accept-Language": []string{"ja"}},
+			want:         "<p>ja</p>",
+		},
+		{
+			name:         "MatchEN",
+			matchHeaders: []string{"Accept-Language"},
+			header:       http.Header{"Accept-Language": []string{"en"}},
+			want:         "<p>en</p>",
+		},
+		{
+			name:         "NoMatch",
+			matchHeaders: []string{"Accept-Language"},
+			header:       http.Header{"Accept-Language": []string{"fr"}},
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := harfetch.NewReplayClient(h, test.matchHeaders)
+			resp, body, err := get(t, client, "https://example.com/", test.header)
+			if test.wantErr {
+				if !errors.Is(err, harfetch.ErrNotRecorded) {
+					t.Errorf("Do() = error(%v), want ErrNotRecorded", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() = error(%q), want success", err)
+			}
+			if body != test.want {
+				t.Errorf("resp.Body = %q, want %q", body, test.want)
+			}
+			// The content in HAR is decoded.
+			if got := resp.Header.Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want empty", got)
+			}
+		})
+	}
+}
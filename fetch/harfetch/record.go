@@ -0,0 +1,148 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harfetch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/webpackager/fetch"
+)
+
+// credentialHeaders are the header fields whose values Recorder replaces
+// with redactedValue, to keep the credentials out of HAR files.
+var credentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+const redactedValue = "REDACTED"
+
+// Recorder is a fetch.FetchClient wrapping another FetchClient to record
+// the requests and the responses into HAR. The values of the credential
+// header fields, such as Authorization and Cookie, are recorded redacted.
+type Recorder struct {
+	client fetch.FetchClient
+
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+// NewRecorder creates and initializes a new Recorder which sends requests
+// to client.
+func NewRecorder(client fetch.FetchClient) *Recorder {
+	return &Recorder{client: client}
+}
+
+// Do sends req to the underlying client and records the response. The
+// response body is read entirely, then replaced with an in-memory reader.
+// Requests failed with an error are not recorded.
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	query := toNameValues(http.Header(req.URL.Query()))
+	content := Content{
+		Size:     len(body),
+		MimeType: resp.Header.Get("Content-Type"),
+		Encoded:  resp.Header.Get("Content-Encoding") != "",
+	}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+
+	e := &Entry{
+		StartedDateTime: started.UTC().Format(time.RFC3339Nano),
+		Time:            float64(time.Since(started)) / float64(time.Millisecond),
+		Request: &Request{
+			Method:      method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     toNameValues(redactCredentials(req.Header)),
+			QueryString: query,
+			Cookies:     []interface{}{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: &Response{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     toNameValues(redactCredentials(resp.Header)),
+			Cookies:     []interface{}{},
+			Content:     content,
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// redactCredentials returns a copy of h with the values of credentialHeaders
+// replaced with redactedValue.
+func redactCredentials(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, name := range credentialHeaders {
+		for i := range redacted[name] {
+			redacted[name][i] = redactedValue
+		}
+	}
+	return redacted
+}
+
+// HAR returns the HAR containing all entries recorded so far.
+func (r *Recorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]*Entry, len(r.entries))
+	copy(entries, r.entries)
+	return &HAR{
+		Log: &Log{
+			Version: "1.2",
+			Creator: &Creator{Name: "webpackager"},
+			Entries: entries,
+		},
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harfetch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrNotRecorded is returned by ReplayClient when no entry matches the
+// request.
+var ErrNotRecorded = errors.New("harfetch: no recorded response for the request")
+
+// ReplayClient is a fetch.FetchClient responding with the responses
+// recorded in a HAR file.
+type ReplayClient struct {
+	entries      []*Entry
+	matchHeaders []string
+}
+
+// NewReplayClient creates and initializes a new ReplayClient replaying the
+// entries in h. The request of each entry is matched on the method, the URL,
+// and the headers listed in matchHeaders (e.g. "Accept"): the request headers
+// must have the same values as recorded. The first matching entry is used
+// when there are multiple ones.
+//
+// The replayed response has Content-Encoding removed unless the content was
+// recorded as encoded (see Content.Encoded), and Content-Length set to the
+// content size.
+func NewReplayClient(h *HAR, matchHeaders []string) *ReplayClient {
+	return &ReplayClient{h.Log.Entries, matchHeaders}
+}
+
+// Do returns the recorded response for req, or ErrNotRecorded (wrapped with
+// the request method and URL) when it is not found.
+func (c *ReplayClient) Do(req *http.Request) (*http.Response, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	for _, e := range c.entries {
+		if e.Request == nil || e.Response == nil {
+			continue
+		}
+		if e.Request.Method == method && e.Request.URL == req.URL.String() &&
+			c.matchHeader(e.Request, req) {
+			return newResponse(e.Response, req)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, method, req.URL)
+}
+
+func (c *ReplayClient) matchHeader(r *Request, req *http.Request) bool {
+	if len(c.matchHeaders) == 0 {
+		return true
+	}
+	recorded := fromNameValues(r.Headers)
+	for _, name := range c.matchHeaders {
+		if strings.Join(recorded.Values(name), ", ") != strings.Join(req.Header.Values(name), ", ") {
+			return false
+		}
+	}
+	return true
+}
+
+func newResponse(r *Response, req *http.Request) (*http.Response, error) {
+	body, err := r.Content.Body()
+	if err != nil {
+		return nil, fmt.Errorf("harfetch: bad content for %s: %v", req.URL, err)
+	}
+
+	header := fromNameValues(r.Headers)
+	if !r.Content.Encoded {
+		header.Del("Content-Encoding")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	statusText := r.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(r.Status)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, statusText),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
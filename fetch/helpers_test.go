@@ -16,9 +16,11 @@ package fetch_test
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type stubFetcher struct{}
@@ -34,3 +36,63 @@ func (s *stubFetcher) Do(req *http.Request) (*http.Response, error) {
 	r := bufio.NewReader(strings.NewReader(respText))
 	return http.ReadResponse(r, req)
 }
+
+// statusFetcher responds with the status line and header fields in headers
+// in the order of the calls, or fails like a network error for an empty
+// string. It repeats the last one once exhausted.
+type statusFetcher struct {
+	mu      sync.Mutex
+	calls   int
+	headers []string
+}
+
+func (s *statusFetcher) Do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	i := s.calls
+	if i >= len(s.headers) {
+		i = len(s.headers) - 1
+	}
+	s.calls++
+	s.mu.Unlock()
+
+	if s.headers[i] == "" {
+		return nil, errors.New("connection reset by peer")
+	}
+	r := bufio.NewReader(strings.NewReader(s.headers[i] + "\r\n"))
+	return http.ReadResponse(r, req)
+}
+
+func (s *statusFetcher) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// blockingFetcher is like statusFetcher, but holds the requests to the paths
+// in release until the status line and header fields are sent to the channel
+// for the path. It responds with 200 immediately to the other paths.
+type blockingFetcher struct {
+	release map[string]chan string
+	started chan string // Receives the path of each request held.
+}
+
+func newBlockingFetcher(paths ...string) *blockingFetcher {
+	f := &blockingFetcher{
+		release: make(map[string]chan string),
+		started: make(chan string),
+	}
+	for _, path := range paths {
+		f.release[path] = make(chan string)
+	}
+	return f
+}
+
+func (f *blockingFetcher) Do(req *http.Request) (*http.Response, error) {
+	headers := "HTTP/1.1 200 OK\r\n"
+	if ch, ok := f.release[req.URL.Path]; ok {
+		f.started <- req.URL.Path
+		headers = <-ch
+	}
+	r := bufio.NewReader(strings.NewReader(headers + "\r\n"))
+	return http.ReadResponse(r, req)
+}
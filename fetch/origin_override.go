@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OriginOverride specifies the backend to fetch the resources on a public
+// host from, like curl --resolve but also allowing a different scheme.
+type OriginOverride struct {
+	// Hostname is the public hostname to override, e.g. "www.example.com".
+	// It is matched case-insensitively against the request URL, regardless
+	// of the port.
+	Hostname string
+
+	// Backend is the scheme and the host (with an optional port) to send
+	// the requests to instead, e.g. "http://10.0.0.5:8080". Its path, query,
+	// and fragment are ignored.
+	Backend *url.URL
+
+	// RootCAs is the set of root certificate authorities to verify the
+	// backend certificate with, when Backend uses https. nil implies the
+	// system pool.
+	RootCAs *x509.CertPool
+
+	// ServerName is the server name indication (SNI) to send to Backend,
+	// also used to verify its certificate, when Backend uses https. Empty
+	// implies Hostname.
+	ServerName string
+
+	// Timeout is the time limit for each request to Backend, including
+	// reading the response body. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// WithOriginOverrides wraps client to send the requests for the hostnames
+// in overrides to their backends. The overridden requests keep the public
+// URL in the Host header, and the responses carry the original request (with
+// the public URL) in their Request field, so the backend is invisible to the
+// callers. The requests for other hostnames are sent through client.
+//
+// The overridden requests are sent by an http.Client set up with
+// NeverRedirect, separately from client.
+func WithOriginOverrides(client FetchClient, overrides []OriginOverride) FetchClient {
+	w := &withOriginOverrides{
+		client:    client,
+		overrides: make(map[string]*originOverride, len(overrides)),
+	}
+	for _, o := range overrides {
+		key := strings.ToLower(o.Hostname)
+		if _, ok := w.overrides[key]; ok {
+			continue // The first one wins.
+		}
+		w.overrides[key] = newOriginOverride(o)
+	}
+	return w
+}
+
+type withOriginOverrides struct {
+	client    FetchClient
+	overrides map[string]*originOverride
+}
+
+type originOverride struct {
+	backend *url.URL
+	client  *http.Client
+}
+
+func newOriginOverride(o OriginOverride) *originOverride {
+	serverName := o.ServerName
+	if serverName == "" {
+		serverName = o.Hostname
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    o.RootCAs,
+		ServerName: serverName,
+	}
+	return &originOverride{
+		backend: &url.URL{Scheme: o.Backend.Scheme, Host: o.Backend.Host},
+		client: &http.Client{
+			Transport:     transport,
+			CheckRedirect: NeverRedirect,
+			Timeout:       o.Timeout,
+		},
+	}
+}
+
+func (w *withOriginOverrides) Do(req *http.Request) (*http.Response, error) {
+	o, ok := w.overrides[strings.ToLower(req.URL.Hostname())]
+	if !ok {
+		return w.client.Do(req)
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = o.backend.Scheme
+	out.URL.Host = o.backend.Host
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+
+	resp, err := o.client.Do(out)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch_test
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/internal/urlutil"
+)
+
+func newBackend(tls bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "host=%s path=%s", req.Host, req.URL.Path)
+	})
+	if tls {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func TestWithOriginOverrides(t *testing.T) {
+	httpBackend := newBackend(false)
+	defer httpBackend.Close()
+	tlsBackend := newBackend(true)
+	defer tlsBackend.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsBackend.Certificate())
+
+	client := fetch.WithOriginOverrides(&stubFetcher{}, []fetch.OriginOverride{
+		{
+			Hostname: "www.example.com",
+			Backend:  urlutil.MustParse(httpBackend.URL),
+		},
+		{
+			Hostname:   "secure.example.com",
+			Backend:    urlutil.MustParse(tlsBackend.URL),
+			RootCAs:    roots,
+			ServerName: "example.com", // Covered by the httptest certificate.
+		},
+		{
+			Hostname: "untrusted.example.com",
+			Backend:  urlutil.MustParse(tlsBackend.URL),
+		},
+	})
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "HTTPBackend",
+			url:  "https://www.example.com/x",
+			want: "host=www.example.com path=/x",
+		},
+		{
+			name: "HTTPBackend_CaseInsensitive",
+			url:  "https://WWW.example.com:8443/y",
+			want: "host=WWW.example.com:8443 path=/y",
+		},
+		{
+			name: "TLSBackend",
+			url:  "https://secure.example.com/z",
+			want: "host=secure.example.com path=/z",
+		},
+		{
+			name:    "TLSBackend_UnknownCA",
+			url:     "https://untrusted.example.com/",
+			wantErr: true,
+		},
+		{
+			name: "NotOverridden",
+			url:  "https://example.org/",
+			want: "<!doctype html><p>hello</p>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if test.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("Do() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() = error(%q), want success", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.want {
+				t.Errorf("resp.Body = %q, want %q", body, test.want)
+			}
+			if got := resp.Request.URL.String(); got != test.url {
+				t.Errorf("resp.Request.URL = %q, want %q", got, test.url)
+			}
+		})
+	}
+}
+
+func TestWithOriginOverrides_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	client := fetch.WithOriginOverrides(&stubFetcher{}, []fetch.OriginOverride{
+		{
+			Hostname: "www.example.com",
+			Backend:  urlutil.MustParse(slow.URL),
+			Timeout:  10 * time.Millisecond,
+		},
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("Do() = success, want error")
+	}
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("Do() = error(%q), want timeout", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRetryAfter is the default value for
+// PolitenessConfig.MaxRetryAfter.
+const DefaultMaxRetryAfter = time.Minute
+
+// PolitenessConfig configures WithPoliteness. The zero value imposes no
+// restrictions.
+type PolitenessConfig struct {
+	// RequestsPerSecond is the rate of requests allowed for each host.
+	// Zero or negative means no rate limit.
+	RequestsPerSecond float64
+
+	// Burst is the maximum number of requests allowed to be sent to each
+	// host at once, ahead of RequestsPerSecond. Zero implies 1. Burst has
+	// no effect when RequestsPerSecond is not positive.
+	Burst int
+
+	// MaxConcurrency is the maximum number of in-flight requests for each
+	// host. A request is in flight until the response body is closed. Zero
+	// or negative means no limit.
+	MaxConcurrency int
+
+	// RespectRetryAfter makes the client hold all requests to the host
+	// after a 429 (Too Many Requests) or 503 (Service Unavailable) response
+	// with the Retry-After header, until the time specified there. Note the
+	// client does not retry the request; the response is passed through.
+	RespectRetryAfter bool
+
+	// MaxRetryAfter caps the duration to hold requests by RespectRetryAfter.
+	// Zero implies DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+}
+
+// WithPoliteness wraps client to limit the rate and the concurrency of
+// requests for each host (the hostname and the port), as specified in
+// config, to avoid overloading the origin servers. Requests exceeding the
+// limits wait until they are allowed, or until their context is done, in
+// which case Do returns the context error.
+func WithPoliteness(client FetchClient, config PolitenessConfig) FetchClient {
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.MaxRetryAfter == 0 {
+		config.MaxRetryAfter = DefaultMaxRetryAfter
+	}
+	return &withPoliteness{
+		client: client,
+		config: config,
+		hosts:  make(map[string]*hostLimiter),
+	}
+}
+
+type withPoliteness struct {
+	client FetchClient
+	config PolitenessConfig
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+func (w *withPoliteness) Do(req *http.Request) (*http.Response, error) {
+	h := w.getHostLimiter(req.URL.Host)
+	ctx := req.Context()
+
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := h.wait(ctx, &w.config); err != nil {
+		h.release()
+		return nil, err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		h.release()
+		return nil, err
+	}
+	if w.config.RespectRetryAfter {
+		if d, ok := parseRetryAfter(resp, time.Now()); ok {
+			if d > w.config.MaxRetryAfter {
+				d = w.config.MaxRetryAfter
+			}
+			h.holdUntil(time.Now().Add(d))
+		}
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: h.release}
+	return resp, nil
+}
+
+func (w *withPoliteness) getHostLimiter(host string) *hostLimiter {
+	host = strings.ToLower(host)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	h, ok := w.hosts[host]
+	if !ok {
+		h = &hostLimiter{tokens: float64(w.config.Burst)}
+		if w.config.MaxConcurrency > 0 {
+			h.sem = make(chan struct{}, w.config.MaxConcurrency)
+		}
+		w.hosts[host] = h
+	}
+	return h
+}
+
+// hostLimiter holds the state of the limits for a single host.
+type hostLimiter struct {
+	sem chan struct{} // nil for no concurrency limit.
+
+	mu        sync.Mutex
+	tokens    float64   // The token bucket.
+	updated   time.Time // When tokens was last updated.
+	heldUntil time.Time // Set by Retry-After.
+}
+
+// wait blocks until the next request to the host is allowed.
+func (h *hostLimiter) wait(ctx context.Context, config *PolitenessConfig) error {
+	for {
+		d := h.reserve(config, time.Now())
+		if d <= 0 {
+			return nil
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token from the bucket and returns zero if the request is
+// allowed at now. Otherwise it returns how long to wait before trying again.
+func (h *hostLimiter) reserve(config *PolitenessConfig, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Before(h.heldUntil) {
+		return h.heldUntil.Sub(now)
+	}
+	if config.RequestsPerSecond <= 0 {
+		return 0
+	}
+
+	if !h.updated.IsZero() {
+		h.tokens += now.Sub(h.updated).Seconds() * config.RequestsPerSecond
+		if max := float64(config.Burst); h.tokens > max {
+			h.tokens = max
+		}
+	}
+	h.updated = now
+
+	if h.tokens >= 1 {
+		h.tokens--
+		return 0
+	}
+	return time.Duration((1 - h.tokens) / config.RequestsPerSecond * float64(time.Second))
+}
+
+func (h *hostLimiter) holdUntil(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t.After(h.heldUntil) {
+		h.heldUntil = t
+	}
+}
+
+func (h *hostLimiter) release() {
+	if h.sem != nil {
+		<-h.sem
+	}
+}
+
+// releaseOnClose calls release once when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// parseRetryAfter returns the duration specified in the Retry-After header
+// of a 429 or 503 response, relative to now.
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
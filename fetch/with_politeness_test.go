@@ -0,0 +1,159 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/webpackager/fetch"
+)
+
+func doRequest(t *testing.T, client fetch.FetchClient, ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Do(req)
+}
+
+func mustDo(t *testing.T, client fetch.FetchClient, url string) {
+	resp, err := doRequest(t, client, context.Background(), url)
+	if err != nil {
+		t.Fatalf("Do(%q) = error(%q), want success", url, err)
+	}
+	resp.Body.Close()
+}
+
+func TestWithPoliteness_Rate(t *testing.T) {
+	client := fetch.WithPoliteness(&stubFetcher{}, fetch.PolitenessConfig{
+		RequestsPerSecond: 20,
+		Burst:             2,
+	})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		mustDo(t, client, "https://example.com/")
+	}
+	// The first two requests are sent at once (Burst), then the other three
+	// wait for 50ms each.
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("5 requests took %v, want >= 150ms", elapsed)
+	}
+}
+
+func TestWithPoliteness_RatePerHost(t *testing.T) {
+	client := fetch.WithPoliteness(&stubFetcher{}, fetch.PolitenessConfig{
+		RequestsPerSecond: 1,
+	})
+
+	start := time.Now()
+	mustDo(t, client, "https://example.com/")
+	mustDo(t, client, "https://example.org/")
+	mustDo(t, client, "https://example.com:8443/")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("3 requests to different hosts took %v, want no wait", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := doRequest(t, client, ctx, "https://EXAMPLE.COM/"); err != context.DeadlineExceeded {
+		t.Errorf("Do() = error(%v), want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWithPoliteness_Concurrency(t *testing.T) {
+	client := fetch.WithPoliteness(&stubFetcher{}, fetch.PolitenessConfig{
+		MaxConcurrency: 1,
+	})
+
+	resp, err := doRequest(t, client, context.Background(), "https://example.com/")
+	if err != nil {
+		t.Fatalf("Do() = error(%q), want success", err)
+	}
+
+	// The first response body is still open.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := doRequest(t, client, ctx, "https://example.com/"); err != context.DeadlineExceeded {
+		t.Errorf("Do() = error(%v), want context.DeadlineExceeded", err)
+	}
+	mustDo(t, client, "https://example.org/")
+
+	resp.Body.Close()
+	resp.Body.Close() // Must not release twice.
+	mustDo(t, client, "https://example.com/")
+}
+
+func TestWithPoliteness_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  fetch.PolitenessConfig
+		header  string
+		minWait time.Duration
+	}{
+		{
+			name:    "Seconds",
+			config:  fetch.PolitenessConfig{RespectRetryAfter: true},
+			header:  "HTTP/1.1 503 Service Unavailable\r\nRetry-After: 1\r\n",
+			minWait: 900 * time.Millisecond,
+		},
+		{
+			name: "Capped",
+			config: fetch.PolitenessConfig{
+				RespectRetryAfter: true,
+				MaxRetryAfter:     200 * time.Millisecond,
+			},
+			header:  "HTTP/1.1 429 Too Many Requests\r\nRetry-After: 3600\r\n",
+			minWait: 150 * time.Millisecond,
+		},
+		{
+			name:    "NotRespected",
+			config:  fetch.PolitenessConfig{},
+			header:  "HTTP/1.1 503 Service Unavailable\r\nRetry-After: 3600\r\n",
+			minWait: 0,
+		},
+		{
+			name:    "NotErrorStatus",
+			config:  fetch.PolitenessConfig{RespectRetryAfter: true},
+			header:  "HTTP/1.1 200 OK\r\nRetry-After: 3600\r\n",
+			minWait: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := &statusFetcher{headers: []string{test.header, "HTTP/1.1 200 OK\r\n"}}
+			client := fetch.WithPoliteness(fetcher, test.config)
+
+			mustDo(t, client, "https://example.com/")
+			start := time.Now()
+			mustDo(t, client, "https://example.com/")
+			elapsed := time.Since(start)
+
+			if elapsed < test.minWait {
+				t.Errorf("second request waited %v, want >= %v", elapsed, test.minWait)
+			}
+			if test.minWait == 0 && elapsed > 500*time.Millisecond {
+				t.Errorf("second request waited %v, want no wait", elapsed)
+			}
+			if got := fetcher.Calls(); got != 2 {
+				t.Errorf("fetcher.Calls() = %v, want 2", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+// ErrCircuitOpen is returned by RetryClient when the circuit breaker for
+// the request host is open, i.e. the host has failed too many times in a row
+// recently.
+var ErrCircuitOpen = errors.New("fetch: circuit breaker open for the host")
+
+// Default values used by RetryConfig.
+const (
+	DefaultMaxRetries       = 3
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+var (
+	// DefaultRetryBackoff is the default value for RetryConfig.Backoff.
+	DefaultRetryBackoff = backoff.Backoff{
+		Factor: 2,
+		Jitter: true,
+		Min:    100 * time.Millisecond,
+		Max:    5 * time.Second,
+	}
+
+	// DefaultRetryStatusCodes is the default value for
+	// RetryConfig.RetryStatusCodes.
+	DefaultRetryStatusCodes = []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// RetryConfig configures WithRetry.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries for each request, not
+	// including the first attempt. Zero implies DefaultMaxRetries; a
+	// negative value disables retries.
+	MaxRetries int
+
+	// RetryStatusCodes is the HTTP status codes to retry the request on.
+	// nil implies DefaultRetryStatusCodes; use an empty non-nil slice to
+	// retry only on network errors.
+	RetryStatusCodes []int
+
+	// Backoff determines the wait before each retry. Only its parameters
+	// are used; the attempt counter is not touched. nil implies
+	// DefaultRetryBackoff.
+	Backoff *backoff.Backoff
+
+	// BreakerThreshold is the number of consecutive failures for a host
+	// to open the circuit breaker for the host. Failures include network
+	// errors and responses with RetryStatusCodes. Zero implies
+	// DefaultBreakerThreshold; a negative value disables the breaker.
+	BreakerThreshold int
+
+	// BreakerCooldown is the duration to keep the circuit breaker open.
+	// After that, a single trial request is allowed to the host: its
+	// success closes the breaker, and its failure opens the breaker again.
+	// Zero implies DefaultBreakerCooldown.
+	BreakerCooldown time.Duration
+}
+
+// RetryStats holds the counts reported by RetryClient.Stats.
+type RetryStats struct {
+	// Requests is the number of calls to Do.
+	Requests int64
+	// Retries is the number of retries made, in total of all requests.
+	Retries int64
+	// Failures is the number of requests failed after all attempts,
+	// either with an error or a response with RetryStatusCodes.
+	Failures int64
+	// Rejected is the number of attempts rejected by the circuit breaker.
+	Rejected int64
+}
+
+// RetryClient is a FetchClient retrying requests on transient failures.
+// See WithRetry for details.
+type RetryClient struct {
+	client FetchClient
+	config RetryConfig
+
+	stats RetryStats // Accessed atomically.
+
+	mu    sync.Mutex
+	hosts map[string]*circuitBreaker
+}
+
+// WithRetry wraps client to retry idempotent requests (GET and HEAD without
+// a body) on network errors and on responses with config.RetryStatusCodes,
+// waiting as specified by config.Backoff between attempts. Other requests
+// are sent only once. The returned client also has a circuit breaker for
+// each host (the hostname and the port), which makes Do fail immediately
+// with ErrCircuitOpen while the host is considered down.
+//
+// WithRetry does not retry when client returns ErrURLMismatch or
+// ErrForbiddenAddress, or when the request context is done.
+func WithRetry(client FetchClient, config RetryConfig) *RetryClient {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.RetryStatusCodes == nil {
+		config.RetryStatusCodes = DefaultRetryStatusCodes
+	}
+	if config.Backoff == nil {
+		config.Backoff = DefaultRetryBackoff.Copy()
+	}
+	if config.BreakerThreshold == 0 {
+		config.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if config.BreakerCooldown == 0 {
+		config.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return &RetryClient{
+		client: client,
+		config: config,
+		hosts:  make(map[string]*circuitBreaker),
+	}
+}
+
+// Stats returns the counts of requests, retries, and failures so far.
+func (c *RetryClient) Stats() RetryStats {
+	return RetryStats{
+		Requests: atomic.LoadInt64(&c.stats.Requests),
+		Retries:  atomic.LoadInt64(&c.stats.Retries),
+		Failures: atomic.LoadInt64(&c.stats.Failures),
+		Rejected: atomic.LoadInt64(&c.stats.Rejected),
+	}
+}
+
+// Do sends req to the underlying client, retrying as necessary.
+func (c *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&c.stats.Requests, 1)
+	cb := c.getCircuitBreaker(req.URL.Host)
+	ctx := req.Context()
+
+	maxRetries := c.config.MaxRetries
+	if !isIdempotent(req) {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		allowed, trial := cb.allow(time.Now(), c.config.BreakerCooldown)
+		if !allowed {
+			atomic.AddInt64(&c.stats.Rejected, 1)
+			atomic.AddInt64(&c.stats.Failures, 1)
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := c.client.Do(req)
+		if errors.Is(err, ErrURLMismatch) || errors.Is(err, ErrForbiddenAddress) ||
+			ctx.Err() != nil {
+			// Not a failure of the host.
+			cb.abort(trial)
+			return resp, err
+		}
+		failed := c.isFailure(resp, err)
+		cb.report(trial, !failed, time.Now(), &c.config)
+
+		if !failed || attempt >= maxRetries {
+			if failed {
+				atomic.AddInt64(&c.stats.Failures, 1)
+			}
+			return resp, err
+		}
+
+		wait := c.config.Backoff.ForAttempt(float64(attempt))
+		log.Printf("retrying %v in %v (retry %d of %d): %v",
+			req.URL, wait, attempt+1, maxRetries, describeFailure(resp, err))
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			atomic.AddInt64(&c.stats.Failures, 1)
+			return nil, err
+		}
+		atomic.AddInt64(&c.stats.Retries, 1)
+	}
+}
+
+func (c *RetryClient) isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	for _, code := range c.config.RetryStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *RetryClient) getCircuitBreaker(host string) *circuitBreaker {
+	host = strings.ToLower(host)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cb, ok := c.hosts[host]
+	if !ok {
+		cb = &circuitBreaker{disabled: c.config.BreakerThreshold < 0}
+		c.hosts[host] = cb
+	}
+	return cb
+}
+
+func isIdempotent(req *http.Request) bool {
+	if req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+func describeFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("server responded with status code %d", resp.StatusCode)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// circuitBreaker tracks consecutive failures for a single host.
+type circuitBreaker struct {
+	disabled bool
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // Whether a trial request is in flight.
+}
+
+// allow reports whether a request to the host is allowed at now. trial is
+// true if the request is the single trial of the half-open state, in which
+// case the caller must pass it to report or abort.
+func (cb *circuitBreaker) allow(now time.Time, cooldown time.Duration) (allowed, trial bool) {
+	if cb.disabled {
+		return true, false
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.openUntil.IsZero() {
+		return true, false // Closed.
+	}
+	if now.Before(cb.openUntil) || cb.trial {
+		return false, false
+	}
+	cb.trial = true // Half-open: allow a single trial.
+	return true, true
+}
+
+// report records the result of a request. trial is the value returned by
+// allow for the request. Only the trial settles the breaker once it has
+// opened; results of requests started before that are ignored.
+func (cb *circuitBreaker) report(trial, ok bool, now time.Time, config *RetryConfig) {
+	if cb.disabled {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if trial {
+		cb.trial = false
+	} else if !cb.openUntil.IsZero() {
+		return
+	}
+	if ok {
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		return
+	}
+	cb.failures++
+	if trial || cb.failures >= config.BreakerThreshold {
+		cb.openUntil = now.Add(config.BreakerCooldown)
+	}
+}
+
+// abort is called instead of report when the request did not reach the host
+// (e.g. it was cancelled).
+func (cb *circuitBreaker) abort(trial bool) {
+	if cb.disabled || !trial {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.trial = false
+}
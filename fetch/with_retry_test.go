@@ -0,0 +1,301 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/urlmatcher"
+	"github.com/jpillora/backoff"
+)
+
+const (
+	status200 = "HTTP/1.1 200 OK\r\n"
+	status500 = "HTTP/1.1 500 Internal Server Error\r\n"
+	status503 = "HTTP/1.1 503 Service Unavailable\r\n"
+	netError  = ""
+)
+
+func fastRetryConfig() fetch.RetryConfig {
+	return fetch.RetryConfig{
+		Backoff: &backoff.Backoff{Min: time.Millisecond, Max: 2 * time.Millisecond},
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		maxRetries int
+		headers    []string
+		wantStatus int
+		wantErr    bool
+		wantStats  fetch.RetryStats
+	}{
+		{
+			name:       "Success",
+			headers:    []string{status200},
+			wantStatus: 200,
+			wantStats:  fetch.RetryStats{Requests: 1},
+		},
+		{
+			name:       "RetryOnStatus",
+			headers:    []string{status503, status503, status200},
+			wantStatus: 200,
+			wantStats:  fetch.RetryStats{Requests: 1, Retries: 2},
+		},
+		{
+			name:       "RetryOnNetworkError",
+			headers:    []string{netError, status200},
+			wantStatus: 200,
+			wantStats:  fetch.RetryStats{Requests: 1, Retries: 1},
+		},
+		{
+			name:       "GiveUp_Status",
+			maxRetries: 2,
+			headers:    []string{status503},
+			wantStatus: 503,
+			wantStats:  fetch.RetryStats{Requests: 1, Retries: 2, Failures: 1},
+		},
+		{
+			name:       "GiveUp_NetworkError",
+			maxRetries: 1,
+			headers:    []string{netError},
+			wantErr:    true,
+			wantStats:  fetch.RetryStats{Requests: 1, Retries: 1, Failures: 1},
+		},
+		{
+			name:       "NotRetryableStatus",
+			headers:    []string{status500, status200},
+			wantStatus: 500,
+			wantStats:  fetch.RetryStats{Requests: 1},
+		},
+		{
+			name:       "NotIdempotent",
+			method:     http.MethodPost,
+			headers:    []string{status503, status200},
+			wantStatus: 503,
+			wantStats:  fetch.RetryStats{Requests: 1, Failures: 1},
+		},
+		{
+			name:       "RetryDisabled",
+			maxRetries: -1,
+			headers:    []string{status503, status200},
+			wantStatus: 503,
+			wantStats:  fetch.RetryStats{Requests: 1, Failures: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := fastRetryConfig()
+			config.MaxRetries = test.maxRetries
+			fetcher := &statusFetcher{headers: test.headers}
+			client := fetch.WithRetry(fetcher, config)
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, "https://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Do() = %v, want error", resp.Status)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Do() = error(%q), want success", err)
+				}
+				if resp.StatusCode != test.wantStatus {
+					t.Errorf("resp.StatusCode = %v, want %v", resp.StatusCode, test.wantStatus)
+				}
+			}
+			if got := client.Stats(); got != test.wantStats {
+				t.Errorf("client.Stats() = %+v, want %+v", got, test.wantStats)
+			}
+		})
+	}
+}
+
+func TestWithRetry_CircuitBreaker(t *testing.T) {
+	config := fastRetryConfig()
+	config.MaxRetries = -1
+	config.BreakerThreshold = 2
+	config.BreakerCooldown = 100 * time.Millisecond
+	fetcher := &statusFetcher{headers: []string{status503, netError, status503, status200}}
+	client := fetch.WithRetry(fetcher, config)
+
+	do := func(url string) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	do("https://example.com/a")
+	do("https://example.com/b")
+	if err := do("https://example.com/c"); err != fetch.ErrCircuitOpen {
+		t.Errorf("Do() = error(%v), want ErrCircuitOpen", err)
+	}
+	// Other hosts are not affected (though the response is 503).
+	if err := do("https://example.org/"); err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+	if got := fetcher.Calls(); got != 3 {
+		t.Errorf("fetcher.Calls() = %v, want 3", got)
+	}
+
+	// The trial after the cooldown succeeds and closes the breaker.
+	time.Sleep(120 * time.Millisecond)
+	if err := do("https://example.com/d"); err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+	if err := do("https://example.com/e"); err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+
+	want := fetch.RetryStats{Requests: 6, Failures: 4, Rejected: 1}
+	if got := client.Stats(); got != want {
+		t.Errorf("client.Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithRetry_CircuitBreakerTrialFailure(t *testing.T) {
+	config := fastRetryConfig()
+	config.MaxRetries = -1
+	config.BreakerThreshold = 1
+	config.BreakerCooldown = 50 * time.Millisecond
+	fetcher := &statusFetcher{headers: []string{status503}}
+	client := fetch.WithRetry(fetcher, config)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Do(req)
+	time.Sleep(70 * time.Millisecond)
+	if _, err := client.Do(req); err != nil {
+		t.Errorf("Do() = error(%v), want trial response", err)
+	}
+	// The failed trial opens the breaker again.
+	if _, err := client.Do(req); err != fetch.ErrCircuitOpen {
+		t.Errorf("Do() = error(%v), want ErrCircuitOpen", err)
+	}
+}
+
+func TestWithRetry_CircuitBreakerStaleResult(t *testing.T) {
+	config := fastRetryConfig()
+	config.MaxRetries = -1
+	config.BreakerThreshold = 1
+	config.BreakerCooldown = 50 * time.Millisecond
+	fetcher := newBlockingFetcher("/stale", "/fail", "/trial")
+	client := fetch.WithRetry(fetcher, config)
+
+	do := func(path string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+			if err != nil {
+				done <- err
+				return
+			}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+		return done
+	}
+
+	// The request started before the breaker opens.
+	stale := do("/stale")
+	<-fetcher.started
+	fail := do("/fail")
+	<-fetcher.started
+	fetcher.release["/fail"] <- status503
+	<-fail
+
+	time.Sleep(70 * time.Millisecond)
+	trial := do("/trial")
+	<-fetcher.started
+
+	// The stale success neither closes the breaker nor ends the trial.
+	fetcher.release["/stale"] <- status200
+	if err := <-stale; err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+	if err := <-do("/other"); err != fetch.ErrCircuitOpen {
+		t.Errorf("Do() = error(%v), want ErrCircuitOpen", err)
+	}
+
+	// The trial closes the breaker.
+	fetcher.release["/trial"] <- status200
+	if err := <-trial; err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+	if err := <-do("/other"); err != nil {
+		t.Errorf("Do() = error(%v), want success", err)
+	}
+}
+
+func TestWithRetry_NoRetryOnURLMismatch(t *testing.T) {
+	fetcher := &statusFetcher{headers: []string{status200}}
+	client := fetch.WithRetry(
+		fetch.WithSelector(fetcher, urlmatcher.HasHost("example.org")),
+		fastRetryConfig())
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); err != fetch.ErrURLMismatch {
+		t.Errorf("Do() = error(%v), want ErrURLMismatch", err)
+	}
+	if got := client.Stats().Retries; got != 0 {
+		t.Errorf("client.Stats().Retries = %v, want 0", got)
+	}
+}
+
+func TestWithRetry_ContextCancelled(t *testing.T) {
+	config := fastRetryConfig()
+	config.Backoff = &backoff.Backoff{Min: time.Hour, Max: time.Hour}
+	client := fetch.WithRetry(&statusFetcher{headers: []string{status503}}, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req)
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Errorf("Do() = error(%v), want context.DeadlineExceeded", err)
+	}
+}
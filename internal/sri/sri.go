@@ -0,0 +1,139 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sri implements the integrity metadata of Subresource Integrity.
+//
+// See https://www.w3.org/TR/SRI/ for the specification.
+package sri
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strings"
+)
+
+// algorithms maps the supported hash algorithms to their hash functions.
+// They are listed in the order of strength.
+var algorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha256", sha256.New},
+	{"sha384", sha512.New384},
+	{"sha512", sha512.New},
+}
+
+// Hash is a single hash expression in the integrity metadata, such as
+// "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC".
+type Hash struct {
+	// Algorithm is the hash algorithm name in lowercase (e.g. "sha384").
+	Algorithm string
+
+	// Digest is the decoded digest.
+	Digest []byte
+}
+
+// Metadata is the integrity metadata, namely the parsed value of an integrity
+// attribute. It consists of hashes with the supported algorithms only.
+type Metadata []Hash
+
+// Parse parses the value of an integrity attribute. Hash expressions with
+// an unknown algorithm or a malformed digest are ignored as specified in
+// the SRI specification. Options ("?...") are also ignored.
+//
+// Parse returns an error when s contains no valid hash expression: in that
+// case browsers would accept any payload, thus Metadata would not add any
+// protection.
+func Parse(s string) (Metadata, error) {
+	var m Metadata
+
+	for _, token := range strings.Fields(s) {
+		if i := strings.IndexByte(token, '?'); i >= 0 {
+			token = token[:i]
+		}
+		chunks := strings.SplitN(token, "-", 2)
+		if len(chunks) != 2 {
+			continue
+		}
+		algo := strings.ToLower(chunks[0])
+		if strength(algo) < 0 {
+			continue
+		}
+		digest, err := decodeBase64(chunks[1])
+		if err != nil {
+			continue
+		}
+		m = append(m, Hash{algo, digest})
+	}
+
+	if len(m) == 0 {
+		return nil, errors.New("sri: no valid hash expression")
+	}
+	return m, nil
+}
+
+// Match reports whether payload matches m. Following the SRI specification,
+// Match only considers the hashes using the strongest algorithm in m, and
+// reports true when payload matches any one of them.
+func (m Metadata) Match(payload []byte) bool {
+	best := -1
+	for _, h := range m {
+		if s := strength(h.Algorithm); s > best {
+			best = s
+		}
+	}
+	if best < 0 {
+		return false
+	}
+
+	hasher := algorithms[best].new()
+	hasher.Write(payload)
+	sum := hasher.Sum(nil)
+
+	for _, h := range m {
+		if strength(h.Algorithm) == best && bytes.Equal(h.Digest, sum) {
+			return true
+		}
+	}
+	return false
+}
+
+func strength(algo string) int {
+	for i, a := range algorithms {
+		if a.name == algo {
+			return i
+		}
+	}
+	return -1
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	// The SRI specification refers to base64-value in CSP, which allows both
+	// base64 and base64url encodings.
+	if strings.ContainsAny(s, "-_") {
+		return base64.URLEncoding.DecodeString(padBase64(s))
+	}
+	return base64.StdEncoding.DecodeString(padBase64(s))
+}
+
+func padBase64(s string) string {
+	if n := len(s) % 4; n != 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+	return s
+}
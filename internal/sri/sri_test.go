@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sri_test
+
+import (
+	"testing"
+
+	"github.com/google/webpackager/internal/sri"
+)
+
+const (
+	payload = "alert('Hello, world.');"
+
+	// Digests of payload.
+	sha256Digest = "sha256-qznLcsROx4GACP2dm0UCKCzCG+HiZ1guq6ZZDob/Tng="
+	sha384Digest = "sha384-H8BRh8j48O9oYatfu5AZzq6A9RINhZO5H16dQZngK7T62em8MUt1FLm52t+eX6xO"
+	sha512Digest = "sha512-Q2bFTOhEALkN8hOms2FKTDLy7eugP2zFZ1T8LCvX42Fp3WoNr3bjZSAHeOsHrbV1Fu9/A0EzCinRE7Af1ofPrw=="
+
+	// Digest of something else.
+	sha384Other = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		integrity string
+		want      bool
+	}{
+		{
+			name:      "SHA256",
+			integrity: sha256Digest,
+			want:      true,
+		},
+		{
+			name:      "SHA384",
+			integrity: sha384Digest,
+			want:      true,
+		},
+		{
+			name:      "SHA512",
+			integrity: sha512Digest,
+			want:      true,
+		},
+		{
+			name:      "Mismatch",
+			integrity: sha384Other,
+			want:      false,
+		},
+		{
+			name:      "AnyOfStrongest",
+			integrity: sha384Other + " " + sha384Digest,
+			want:      true,
+		},
+		{
+			name:      "WeakerIgnored",
+			integrity: sha256Digest + " " + sha384Other,
+			want:      false,
+		},
+		{
+			name:      "UnknownAlgorithmIgnored",
+			integrity: "md5-AAAAAAAAAAAAAAAAAAAAAA== " + sha256Digest,
+			want:      true,
+		},
+		{
+			name:      "Options",
+			integrity: sha256Digest + "?foo",
+			want:      true,
+		},
+		{
+			name:      "Base64URL",
+			integrity: "sha256-qznLcsROx4GACP2dm0UCKCzCG-HiZ1guq6ZZDob_Tng",
+			want:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := sri.Parse(test.integrity)
+			if err != nil {
+				t.Fatalf("Parse(%q) = error(%q), want success", test.integrity, err)
+			}
+			if got := m.Match([]byte(payload)); got != test.want {
+				t.Errorf("Match() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	tests := []struct {
+		name      string
+		integrity string
+	}{
+		{
+			name:      "Empty",
+			integrity: "",
+		},
+		{
+			name:      "UnknownAlgorithm",
+			integrity: "md5-AAAAAAAAAAAAAAAAAAAAAA==",
+		},
+		{
+			name:      "MalformedDigest",
+			integrity: "sha256-!!!",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := sri.Parse(test.integrity); err == nil {
+				t.Errorf("Parse(%q) = success, want error", test.integrity)
+			}
+		})
+	}
+}
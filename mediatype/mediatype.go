@@ -0,0 +1,69 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mediatype implements media type patterns with wildcards (e.g.
+// "image/*") and structured syntax suffixes (e.g. "application/*+json"),
+// used to look up the entries keyed by media types.
+package mediatype
+
+import (
+	"strings"
+)
+
+// Candidates returns the patterns matching mediaType, from the most specific
+// one to the least specific one. mediaType should be in lowercase and have
+// no parameters (e.g. "text/html", not "Text/HTML" or "text/html; charset=utf-8").
+// The patterns are, in the order of precedence:
+//
+//	type/subtype   the exact media type (e.g. "application/ld+json")
+//	type/*+suffix  the structured syntax suffix (e.g. "application/*+json")
+//	type/*         any subtype of the type (e.g. "application/*")
+//	*/*            any media type
+//
+// The suffix pattern is included only when the subtype has a suffix.
+// Candidates returns nil if mediaType is not in the "type/subtype" form.
+//
+// Candidates defines the precedence rule used by Lookup, thus by
+// processor.MultiplexedProcessor and vprule.PerContentType.
+func Candidates(mediaType string) []string {
+	i := strings.IndexByte(mediaType, '/')
+	if i <= 0 || i == len(mediaType)-1 {
+		return nil
+	}
+	typ, subtype := mediaType[:i], mediaType[i+1:]
+
+	candidates := []string{mediaType}
+	if j := strings.LastIndexByte(subtype, '+'); j >= 0 && j < len(subtype)-1 {
+		candidates = append(candidates, typ+"/*"+subtype[j:])
+	}
+	if subtype != "*" {
+		candidates = append(candidates, typ+"/*")
+	}
+	if typ != "*" {
+		candidates = append(candidates, "*/*")
+	}
+	return candidates
+}
+
+// Lookup returns the most specific pattern for mediaType that satisfies has,
+// which usually reports whether a map has the given key. ok is false when no
+// pattern satisfies has.
+func Lookup(mediaType string, has func(pattern string) bool) (pattern string, ok bool) {
+	for _, p := range Candidates(mediaType) {
+		if has(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
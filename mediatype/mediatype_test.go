@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediatype_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/mediatype"
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		want      []string
+	}{
+		{
+			mediaType: "text/html",
+			want:      []string{"text/html", "text/*", "*/*"},
+		},
+		{
+			mediaType: "application/ld+json",
+			want:      []string{"application/ld+json", "application/*+json", "application/*", "*/*"},
+		},
+		{
+			mediaType: "application/vnd.a+b+xml",
+			want:      []string{"application/vnd.a+b+xml", "application/*+xml", "application/*", "*/*"},
+		},
+		{
+			mediaType: "application/foo+",
+			want:      []string{"application/foo+", "application/*", "*/*"},
+		},
+		{
+			mediaType: "image/*",
+			want:      []string{"image/*", "*/*"},
+		},
+		{
+			mediaType: "*/*",
+			want:      []string{"*/*"},
+		},
+		{
+			mediaType: "text",
+			want:      nil,
+		},
+		{
+			mediaType: "text/",
+			want:      nil,
+		},
+		{
+			mediaType: "",
+			want:      nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mediaType, func(t *testing.T) {
+			got := mediatype.Candidates(test.mediaType)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Candidates(%q) mismatch (-want +got):\n%s", test.mediaType, diff)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	keys := map[string]bool{
+		"image/svg+xml":      true,
+		"image/*":            true,
+		"application/*+json": true,
+		"application/json":   true,
+	}
+	has := func(pattern string) bool { return keys[pattern] }
+
+	tests := []struct {
+		mediaType string
+		want      string
+		ok        bool
+	}{
+		{"image/svg+xml", "image/svg+xml", true},
+		{"image/png", "image/*", true},
+		{"application/json", "application/json", true},
+		{"application/ld+json", "application/*+json", true},
+		{"application/xhtml+xml", "", false},
+		{"text/html", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mediaType, func(t *testing.T) {
+			got, ok := mediatype.Lookup(test.mediaType, has)
+			if got != test.want || ok != test.ok {
+				t.Errorf("Lookup(%q) = (%q, %v), want (%q, %v)", test.mediaType, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
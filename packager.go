@@ -68,7 +68,7 @@ func (pkg *Packager) RunForRequest(req *http.Request, sxgDate time.Time) (*resou
 		return nil, xerrors.Errorf("packaging: %w", err)
 	}
 	r := resource.NewResource(req.URL)
-	runner.run(nil, req, r)
+	runner.run(nil, req, r, nil)
 	if err != nil {
 		return nil, xerrors.Errorf("processing: %w", err)
 	}
@@ -15,13 +15,17 @@
 package webpackager_test
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/webpackager"
+	"github.com/google/webpackager/certchain"
 	"github.com/google/webpackager/exchange"
 	"github.com/google/webpackager/exchange/vprule"
 	"github.com/google/webpackager/fetch"
@@ -31,6 +35,7 @@ import (
 	"github.com/google/webpackager/processor/complexproc"
 	"github.com/google/webpackager/processor/htmlproc"
 	"github.com/google/webpackager/processor/htmlproc/htmltask"
+	webpkgserver "github.com/google/webpackager/server"
 )
 
 var (
@@ -199,6 +204,46 @@ func TestRequestTweaker(t *testing.T) {
 	}
 }
 
+func TestCacheVaryHeaders(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html><p>Hello, world!</p>`),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	config := makeConfig(server)
+	config.CacheVaryHeaders = []string{"accept-language"}
+	pkg := webpackager.NewPackager(config)
+
+	for _, lang := range []string{"en", "ja", "en", ""} {
+		req, err := http.NewRequest(http.MethodGet, "https://example.org/hello.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		r, err := pkg.RunForRequest(req, date)
+		if err != nil {
+			t.Fatalf("pkg.RunForRequest() = error(%q), want success", err)
+		}
+		if got := r.VaryHeader.Get("Accept-Language"); got != lang {
+			t.Errorf(`r.VaryHeader.Get("Accept-Language") = %q, want %q`, got, lang)
+		}
+	}
+
+	// The third request reuses the first one.
+	var got []string
+	for _, req := range pkg.FetchClient.(*fetchtest.FetchClient).Requests() {
+		got = append(got, req.Header.Get("Accept-Language"))
+	}
+	if diff := cmp.Diff([]string{"en", "ja", ""}, got); diff != "" {
+		t.Errorf("Requests() mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestNoExchanges(t *testing.T) {
 	handlers := http.NewServeMux()
 	handlers.Handle(
@@ -330,3 +375,487 @@ func TestSubresourceErrorsKeepPreloads(t *testing.T) {
 		`<https://example.org/nonexistent2.css>;rel="preload";as="style"`))
 	verifyExchange(t, pkg, "https://example.org/valid.css", date, "")
 }
+
+func TestScriptIntegrity(t *testing.T) {
+	const (
+		validIntegrity   = "sha384-H8BRh8j48O9oYatfu5AZzq6A9RINhZO5H16dQZngK7T62em8MUt1FLm52t+eX6xO"
+		invalidIntegrity = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+	)
+
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<script src="valid.js" integrity="`+validIntegrity+`"></script>`+
+			`<script src="invalid.js" integrity="`+invalidIntegrity+`"></script>`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/valid.js",
+		stubTextHandler(`alert('Hello, world.');`, "application/javascript"),
+	)
+	handlers.Handle(
+		"example.org/invalid.js",
+		stubTextHandler(`alert('Hello, world.');`, "application/javascript"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+		HTML: htmlproc.Config{
+			TaskSet: []htmltask.HTMLTask{htmltask.PreloadScriptsWithIntegrity()},
+		},
+	})
+	pkg := webpackager.NewPackager(cfg)
+	_, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+
+	// invalid.js does not match the integrity thus should fail.
+	verifyErrorURLs(t, err, []string{
+		"https://example.org/invalid.js",
+	})
+
+	// The exchange for the main resource contains preload directives only
+	// for the script matching the integrity.
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, fmt.Sprint(
+		`<https://example.org/valid.js>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-WlUiwO010l9PUkq4q5l70LcqGMdRAqZQCZtE+FUWoKo=",`,
+		`<https://example.org/valid.js>;rel="preload";as="script"`))
+	verifyExchange(t, pkg, "https://example.org/valid.js", date, "")
+}
+
+func TestScriptIntegrity_WithInsecurePreload(t *testing.T) {
+	const invalidIntegrity = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<script src="invalid.js" integrity="`+invalidIntegrity+`" crossorigin="anonymous"></script>`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/invalid.js",
+		stubTextHandler(`alert('Hello, world.');`, "application/javascript"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+		HTML: htmlproc.Config{
+			TaskSet: []htmltask.HTMLTask{
+				htmltask.PreloadScriptsWithIntegrity(),
+				htmltask.InsecurePreloadScripts(),
+			},
+		},
+	})
+	pkg := webpackager.NewPackager(cfg)
+	_, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+
+	verifyErrorURLs(t, err, []string{
+		"https://example.org/invalid.js",
+	})
+	verifyRequests(t, pkg, []string{
+		"https://example.org/hello.html",
+		"https://example.org/invalid.js",
+	})
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, "")
+}
+
+func TestScriptIntegrity_ContentEncoding(t *testing.T) {
+	const (
+		validIntegrity   = "sha384-H8BRh8j48O9oYatfu5AZzq6A9RINhZO5H16dQZngK7T62em8MUt1FLm52t+eX6xO"
+		invalidIntegrity = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+	)
+
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<script src="valid.js" integrity="`+validIntegrity+`"></script>`+
+			`<script src="invalid.js" integrity="`+invalidIntegrity+`"></script>`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/other.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<script src="valid.js" integrity="`+validIntegrity+`"></script>`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/valid.js",
+		stubTextHandler(`alert('Hello, world.');`, "application/javascript"),
+	)
+	handlers.Handle(
+		"example.org/invalid.js",
+		stubTextHandler(`alert('Hello, world.');`, "application/javascript"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	for _, coding := range []string{"gzip", "deflate"} {
+		t.Run(coding, func(t *testing.T) {
+			cfg := makeConfig(server)
+			cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+				HTML: htmlproc.Config{
+					TaskSet: []htmltask.HTMLTask{htmltask.PreloadScriptsWithIntegrity()},
+				},
+				ContentEncoding: coding,
+			})
+			pkg := webpackager.NewPackager(cfg)
+
+			_, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+			verifyErrorURLs(t, err, []string{
+				"https://example.org/invalid.js",
+			})
+
+			// other.html reuses valid.js after verifying its integrity.
+			_, err = pkg.Run(urlutil.MustParse("https://example.org/other.html"), date)
+			if err != nil {
+				t.Errorf("Run() = error(%q), want success", err)
+			}
+			verifyRequests(t, pkg, []string{
+				"https://example.org/hello.html",
+				"https://example.org/valid.js",
+				"https://example.org/invalid.js",
+				"https://example.org/other.html",
+			})
+		})
+	}
+}
+
+func TestImageByteBudget(t *testing.T) {
+	image := strings.Repeat("x", 100)
+
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<img src="hero1.png" fetchpriority="high">`+
+			`<img src="hero2.png" fetchpriority="high">`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/hero1.png",
+		stubTextHandler(image, "image/png"),
+	)
+	handlers.Handle(
+		"example.org/hero2.png",
+		stubTextHandler(image, "image/png"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+		HTML: htmlproc.Config{
+			TaskSet: []htmltask.HTMLTask{
+				htmltask.PreloadLCPImages(htmltask.LCPImageConfig{
+					MaxCount:   2,
+					ByteBudget: 150,
+				}),
+			},
+		},
+	})
+	pkg := webpackager.NewPackager(cfg)
+	if _, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date); err != nil {
+		t.Fatalf("pkg.Run() = error(%q), want success", err)
+	}
+
+	// Both images are fetched.
+	verifyRequests(t, pkg, []string{
+		"https://example.org/hello.html",
+		"https://example.org/hero1.png",
+		"https://example.org/hero2.png",
+	})
+	// Only hero1.png is preloaded since hero2.png exceeds the budget.
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, fmt.Sprint(
+		`<https://example.org/hero1.png>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-0QwSa4yRUsy8lM1nUoz1gwcTbDu/3X5UptoDwbY2ctg=",`,
+		`<https://example.org/hero1.png>;rel="preload";as="image"`))
+}
+
+func TestImageByteBudget_SubresourceError(t *testing.T) {
+	image := strings.Repeat("x", 100)
+
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<img src="missing.png" fetchpriority="high">`+
+			`<img src="hero.png" fetchpriority="high">`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/hero.png",
+		stubTextHandler(image, "image/png"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	ef, err := cfg.ExchangeFactory.Get()
+	if err != nil {
+		t.Errorf("ExchangeFactory.Get() = error(%q), want success", err)
+	}
+	ef.KeepNonSXGPreloads = true
+	cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+		HTML: htmlproc.Config{
+			TaskSet: []htmltask.HTMLTask{
+				htmltask.PreloadLCPImages(htmltask.LCPImageConfig{
+					MaxCount:   2,
+					ByteBudget: 150,
+				}),
+			},
+		},
+	})
+	pkg := webpackager.NewPackager(cfg)
+	_, err = pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+
+	verifyErrorURLs(t, err, []string{
+		"https://example.org/missing.png",
+	})
+	// missing.png is not preloaded since its size is unknown, even with
+	// KeepNonSXGPreloads.
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, fmt.Sprint(
+		`<https://example.org/hero.png>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-0QwSa4yRUsy8lM1nUoz1gwcTbDu/3X5UptoDwbY2ctg=",`,
+		`<https://example.org/hero.png>;rel="preload";as="image"`))
+}
+
+func TestModuleGraph(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<script type="module" src="main.mjs"></script>`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/main.mjs",
+		stubTextHandler(`import {greet} from "./greet.mjs"; greet();`, "text/javascript"),
+	)
+	handlers.Handle(
+		"example.org/greet.mjs",
+		stubTextHandler(`export function greet() { alert('Hello, world.'); }`, "text/javascript"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	cfg.Processor = complexproc.NewComprehensiveProcessor(complexproc.Config{
+		HTML: htmlproc.Config{
+			TaskSet: []htmltask.HTMLTask{htmltask.InsecurePreloadScripts()},
+		},
+	})
+	pkg := webpackager.NewPackager(cfg)
+	if _, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date); err != nil {
+		t.Fatalf("pkg.Run() = error(%q), want success", err)
+	}
+
+	verifyRequests(t, pkg, []string{
+		"https://example.org/hello.html",
+		"https://example.org/main.mjs",
+		"https://example.org/greet.mjs",
+	})
+	// The import from main.mjs is hoisted to the main resource.
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, fmt.Sprint(
+		`<https://example.org/main.mjs>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-P3pIivXJWIJJ5PjsmV2M81E5HSX2GkjWvsR+VvhPVRA=",`,
+		`<https://example.org/main.mjs>;rel="preload";as="script";crossorigin,`,
+		`<https://example.org/greet.mjs>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-AqKCEHRHdfXnMzzBoKMaRCEN/xb2c5RORURTlojSl0Y=",`,
+		`<https://example.org/greet.mjs>;rel="preload";as="script";crossorigin`))
+	verifyExchange(t, pkg, "https://example.org/main.mjs", date, "")
+	verifyExchange(t, pkg, "https://example.org/greet.mjs", date, "")
+}
+
+// makeFactoryForHosts creates an exchange.Factory whose end-entity certificate
+// claims hosts in the Subject Alternative Names. The claim is not reflected
+// to the raw certificate, thus not to the signed exchanges.
+func makeFactoryForHosts(certURL string, hosts ...string) *exchange.Factory {
+	chain := certchaintest.MustReadAugmentedChainFile("testdata/certs/cbor/ecdsap256_nosct.cbor")
+
+	leaf := *chain.Leaf
+	leaf.DNSNames = hosts
+	raw := *chain.RawChain
+	raw.Leaf = &leaf
+	raw.Certs = append([]*x509.Certificate{&leaf}, raw.Certs[1:]...)
+
+	return exchange.NewFactory(exchange.Config{
+		CertChain:  certchain.NewAugmentedChain(&raw, chain.OCSPResp, chain.SCTList),
+		CertURL:    urlutil.MustParse(certURL),
+		PrivateKey: certchaintest.MustReadPrivateKeyFile("testdata/keys/ecdsap256.key"),
+	})
+}
+
+func TestMultiCert(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<link href="https://static.example.org/style.css" rel="stylesheet">`+
+			`<link href="https://example.com/style.css" rel="stylesheet">`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"static.example.org/style.css",
+		stubTextHandler(`body { font-family: sans-serif; }`, "text/css"),
+	)
+	handlers.Handle(
+		"example.com/style.css",
+		stubTextHandler(`body { font-family: sans-serif; }`, "text/css"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	cfg.ExchangeFactory = exchange.NewMultiCertFactoryProvider(
+		makeFactoryForHosts("https://example.org/cert.cbor", "example.org"),
+		makeFactoryForHosts("https://static.example.org/cert.cbor", "static.example.org"),
+	)
+	pkg := webpackager.NewPackager(cfg)
+	_, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+
+	// No certificate covers example.com, thus it is not even fetched.
+	verifyErrorURLs(t, err, []string{
+		"https://example.com/style.css",
+	})
+	verifyRequests(t, pkg, []string{
+		"https://example.org/hello.html",
+		"https://static.example.org/style.css",
+	})
+
+	verifyExchange(t, pkg, "https://example.org/hello.html", date, fmt.Sprint(
+		`<https://static.example.org/style.css>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-+Xd20Pyxhd3oSvNo2ucj9gdj7ZkHavIaDGkucYF76J8=",`,
+		`<https://static.example.org/style.css>;rel="preload";as="style"`))
+
+	tests := []struct {
+		url     string
+		certURL string
+	}{
+		{"https://example.org/hello.html", "https://example.org/cert.cbor"},
+		{"https://static.example.org/style.css", "https://static.example.org/cert.cbor"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		r, err := pkg.ResourceCache.Lookup(req)
+		if err != nil || r == nil {
+			t.Errorf("Lookup(%q) = (%v, %v), want non-nil", test.url, r, err)
+			continue
+		}
+		if !strings.Contains(r.Exchange.SignatureHeaderValue, `cert-url="`+test.certURL+`"`) {
+			t.Errorf("sxg[%q] signature = %q, want cert-url %q", test.url, r.Exchange.SignatureHeaderValue, test.certURL)
+		}
+	}
+}
+
+func TestPreloadCrossOrigin(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"www.example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<link href="https://static.example.org/style.css" rel="stylesheet">`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"static.example.org/style.css",
+		stubTextHandler(`body { font-family: sans-serif; }`, "text/css"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	// One certificate covers both origins, as configured by webpkgserver
+	// with PreloadCrossOrigin.
+	cfg.ExchangeFactory = &webpkgserver.HostFactoryProvider{
+		Default: makeFactoryForHosts("https://www.example.org/cert.cbor",
+			"www.example.org", "static.example.org"),
+	}
+	pkg := webpackager.NewPackager(cfg)
+	if _, err := pkg.Run(urlutil.MustParse("https://www.example.org/hello.html"), date); err != nil {
+		t.Errorf("pkg.Run() = error(%q), want success", err)
+	}
+
+	verifyExchange(t, pkg, "https://www.example.org/hello.html", date, fmt.Sprint(
+		`<https://static.example.org/style.css>;rel="allowed-alt-sxg";`+
+			`header-integrity="sha256-+Xd20Pyxhd3oSvNo2ucj9gdj7ZkHavIaDGkucYF76J8=",`,
+		`<https://static.example.org/style.css>;rel="preload";as="style"`))
+}
+
+func TestURLFactoryProvider_HostnameMismatch(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html>`+
+			`<link href="https://static.example.org/style.css" rel="stylesheet">`+
+			`<p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"static.example.org/style.css",
+		stubTextHandler(`body { font-family: sans-serif; }`, "text/css"),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	cfg := makeConfig(server)
+	// static.example.org is mapped to the identity of example.org by mistake.
+	example := makeFactoryForHosts("https://example.org/cert.cbor", "example.org")
+	cfg.ExchangeFactory = &webpkgserver.HostFactoryProvider{
+		Hosts: map[string]exchange.FactoryProvider{
+			"example.org":        example,
+			"static.example.org": example,
+		},
+	}
+	pkg := webpackager.NewPackager(cfg)
+	_, err := pkg.Run(urlutil.MustParse("https://example.org/hello.html"), date)
+
+	// The certificate does not cover static.example.org, thus it is not
+	// even fetched.
+	verifyErrorURLs(t, err, []string{
+		"https://static.example.org/style.css",
+	})
+	verifyRequests(t, pkg, []string{
+		"https://example.org/hello.html",
+	})
+}
+
+func TestRedirectReleasesConnection(t *testing.T) {
+	handlers := http.NewServeMux()
+	handlers.Handle(
+		"example.org/hello.html",
+		stubHTMLHandler(`<!doctype html><p>Hello, world!</p>`),
+	)
+	handlers.Handle(
+		"example.org/redirect.html",
+		http.RedirectHandler("hello.html", http.StatusFound),
+	)
+	server := httptest.NewTLSServer(handlers)
+	defer server.Close()
+
+	config := makeConfig(server)
+	config.FetchClient = fetch.WithPoliteness(
+		config.FetchClient, fetch.PolitenessConfig{MaxConcurrency: 1})
+	pkg := webpackager.NewPackager(config)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			url := "https://example.org/redirect.html"
+			_, err := pkg.Run(urlutil.MustParse(url), date)
+			verifyErrorURLs(t, err, []string{url})
+		}
+		url := "https://example.org/hello.html"
+		if _, err := pkg.Run(urlutil.MustParse(url), date); err != nil {
+			t.Errorf("Run(%q) = error(%q), want success", url, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() blocked after redirects")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commonproc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/processor"
+)
+
+// DecodeContent returns a processor to decode the payload as specified in
+// the Content-Encoding header. The processor supports gzip, x-gzip, deflate
+// and identity, and fails on any other content-coding. It removes the
+// Content-Encoding and Content-Length headers after decoding the payload.
+//
+// maxSize limits the size of the decoded payload in bytes, so the processor
+// can fail early on oversized (possibly malicious) content. A negative value
+// sets no limit.
+func DecodeContent(maxSize int) processor.Processor {
+	return &decodeContent{maxSize}
+}
+
+type decodeContent struct {
+	maxSize int
+}
+
+func (dc *decodeContent) Process(resp *exchange.Response) error {
+	codings := parseContentEncoding(resp.Header.Values("Content-Encoding"))
+	if len(codings) == 0 {
+		return nil
+	}
+
+	payload := resp.Payload
+	// Content-Encoding lists the codings in the order they were applied.
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		payload, err = dc.decode(codings[i], payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode content: %v", err)
+		}
+	}
+
+	resp.Payload = payload
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
+func (dc *decodeContent) decode(coding string, payload []byte) ([]byte, error) {
+	var r io.Reader
+	switch coding {
+	case "identity":
+		return payload, nil
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "deflate":
+		// "deflate" means the zlib format, but some servers send raw
+		// deflate data instead.
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			r = flate.NewReader(bytes.NewReader(payload))
+		} else {
+			r = zr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content-coding %q", coding)
+	}
+
+	if dc.maxSize < 0 {
+		return ioutil.ReadAll(r)
+	}
+	decoded, err := ioutil.ReadAll(io.LimitReader(r, int64(dc.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > dc.maxSize {
+		return nil, fmt.Errorf("oversized content (limit: %d bytes)", dc.maxSize)
+	}
+	return decoded, nil
+}
+
+// EncodeContent returns a processor to encode the payload with coding and
+// set the Content-Encoding header accordingly. coding is either "gzip" or
+// "deflate"; EncodeContent panics on any other value. The processor is
+// meant to run after all other processors, on the payload not yet encoded.
+// It fails if the response already has the Content-Encoding header.
+func EncodeContent(coding string) processor.Processor {
+	if coding != "gzip" && coding != "deflate" {
+		panic(fmt.Sprintf("unsupported content-coding %q", coding))
+	}
+	return &encodeContent{coding}
+}
+
+type encodeContent struct {
+	coding string
+}
+
+func (ec *encodeContent) Process(resp *exchange.Response) error {
+	if value := resp.Header.Get("Content-Encoding"); value != "" {
+		return fmt.Errorf("content already encoded with %q", value)
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch ec.coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(resp.Payload); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp.Payload = buf.Bytes()
+	resp.Header.Set("Content-Encoding", ec.coding)
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
+// parseContentEncoding returns the content-codings listed in values, in
+// lowercase.
+func parseContentEncoding(values []string) []string {
+	value := strings.Join(values, ",")
+	var codings []string
+	for _, field := range strings.Split(value, ",") {
+		if coding := strings.ToLower(strings.TrimSpace(field)); coding != "" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
@@ -0,0 +1,240 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commonproc_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor/commonproc"
+)
+
+const testContent = "<!doctype html><p>Hello, world!</p>"
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data string) string {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func newGzipWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+func newZlibWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+func newFlateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func makeEncodedResponse(encoding, payload string) *exchange.Response {
+	header := ""
+	if encoding != "" {
+		header = "Content-Encoding: " + encoding + "\r\n"
+	}
+	return exchangetest.MakeResponse(
+		"https://example.org/hello.html",
+		fmt.Sprint(
+			"HTTP/1.1 200 OK\r\n",
+			"Content-Length: ", len(payload), "\r\n",
+			"Content-Type: text/html;charset=utf-8\r\n",
+			header,
+			"\r\n",
+			payload))
+}
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		payload  string
+	}{
+		{
+			name:     "Gzip",
+			encoding: "gzip",
+			payload:  compress(t, newGzipWriter, testContent),
+		},
+		{
+			name:     "XGzip",
+			encoding: "X-Gzip",
+			payload:  compress(t, newGzipWriter, testContent),
+		},
+		{
+			name:     "Deflate",
+			encoding: "deflate",
+			payload:  compress(t, newZlibWriter, testContent),
+		},
+		{
+			name:     "RawDeflate",
+			encoding: "deflate",
+			payload:  compress(t, newFlateWriter, testContent),
+		},
+		{
+			name:     "Identity",
+			encoding: "identity",
+			payload:  testContent,
+		},
+		{
+			name:     "Multiple",
+			encoding: "deflate, gzip",
+			payload:  compress(t, newGzipWriter, compress(t, newZlibWriter, testContent)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeEncodedResponse(test.encoding, test.payload)
+
+			if err := commonproc.DecodeContent(-1).Process(resp); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got := string(resp.Payload); got != testContent {
+				t.Errorf("resp.Payload = %q, want %q", got, testContent)
+			}
+			want := http.Header{
+				"Content-Type": []string{"text/html;charset=utf-8"},
+			}
+			if diff := cmp.Diff(want, resp.Header); diff != "" {
+				t.Errorf("resp.Header mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeContent_NoEncoding(t *testing.T) {
+	resp := makeEncodedResponse("", testContent)
+	want := resp.Header.Clone()
+
+	if err := commonproc.DecodeContent(-1).Process(resp); err != nil {
+		t.Fatalf("got error(%q), want success", err)
+	}
+	if got := string(resp.Payload); got != testContent {
+		t.Errorf("resp.Payload = %q, want %q", got, testContent)
+	}
+	if diff := cmp.Diff(want, resp.Header); diff != "" {
+		t.Errorf("resp.Header mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeContent_Error(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		payload  string
+		maxSize  int
+	}{
+		{
+			name:     "Unsupported",
+			encoding: "br",
+			payload:  testContent,
+			maxSize:  -1,
+		},
+		{
+			name:     "Corrupted",
+			encoding: "gzip",
+			payload:  testContent,
+			maxSize:  -1,
+		},
+		{
+			name:     "Oversized",
+			encoding: "gzip",
+			payload:  compress(t, newGzipWriter, strings.Repeat("x", 1000)),
+			maxSize:  999,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeEncodedResponse(test.encoding, test.payload)
+
+			if err := commonproc.DecodeContent(test.maxSize).Process(resp); err == nil {
+				t.Error("got success, want error")
+			}
+			if got := string(resp.Payload); got != test.payload {
+				t.Errorf("resp.Payload = %q, want %q", got, test.payload)
+			}
+		})
+	}
+}
+
+func TestEncodeContent(t *testing.T) {
+	tests := []struct {
+		coding    string
+		newReader func(io.Reader) (io.Reader, error)
+	}{
+		{
+			coding: "gzip",
+			newReader: func(r io.Reader) (io.Reader, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		{
+			coding: "deflate",
+			newReader: func(r io.Reader) (io.Reader, error) {
+				return zlib.NewReader(r)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.coding, func(t *testing.T) {
+			resp := makeEncodedResponse("", testContent)
+
+			if err := commonproc.EncodeContent(test.coding).Process(resp); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != test.coding {
+				t.Errorf(`resp.Header.Get("Content-Encoding") = %q, want %q`, got, test.coding)
+			}
+			if got := resp.Header.Get("Content-Length"); got != "" {
+				t.Errorf(`resp.Header.Get("Content-Length") = %q, want ""`, got)
+			}
+
+			r, err := test.newReader(bytes.NewReader(resp.Payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != testContent {
+				t.Errorf("decoded payload = %q, want %q", decoded, testContent)
+			}
+		})
+	}
+}
+
+func TestEncodeContent_AlreadyEncoded(t *testing.T) {
+	resp := makeEncodedResponse("gzip", compress(t, newGzipWriter, testContent))
+
+	if err := commonproc.EncodeContent("gzip").Process(resp); err == nil {
+		t.Error("got success, want error")
+	}
+}
@@ -15,22 +15,36 @@
 package commonproc
 
 import (
+	"net/url"
+
 	"github.com/google/webpackager/exchange"
 	"github.com/google/webpackager/internal/urlutil"
 	"github.com/google/webpackager/processor"
+	"github.com/google/webpackager/urlmatcher"
 )
 
 // ApplySameOriginPolicy erases the preload links that may load cross-doamin
 // resources.
-var ApplySameOriginPolicy processor.Processor = &applySameOriginPolicy{}
+var ApplySameOriginPolicy processor.Processor = NewSameOriginPolicy(nil)
+
+// NewSameOriginPolicy returns a processor which erases the preload links
+// that may load cross-domain resources, except those matching allow. allow
+// usually represents additional origins which can be signed with the same
+// certificate (e.g. static.example.com for www.example.com). allow may be
+// nil, in which case the processor is equivalent to ApplySameOriginPolicy.
+func NewSameOriginPolicy(allow urlmatcher.Matcher) processor.Processor {
+	return &applySameOriginPolicy{allow}
+}
 
-type applySameOriginPolicy struct{}
+type applySameOriginPolicy struct {
+	allow urlmatcher.Matcher
+}
 
-func (*applySameOriginPolicy) Process(resp *exchange.Response) error {
+func (policy *applySameOriginPolicy) Process(resp *exchange.Response) error {
 	i := 0
 
 	for _, p := range resp.Preloads {
-		if urlutil.HasSameOrigin(p.URL, resp.Request.URL) {
+		if policy.isAllowed(p.URL, resp) {
 			resp.Preloads[i] = p
 			i++
 		}
@@ -39,3 +53,10 @@ func (*applySameOriginPolicy) Process(resp *exchange.Response) error {
 
 	return nil
 }
+
+func (policy *applySameOriginPolicy) isAllowed(u *url.URL, resp *exchange.Response) bool {
+	if urlutil.HasSameOrigin(u, resp.Request.URL) {
+		return true
+	}
+	return policy.allow != nil && policy.allow.Match(u)
+}
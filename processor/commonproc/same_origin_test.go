@@ -22,6 +22,7 @@ import (
 	"github.com/google/webpackager/processor/commonproc"
 	"github.com/google/webpackager/resource/preload"
 	"github.com/google/webpackager/resource/preload/preloadtest"
+	"github.com/google/webpackager/urlmatcher"
 )
 
 func TestApplySameOriginPolicy(t *testing.T) {
@@ -49,6 +50,34 @@ func TestApplySameOriginPolicy(t *testing.T) {
 	}
 }
 
+func TestNewSameOriginPolicy(t *testing.T) {
+	resp := exchangetest.MakeEmptyResponse("https://www.example.com/")
+
+	pl := preloadtest.NewPreloadForRawURL
+
+	resp.Preloads = []*preload.Preload{
+		pl("https://www.example.com/assets/foo.css", preload.AsStyle),
+		pl("https://static.example.com/assets/bar.css", preload.AsStyle),
+		pl("http://static.example.com/assets/baz.css", preload.AsStyle),
+		pl("https://cdn.example.org/assets/qux.js", preload.AsScript),
+	}
+	want := []*preload.Preload{
+		pl("https://www.example.com/assets/foo.css", preload.AsStyle),
+		pl("https://static.example.com/assets/bar.css", preload.AsStyle),
+	}
+
+	policy := commonproc.NewSameOriginPolicy(urlmatcher.AllOf(
+		urlmatcher.HasScheme("https"),
+		urlmatcher.HasHostname("static.example.com"),
+	))
+	if err := policy.Process(resp); err != nil {
+		t.Fatalf("got error(%q), want success", err)
+	}
+	if diff := cmp.Diff(want, resp.Preloads); diff != "" {
+		t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestApplySameOriginPolicy_Empty(t *testing.T) {
 	resp := exchangetest.MakeEmptyResponse("https://example.org/")
 
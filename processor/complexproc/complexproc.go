@@ -18,7 +18,9 @@ import (
 	"github.com/google/webpackager/processor"
 	"github.com/google/webpackager/processor/commonproc"
 	"github.com/google/webpackager/processor/htmlproc"
+	"github.com/google/webpackager/processor/jsproc"
 	"github.com/google/webpackager/processor/preverify"
+	"github.com/google/webpackager/urlmatcher"
 )
 
 // DefaultProcessor is the processor used by webpackager.Packager by default.
@@ -47,6 +49,29 @@ type Config struct {
 
 	// CustomPostprocessors are run after the main processor.
 	CustomPostprocessors processor.SequentialProcessor
+
+	// ContentEncoding specifies the content-coding ("gzip" or "deflate")
+	// to apply to the payload after all other processors. Empty implies no
+	// content-coding. Note ComprehensiveProcessor always decodes the payload
+	// from the content-codings given by the server before any processing;
+	// see commonproc.DecodeContent.
+	ContentEncoding string
+
+	// URLRoutes specifies different configurations for different URLs.
+	// ComprehensiveProcessor uses the Config of the first URLRoute whose
+	// Matcher matches the request URL, or this Config when none matches.
+	// Note the Config in URLRoute replaces this Config entirely; it does not
+	// inherit any field from this Config.
+	URLRoutes []URLRoute
+}
+
+// URLRoute associates a Config with the URLs matching Matcher.
+type URLRoute struct {
+	// Matcher specifies the URLs to apply Config to.
+	Matcher urlmatcher.Matcher
+
+	// Config is used to create the processor for the URLs.
+	Config Config
 }
 
 // These processors are always included in ComprehensiveProcessors.
@@ -65,8 +90,12 @@ var (
 // NewComprehensiveProcessor creates and initializes a new processor based
 // on the provided Config.
 func NewComprehensiveProcessor(config Config) processor.Processor {
+	if len(config.URLRoutes) != 0 {
+		return newURLRoutedProcessor(config)
+	}
 	// TODO(yuizumi): Maybe flatten these processors.
-	return processor.SequentialProcessor{
+	p := processor.SequentialProcessor{
+		commonproc.DecodeContent(maxContentLength(config.Preverify)),
 		preverify.CheckPrerequisites(config.Preverify),
 		EssentialPreprocessors,
 		config.CustomPreprocessors,
@@ -74,14 +103,34 @@ func NewComprehensiveProcessor(config Config) processor.Processor {
 		EssentialPostprocessors,
 		config.CustomPostprocessors,
 	}
+	if config.ContentEncoding != "" {
+		p = append(p, commonproc.EncodeContent(config.ContentEncoding))
+	}
+	return p
+}
+
+// maxContentLength returns the maximum content length enforced by
+// preverify.CheckPrerequisites, or -1 for no limit.
+func maxContentLength(config preverify.Config) int {
+	switch {
+	case config.MaxContentLength == 0:
+		return preverify.DefaultMaxContentLength
+	case config.MaxContentLength < 0:
+		return -1
+	default:
+		return config.MaxContentLength
+	}
 }
 
 func newMainProcessor(config Config) processor.Processor {
 	// TODO(yuizumi): Add processors for other types (e.g. images).
 	html := htmlproc.NewHTMLProcessor(config.HTML)
 	mp := processor.MultiplexedProcessor{
-		"text/html":             html,
-		"application/xhtml+xml": html,
+		"text/html":                html,
+		"application/xhtml+xml":    html,
+		"text/javascript":          jsproc.ExtractModuleImports,
+		"application/javascript":   jsproc.ExtractModuleImports,
+		"application/x-javascript": jsproc.ExtractModuleImports,
 	}
 	for k, v := range config.CustomMainProcessors {
 		if v == nil {
@@ -92,3 +141,19 @@ func newMainProcessor(config Config) processor.Processor {
 	}
 	return mp
 }
+
+func newURLRoutedProcessor(config Config) processor.Processor {
+	rp := make(processor.URLRoutedProcessor, 0, len(config.URLRoutes)+1)
+	for _, route := range config.URLRoutes {
+		rp = append(rp, processor.URLRoute{
+			Matcher:   route.Matcher,
+			Processor: NewComprehensiveProcessor(route.Config),
+		})
+	}
+	config.URLRoutes = nil
+	rp = append(rp, processor.URLRoute{
+		Matcher:   nil, // Any URL.
+		Processor: NewComprehensiveProcessor(config),
+	})
+	return rp
+}
@@ -32,5 +32,10 @@ resources, before and after the main processors respectively. Some of them
 are considered to be essential and always included. The caller can specify
 additional preprocessors and postprocessors via Config; they are run after
 the essential ones.
+
+Before all of these, a ComprehensiveProcessor decodes the payload from the
+content-codings (e.g. gzip) indicated in the Content-Encoding header, so the
+other processors always see the plain content. Optionally, it can encode
+the payload again after all of the postprocessors; see Config.ContentEncoding.
 */
 package complexproc
@@ -18,6 +18,7 @@ import (
 	"github.com/google/webpackager/processor/complexproc"
 	"github.com/google/webpackager/processor/htmlproc"
 	"github.com/google/webpackager/processor/htmlproc/htmltask"
+	"github.com/google/webpackager/urlmatcher"
 )
 
 // This example constructs a new Processor that runs a custom HTMLTask and
@@ -36,3 +37,34 @@ func Example_customize() {
 	// Create the ComprehensiveProcessor.
 	_ = complexproc.NewComprehensiveProcessor(config)
 }
+
+// This example constructs a new Processor that preloads more aggressively
+// for the blog and does not preload anything from the HTML markup for the
+// checkout pages.
+func Example_urlRoutes() {
+	var blog []htmltask.HTMLTask
+	blog = append(blog, htmltask.ConservativeTaskSet...)
+	blog = append(blog, htmltask.PreloadStylesheets())
+	blog = append(blog, htmltask.PreloadScriptsWithIntegrity())
+
+	config := complexproc.Config{
+		URLRoutes: []complexproc.URLRoute{
+			{
+				Matcher: urlmatcher.HasEscapedPathPrefix("/blog/"),
+				Config: complexproc.Config{
+					HTML: htmlproc.Config{TaskSet: blog},
+				},
+			},
+			{
+				Matcher: urlmatcher.HasEscapedPathPrefix("/checkout/"),
+				Config: complexproc.Config{
+					HTML: htmlproc.Config{
+						TaskSet: []htmltask.HTMLTask{htmltask.ExtractSubContentTypes()},
+					},
+				},
+			},
+		},
+	}
+
+	_ = complexproc.NewComprehensiveProcessor(config)
+}
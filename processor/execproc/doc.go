@@ -0,0 +1,56 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package execproc implements a processor running an external executable,
+which allows you to write processors in any programming language.
+
+Protocol
+
+The processor runs the executable once for each exchange.Response. It sends
+a JSON object describing the response to the standard input, then closes the
+standard input. The object has the following fields:
+
+	{
+	  "url":       "https://example.com/index.html",
+	  "status":    200,
+	  "header":    {"Content-Type": ["text/html; charset=utf-8"]},
+	  "payload":   "PCFkb2N0eXBlIGh0bWw+...",
+	  "preloads":  ["<https://example.com/style.css>;rel=\"preload\";as=\"style\""],
+	  "extraData": {"Webpackager-Sub-Content-Type": ["application/javascript"]}
+	}
+
+"url" is the request URL. "status" is the HTTP status code. "header" and
+"extraData" map names to lists of values, like http.Header. "payload" is the
+response body encoded in base64. "preloads" is a list of the preload links
+in the Link header syntax.
+
+The executable writes a JSON object to the standard output, then exits with
+status 0. The object may contain "status", "header", "payload", "preloads",
+and "extraData", in the same format as above, to replace the corresponding
+parts of the response. The parts not present in the object (or set to null)
+are kept unchanged; thus "{}" is a valid output making no changes. The
+preload links must have rel="preload" or rel="modulepreload", and relative
+URLs are resolved against the request URL.
+
+The executable can report an error by writing an object with "error":
+
+	{"error": "unsupported markup"}
+
+The processor fails with the error message in that case. The processor also
+fails when the executable exits with a nonzero status, in which case the
+standard error output is included in the error message, or when it does not
+exit within the timeout, in which case it is killed.
+*/
+package execproc
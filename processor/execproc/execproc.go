@@ -0,0 +1,283 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execproc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/processor"
+	"github.com/google/webpackager/resource/httplink"
+	"github.com/google/webpackager/resource/preload"
+)
+
+const (
+	// DefaultTimeout is the default value for Config.Timeout.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxPayloadSize is the default value for Config.MaxPayloadSize.
+	DefaultMaxPayloadSize = 4194304 // 4 MiB
+
+	// maxStderrSize is the maximum size of the standard error output
+	// included in error messages.
+	maxStderrSize = 1024
+)
+
+// Config configures NewExecProcessor.
+type Config struct {
+	// Command is the path to the executable. Command may not be empty.
+	Command string
+
+	// Args is the command-line arguments to pass to the executable, not
+	// including the command name.
+	Args []string
+
+	// Timeout is the maximum duration to wait for the executable to exit.
+	// Zero implies DefaultTimeout.
+	Timeout time.Duration
+
+	// MaxPayloadSize is the maximum size of the payload in bytes, both
+	// sent to and received from the executable. Zero implies
+	// DefaultMaxPayloadSize; a negative value sets no limit.
+	MaxPayloadSize int
+}
+
+// NewExecProcessor creates and initializes a new processor running the
+// executable specified in config. See the package document for the protocol
+// between the processor and the executable. NewExecProcessor panics if
+// config.Command is empty.
+func NewExecProcessor(config Config) processor.Processor {
+	if config.Command == "" {
+		panic("Command can't be empty")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxPayloadSize == 0 {
+		config.MaxPayloadSize = DefaultMaxPayloadSize
+	}
+	return &execProcessor{config}
+}
+
+type execProcessor struct {
+	Config
+}
+
+type request struct {
+	URL       string      `json:"url"`
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Payload   []byte      `json:"payload"`
+	Preloads  []string    `json:"preloads"`
+	ExtraData http.Header `json:"extraData"`
+}
+
+type response struct {
+	Status    *int        `json:"status"`
+	Header    http.Header `json:"header"`
+	Payload   *[]byte     `json:"payload"`
+	Preloads  *[]string   `json:"preloads"`
+	ExtraData http.Header `json:"extraData"`
+	Error     string      `json:"error"`
+}
+
+func (ep *execProcessor) Process(resp *exchange.Response) error {
+	if err := ep.run(resp); err != nil {
+		return fmt.Errorf("plugin %s: %w", filepath.Base(ep.Command), err)
+	}
+	return nil
+}
+
+func (ep *execProcessor) run(resp *exchange.Response) error {
+	if ep.MaxPayloadSize >= 0 && len(resp.Payload) > ep.MaxPayloadSize {
+		return fmt.Errorf("oversized content (%d bytes; limit: %d bytes)",
+			len(resp.Payload), ep.MaxPayloadSize)
+	}
+	input, err := json.Marshal(newRequest(resp))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ep.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ep.Command, ep.Args...)
+	stdout := &limitedBuffer{limit: ep.maxOutputSize()}
+	stderr := &limitedBuffer{limit: maxStderrSize}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v", ep.Timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	if stdout.overflow {
+		return errors.New("oversized output")
+	}
+
+	var output response
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return fmt.Errorf("malformed output: %v", err)
+	}
+	return ep.apply(resp, &output)
+}
+
+// maxOutputSize returns the maximum size of the standard output, which is
+// large enough for the base64-encoded payload plus other fields.
+func (ep *execProcessor) maxOutputSize() int {
+	if ep.MaxPayloadSize < 0 {
+		return -1
+	}
+	return ep.MaxPayloadSize*2 + 1048576
+}
+
+func newRequest(resp *exchange.Response) *request {
+	preloads := make([]string, len(resp.Preloads))
+	for i, p := range resp.Preloads {
+		preloads[i] = p.Link.String()
+	}
+	return &request{
+		URL:       resp.Request.URL.String(),
+		Status:    resp.StatusCode,
+		Header:    resp.Header,
+		Payload:   resp.Payload,
+		Preloads:  preloads,
+		ExtraData: resp.ExtraData,
+	}
+}
+
+func (ep *execProcessor) apply(resp *exchange.Response, output *response) error {
+	if output.Error != "" {
+		return errors.New(output.Error)
+	}
+
+	if output.Status != nil {
+		if *output.Status < 100 || *output.Status > 599 {
+			return fmt.Errorf("invalid status %d", *output.Status)
+		}
+	}
+	if output.Payload != nil {
+		size := len(*output.Payload)
+		if ep.MaxPayloadSize >= 0 && size > ep.MaxPayloadSize {
+			return fmt.Errorf("oversized output content (%d bytes; limit: %d bytes)",
+				size, ep.MaxPayloadSize)
+		}
+	}
+	var preloads []*preload.Preload
+	if output.Preloads != nil {
+		var err error
+		preloads, err = parsePreloads(resp, *output.Preloads)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Apply the changes only after all of them are validated.
+	if output.Status != nil {
+		resp.StatusCode = *output.Status
+		resp.Status = fmt.Sprintf("%d %s", *output.Status, http.StatusText(*output.Status))
+	}
+	if output.Header != nil {
+		resp.Header = canonicalHeader(output.Header)
+	}
+	if output.Payload != nil {
+		resp.Payload = *output.Payload
+	}
+	if output.Preloads != nil {
+		resp.Preloads = preloads
+	}
+	if output.ExtraData != nil {
+		resp.ExtraData = canonicalHeader(output.ExtraData)
+	}
+	return nil
+}
+
+// parsePreloads parses values into Preloads. It reuses the Preloads already
+// in resp.Preloads when their Links are equal to keep the data not
+// represented in the Link header (e.g. Integrity).
+func parsePreloads(resp *exchange.Response, values []string) ([]*preload.Preload, error) {
+	var preloads []*preload.Preload
+	for _, value := range values {
+		links, err := httplink.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preload %q: %v", value, err)
+		}
+		for _, link := range links {
+			if !link.IsPreload() {
+				return nil, fmt.Errorf("invalid preload %q: not rel=preload", value)
+			}
+			link.URL = resp.Request.URL.ResolveReference(link.URL)
+			p := findPreload(resp.Preloads, link)
+			if p == nil {
+				p = preload.NewPreloadForLink(link)
+			}
+			preloads = append(preloads, p)
+		}
+	}
+	return preloads, nil
+}
+
+func findPreload(preloads []*preload.Preload, link *httplink.Link) *preload.Preload {
+	for _, p := range preloads {
+		if p.Link.Equal(link) {
+			return p
+		}
+	}
+	return nil
+}
+
+func canonicalHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for key, values := range h {
+		for _, value := range values {
+			c.Add(key, value)
+		}
+	}
+	return c
+}
+
+// limitedBuffer is a bytes.Buffer which stops growing at limit bytes. It
+// keeps accepting writes beyond the limit, just discarding them, so the
+// writer is not blocked.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int // Negative for no limit.
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit >= 0 && b.Len()+len(p) > b.limit {
+		p = p[:b.limit-b.Len()]
+		b.overflow = true
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package execproc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor/execproc"
+	"github.com/google/webpackager/resource/preload"
+	"github.com/google/webpackager/resource/preload/preloadtest"
+)
+
+// TestHelperProcess is not a real test. It is the plugin executable run by
+// the other tests, which invoke the test binary with "--" and the mode.
+func TestHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return
+	}
+
+	var input map[string]interface{}
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	switch args[1] {
+	case "echo":
+		json.NewEncoder(os.Stdout).Encode(input)
+	case "nop":
+		fmt.Print(`{}`)
+	case "modify":
+		payload, _ := json.Marshal(bytes.ToUpper([]byte(`<p>Hello, plugin!</p>`)))
+		fmt.Printf(`{
+			"status": 203,
+			"header": {"content-type": ["text/html"], "x-plugin": ["yes"]},
+			"payload": %s,
+			"preloads": [
+				"<https://example.com/style.css>;rel=\"preload\";as=\"style\"",
+				"</app.mjs>;rel=\"modulepreload\""
+			],
+			"extraData": {"X-Input-Url": [%q]}
+		}`, payload, input["url"])
+	case "error":
+		fmt.Print(`{"error": "unsupported markup"}`)
+	case "exit":
+		fmt.Fprint(os.Stderr, "something went wrong")
+		os.Exit(3)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	case "garbage":
+		fmt.Print(`<html>`)
+	case "big":
+		payload, _ := json.Marshal(bytes.Repeat([]byte("x"), 100))
+		fmt.Printf(`{"payload": %s}`, payload)
+	case "badpreload":
+		fmt.Print(`{"preloads": ["<https://example.com/>;rel=\"stylesheet\""]}`)
+	}
+	os.Exit(0)
+}
+
+func helperConfig(mode string, config execproc.Config) execproc.Config {
+	config.Command = os.Args[0]
+	config.Args = []string{"-test.run=TestHelperProcess", "--", mode}
+	return config
+}
+
+func makeResponse() *exchange.Response {
+	resp := exchangetest.MakeResponse(
+		"https://example.com/index.html",
+		"HTTP/1.1 200 OK\r\n"+
+			"Content-Type: text/html; charset=utf-8\r\n"+
+			"\r\n"+
+			"<p>Hello, plugin!</p>")
+	resp.AddPreload(preloadtest.NewPreloadForRawURL("https://example.com/style.css", preload.AsStyle))
+	resp.Preloads[0].Integrity = "sha256-dummy"
+	return resp
+}
+
+func TestExecProcessor_Echo(t *testing.T) {
+	resp := makeResponse()
+	want := makeResponse()
+
+	proc := execproc.NewExecProcessor(helperConfig("echo", execproc.Config{}))
+	if err := proc.Process(resp); err != nil {
+		t.Fatalf("got error(%q), want success", err)
+	}
+	if resp.StatusCode != want.StatusCode {
+		t.Errorf("resp.StatusCode = %v, want %v", resp.StatusCode, want.StatusCode)
+	}
+	if diff := cmp.Diff(want.Header, resp.Header); diff != "" {
+		t.Errorf("resp.Header mismatch (-want +got):\n%s", diff)
+	}
+	if !bytes.Equal(resp.Payload, want.Payload) {
+		t.Errorf("resp.Payload = %q, want %q", resp.Payload, want.Payload)
+	}
+	if diff := cmp.Diff(want.Preloads, resp.Preloads); diff != "" {
+		t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecProcessor_Nop(t *testing.T) {
+	resp := makeResponse()
+	want := makeResponse()
+
+	proc := execproc.NewExecProcessor(helperConfig("nop", execproc.Config{}))
+	if err := proc.Process(resp); err != nil {
+		t.Fatalf("got error(%q), want success", err)
+	}
+	if diff := cmp.Diff(want.Header, resp.Header); diff != "" {
+		t.Errorf("resp.Header mismatch (-want +got):\n%s", diff)
+	}
+	if !bytes.Equal(resp.Payload, want.Payload) {
+		t.Errorf("resp.Payload = %q, want %q", resp.Payload, want.Payload)
+	}
+}
+
+func TestExecProcessor_Modify(t *testing.T) {
+	resp := makeResponse()
+
+	proc := execproc.NewExecProcessor(helperConfig("modify", execproc.Config{}))
+	if err := proc.Process(resp); err != nil {
+		t.Fatalf("got error(%q), want success", err)
+	}
+
+	if resp.StatusCode != 203 {
+		t.Errorf("resp.StatusCode = %v, want 203", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Plugin"); got != "yes" {
+		t.Errorf(`resp.Header.Get("X-Plugin") = %q, want "yes"`, got)
+	}
+	if got, want := string(resp.Payload), "<P>HELLO, PLUGIN!</P>"; got != want {
+		t.Errorf("resp.Payload = %q, want %q", got, want)
+	}
+	if got, want := resp.ExtraData.Get("X-Input-Url"), "https://example.com/index.html"; got != want {
+		t.Errorf(`resp.ExtraData.Get("X-Input-Url") = %q, want %q`, got, want)
+	}
+
+	wantPreloads := []*preload.Preload{
+		preloadtest.NewPreloadForRawLink(`<https://example.com/style.css>;rel="preload";as="style"`),
+		preloadtest.NewPreloadForRawLink(`<https://example.com/app.mjs>;rel="modulepreload"`),
+	}
+	wantPreloads[0].Integrity = "sha256-dummy" // Kept from the original.
+	if diff := cmp.Diff(wantPreloads, resp.Preloads); diff != "" {
+		t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecProcessor_Error(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		config execproc.Config
+		want   string
+	}{
+		{
+			name: "ErrorField",
+			mode: "error",
+			want: "unsupported markup",
+		},
+		{
+			name: "ExitStatus",
+			mode: "exit",
+			want: "something went wrong",
+		},
+		{
+			name:   "Timeout",
+			mode:   "sleep",
+			config: execproc.Config{Timeout: 500 * time.Millisecond},
+			want:   "timed out",
+		},
+		{
+			name: "MalformedOutput",
+			mode: "garbage",
+			want: "malformed output",
+		},
+		{
+			name:   "OversizedInput",
+			mode:   "nop",
+			config: execproc.Config{MaxPayloadSize: 10},
+			want:   "oversized content",
+		},
+		{
+			name:   "OversizedOutput",
+			mode:   "big",
+			config: execproc.Config{MaxPayloadSize: 50},
+			want:   "oversized output content",
+		},
+		{
+			name: "NotPreload",
+			mode: "badpreload",
+			want: "not rel=preload",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeResponse()
+			want := makeResponse()
+
+			proc := execproc.NewExecProcessor(helperConfig(test.mode, test.config))
+			err := proc.Process(resp)
+			if err == nil {
+				t.Fatalf("got success, want error")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error(%q), want error containing %q", err, test.want)
+			}
+			if !bytes.Equal(resp.Payload, want.Payload) {
+				t.Errorf("resp.Payload = %q, want %q", resp.Payload, want.Payload)
+			}
+		})
+	}
+}
+
+func TestExecProcessor_CommandNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	proc := execproc.NewExecProcessor(execproc.Config{Command: dir + "/missing"})
+	if err := proc.Process(makeResponse()); err == nil {
+		t.Errorf("got success, want error")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmlproc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/webpackager/processor/htmlproc/htmldoc"
+	"github.com/google/webpackager/processor/htmlproc/htmltask"
+	"github.com/google/webpackager/resource/httplink"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pquerna/cachecontrol/cacheobject"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// AMPProfile specifies how the HTML processor handles AMP documents. See
+// docs/amp_cache_differences.md for the background.
+type AMPProfile int
+
+const (
+	// AMPIgnore processes AMP documents just like other HTML documents.
+	AMPIgnore AMPProfile = iota
+
+	// AMPSkip refuses AMP documents with ErrAMPSkipped, so they will not
+	// be turned into signed exchanges.
+	AMPSkip
+
+	// AMPStrict requires AMP documents to meet the AMP SXG requirements
+	// and reports an error for each requirement not met. The requirements
+	// checked are:
+	//
+	//   - the document is transformed (e.g. by AMP Optimizer);
+	//   - every <link rel="preload"> has the data-sxg-no-header attribute;
+	//   - Cache-Control has max-age of at least MinAMPMaxAge seconds.
+	AMPStrict
+)
+
+// MinAMPMaxAge is the minimum max-age (in seconds) in Cache-Control required
+// for AMP documents under AMPStrict.
+const MinAMPMaxAge = 345600 // 4 days
+
+// ErrAMPSkipped is returned by the HTML processor for AMP documents when
+// Config.AMP is set to AMPSkip.
+var ErrAMPSkipped = errors.New("htmlproc: AMP document not signed")
+
+var ampProfileNames = map[AMPProfile]string{
+	AMPIgnore: "ignore",
+	AMPSkip:   "skip",
+	AMPStrict: "strict",
+}
+
+// ParseAMPProfile parses s into an AMPProfile. s is one of "ignore", "skip",
+// and "strict", case-insensitive.
+func ParseAMPProfile(s string) (AMPProfile, error) {
+	for p, name := range ampProfileNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return AMPIgnore, fmt.Errorf("unknown AMP profile %q", s)
+}
+
+// String returns the name of p, as accepted by ParseAMPProfile.
+func (p AMPProfile) String() string {
+	if name, ok := ampProfileNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("AMPProfile(%d)", int(p))
+}
+
+func checkAMPRequirements(resp *htmldoc.HTMLResponse) error {
+	var errs *multierror.Error
+
+	if !resp.Doc.IsTransformedAMP() {
+		errs = multierror.Append(errs, errors.New(
+			"AMP: document is not transformed (run AMP Optimizer)"))
+	}
+
+	err := htmldoc.Traverse(resp.Doc.Root, func(n *html.Node) error {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Link {
+			return nil
+		}
+		rel := htmldoc.GetAttr(n, "rel")
+		if !hasLinkType(rel, httplink.RelPreload) && !hasLinkType(rel, httplink.RelModulePreload) {
+			return nil
+		}
+		if htmldoc.FindAttr(n, htmltask.NoHeaderAttr) == nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"AMP: <link rel=preload href=%q> lacks %s",
+				htmldoc.GetAttr(n, "href"), htmltask.NoHeaderAttr))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := checkAMPMaxAge(resp.Header.Get("Cache-Control")); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func checkAMPMaxAge(cacheControl string) error {
+	cc, err := cacheobject.ParseResponseCacheControl(cacheControl)
+	if err != nil {
+		return fmt.Errorf("AMP: invalid Cache-Control %q: %v", cacheControl, err)
+	}
+	if cc.MaxAge < MinAMPMaxAge {
+		return fmt.Errorf("AMP: Cache-Control max-age must be at least %d",
+			MinAMPMaxAge)
+	}
+	return nil
+}
+
+func hasLinkType(rel, linkType string) bool {
+	for _, v := range strings.Fields(rel) {
+		if strings.EqualFold(v, linkType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmlproc_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor/htmlproc"
+)
+
+func makeResponseWithCacheControl(url, cacheControl, html string) *exchange.Response {
+	resp := fmt.Sprint(
+		"HTTP/1.1 200 OK\r\n",
+		"Cache-Control: ", cacheControl, "\r\n",
+		"Content-Length: ", len(html), "\r\n",
+		"Content-Type: text/html;charset=utf-8\r\n",
+		"\r\n",
+		html)
+	return exchangetest.MakeResponse(url, resp)
+}
+
+func TestHTMLProcessor_AMPSuccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      htmlproc.AMPProfile
+		cacheControl string
+		html         string
+	}{
+		{
+			name:         "Ignore_AMP",
+			profile:      htmlproc.AMPIgnore,
+			cacheControl: "public, max-age=604800",
+			html:         `<!doctype html><html ⚡><link rel="preload" href="a.css" as="style">`,
+		},
+		{
+			name:         "Skip_NonAMP",
+			profile:      htmlproc.AMPSkip,
+			cacheControl: "public, max-age=604800",
+			html:         `<!doctype html><html><p>Hello, world.</p>`,
+		},
+		{
+			name:         "Strict_NonAMP",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public, max-age=60",
+			html:         `<!doctype html><html><link rel="preload" href="a.css" as="style">`,
+		},
+		{
+			name:         "Strict_Compliant",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public, max-age=345600",
+			html: `<!doctype html><html ⚡ transformed="self;v=1">` +
+				`<link rel="preload" href="a.css" as="style" data-sxg-no-header>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc := htmlproc.NewHTMLProcessor(htmlproc.Config{AMP: test.profile})
+			resp := makeResponseWithCacheControl(
+				"https://example.com/test.html", test.cacheControl, test.html)
+			if err := proc.Process(resp); err != nil {
+				t.Errorf("got error(%q), want success", err)
+			}
+		})
+	}
+}
+
+func TestHTMLProcessor_AMPError(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      htmlproc.AMPProfile
+		cacheControl string
+		html         string
+	}{
+		{
+			name:         "Skip_AMP",
+			profile:      htmlproc.AMPSkip,
+			cacheControl: "public, max-age=604800",
+			html:         `<!doctype html><html amp><p>Hello, world.</p>`,
+		},
+		{
+			name:         "Strict_NotTransformed",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public, max-age=345600",
+			html:         `<!doctype html><html ⚡><p>Hello, world.</p>`,
+		},
+		{
+			name:         "Strict_PreloadHeader",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public, max-age=345600",
+			html: `<!doctype html><html ⚡ transformed="self;v=1">` +
+				`<link rel="preload" href="a.css" as="style">`,
+		},
+		{
+			name:         "Strict_ShortMaxAge",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public, max-age=345599",
+			html:         `<!doctype html><html ⚡ transformed="self;v=1">`,
+		},
+		{
+			name:         "Strict_NoMaxAge",
+			profile:      htmlproc.AMPStrict,
+			cacheControl: "public",
+			html:         `<!doctype html><html ⚡ transformed="self;v=1">`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc := htmlproc.NewHTMLProcessor(htmlproc.Config{AMP: test.profile})
+			resp := makeResponseWithCacheControl(
+				"https://example.com/test.html", test.cacheControl, test.html)
+			if err := proc.Process(resp); err == nil {
+				t.Error("got success, want error")
+			}
+		})
+	}
+}
+
+func TestParseAMPProfile(t *testing.T) {
+	tests := []struct {
+		input string
+		want  htmlproc.AMPProfile
+	}{
+		{"ignore", htmlproc.AMPIgnore},
+		{"skip", htmlproc.AMPSkip},
+		{"Strict", htmlproc.AMPStrict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := htmlproc.ParseAMPProfile(test.input)
+			if err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got != test.want {
+				t.Errorf("ParseAMPProfile(%q) = %v, want %v", test.input, got, test.want)
+			}
+		})
+	}
+
+	if _, err := htmlproc.ParseAMPProfile("unknown"); err == nil {
+		t.Error("ParseAMPProfile(\"unknown\") = success, want error")
+	}
+}
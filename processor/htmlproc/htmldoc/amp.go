@@ -0,0 +1,40 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmldoc
+
+import (
+	"golang.org/x/net/html/atom"
+)
+
+// IsAMP reports whether doc is an AMP document, namely whether its <html>
+// element has the "⚡" or "amp" attribute.
+func (doc *Document) IsAMP() bool {
+	n := FindNode(doc.Root, atom.Html)
+	if n == nil {
+		return false
+	}
+	return FindAttr(n, "⚡") != nil || FindAttr(n, "amp") != nil
+}
+
+// IsTransformedAMP reports whether doc is an AMP document transformed by
+// AMP Optimizer (or an equivalent tool), namely whether its <html> element
+// has the "transformed" attribute in addition to the AMP attribute.
+func (doc *Document) IsTransformedAMP() bool {
+	if !doc.IsAMP() {
+		return false
+	}
+	n := FindNode(doc.Root, atom.Html)
+	return FindAttr(n, "transformed") != nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmldoc_test
+
+import (
+	"testing"
+
+	"github.com/google/webpackager/internal/urlutil"
+	"github.com/google/webpackager/processor/htmlproc/htmldoc"
+)
+
+func TestIsAMP(t *testing.T) {
+	tests := []struct {
+		name            string
+		html            string
+		wantAMP         bool
+		wantTransformed bool
+	}{
+		{
+			name:            "Lightning",
+			html:            `<!doctype html><html ⚡><title>test</title></html>`,
+			wantAMP:         true,
+			wantTransformed: false,
+		},
+		{
+			name:            "AMP",
+			html:            `<!doctype html><html amp lang="en"><title>test</title></html>`,
+			wantAMP:         true,
+			wantTransformed: false,
+		},
+		{
+			name:            "Transformed",
+			html:            `<!doctype html><html ⚡ transformed="self;v=1"><title>test</title></html>`,
+			wantAMP:         true,
+			wantTransformed: true,
+		},
+		{
+			name:            "NonAMP",
+			html:            `<!doctype html><html lang="en"><title>test</title></html>`,
+			wantAMP:         false,
+			wantTransformed: false,
+		},
+		{
+			name:            "NonAMPTransformed",
+			html:            `<!doctype html><html transformed="self;v=1"><title>test</title></html>`,
+			wantAMP:         false,
+			wantTransformed: false,
+		},
+		{
+			name:            "AMPElsewhere",
+			html:            `<!doctype html><html><body amp>test</body></html>`,
+			wantAMP:         false,
+			wantTransformed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := urlutil.MustParse("https://dummy.test/amp.html")
+			doc, err := htmldoc.NewDocument([]byte(test.html), u)
+			if err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got := doc.IsAMP(); got != test.wantAMP {
+				t.Errorf("doc.IsAMP() = %v, want %v", got, test.wantAMP)
+			}
+			if got := doc.IsTransformedAMP(); got != test.wantTransformed {
+				t.Errorf("doc.IsTransformedAMP() = %v, want %v", got, test.wantTransformed)
+			}
+		})
+	}
+}
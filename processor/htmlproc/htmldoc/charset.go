@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmldoc
+
+import (
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// CharsetUTF8 is the canonical name of UTF-8 encoding.
+const CharsetUTF8 = "utf-8"
+
+// DecodePayload converts payload into UTF-8. It determines the character
+// encoding of payload from the byte order mark, the charset parameter in
+// contentType, and <meta> elements in this order, and falls back to
+// windows-1252 unless payload is valid UTF-8, as HTML user agents would
+// do. DecodePayload returns the converted payload along with the canonical
+// name of the original encoding (e.g. "shift_jis"). The byte order mark is
+// removed from the returned payload.
+func DecodePayload(payload []byte, contentType string) ([]byte, string, error) {
+	e, name, _ := charset.DetermineEncoding(payload, contentType)
+	if name != CharsetUTF8 {
+		decoded, err := e.NewDecoder().Bytes(payload)
+		if err != nil {
+			return nil, "", err
+		}
+		payload = decoded
+	}
+	return []byte(strings.TrimPrefix(string(payload), "\ufeff")), name, nil
+}
+
+// DeclareUTF8 rewrites the charset parameter in the Content-Type header and
+// the charset declarations in <meta> elements to UTF-8, then sets Charset
+// to CharsetUTF8. The caller needs to serialize Doc into resp.Payload to
+// keep the payload consistent with the declaration. DeclareUTF8 is a no-op
+// when Charset is already CharsetUTF8.
+func (resp *HTMLResponse) DeclareUTF8() error {
+	if resp.Charset == CharsetUTF8 {
+		return nil
+	}
+
+	mediaType, params := "text/html", map[string]string{}
+	if value := resp.Header.Get("Content-Type"); value != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(value)
+		if err != nil {
+			return err
+		}
+	}
+	params["charset"] = CharsetUTF8
+	resp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+
+	Traverse(resp.Doc.Root, func(n *html.Node) error {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Meta {
+			return nil
+		}
+		isPragma := strings.EqualFold(GetAttr(n, "http-equiv"), "content-type")
+		for i := range n.Attr {
+			a := &n.Attr[i]
+			if a.Namespace != "" {
+				continue
+			}
+			switch {
+			case strings.EqualFold(a.Key, "charset"):
+				a.Val = CharsetUTF8
+			case strings.EqualFold(a.Key, "content") && isPragma:
+				a.Val = "text/html; charset=" + CharsetUTF8
+			}
+		}
+		return nil
+	})
+
+	resp.Charset = CharsetUTF8
+	return nil
+}
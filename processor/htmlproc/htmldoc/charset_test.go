@@ -0,0 +1,182 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmldoc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor/htmlproc/htmldoc"
+	"golang.org/x/net/html"
+)
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		contentType string
+		want        string
+		wantCharset string
+	}{
+		{
+			name:        "UTF8",
+			payload:     "<p>\xe3\x81\x93\xe3\x82\x93\xe3\x81\xab\xe3\x81\xa1\xe3\x81\xaf</p>",
+			contentType: "text/html; charset=utf-8",
+			want:        "<p>こんにちは</p>",
+			wantCharset: "utf-8",
+		},
+		{
+			name:        "ContentType",
+			payload:     "<p>\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd</p>",
+			contentType: "text/html; charset=Shift_JIS",
+			want:        "<p>こんにちは</p>",
+			wantCharset: "shift_jis",
+		},
+		{
+			name:        "MetaCharset",
+			payload:     "<meta charset=\"iso-8859-1\"><p>caf\xe9</p>",
+			contentType: "text/html",
+			want:        "<meta charset=\"iso-8859-1\"><p>café</p>",
+			wantCharset: "windows-1252",
+		},
+		{
+			name:        "MetaContent",
+			payload:     "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=euc-jp\"><p>\xa4\xb3\xa4\xf3</p>",
+			contentType: "text/html",
+			want:        "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=euc-jp\"><p>こん</p>",
+			wantCharset: "euc-jp",
+		},
+		{
+			name:        "ContentTypeOverMeta",
+			payload:     "<meta charset=\"shift_jis\"><p>caf\xc3\xa9</p>",
+			contentType: "text/html; charset=utf-8",
+			want:        "<meta charset=\"shift_jis\"><p>café</p>",
+			wantCharset: "utf-8",
+		},
+		{
+			name:        "BOM",
+			payload:     "\xef\xbb\xbf<p>caf\xc3\xa9</p>",
+			contentType: "text/html; charset=iso-8859-1",
+			want:        "<p>café</p>",
+			wantCharset: "utf-8",
+		},
+		{
+			name:        "UTF16BOM",
+			payload:     "\xff\xfe<\x00p\x00>\x00",
+			contentType: "text/html",
+			want:        "<p>",
+			wantCharset: "utf-16le",
+		},
+		{
+			name:        "NoDeclaration",
+			payload:     "<p>caf\xe9</p>",
+			contentType: "text/html",
+			want:        "<p>café</p>",
+			wantCharset: "windows-1252",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, charset, err := htmldoc.DecodePayload([]byte(test.payload), test.contentType)
+			if err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("payload = %q, want %q", got, test.want)
+			}
+			if charset != test.wantCharset {
+				t.Errorf("charset = %q, want %q", charset, test.wantCharset)
+			}
+		})
+	}
+}
+
+func TestDeclareUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		html        string
+		wantType    string
+		wantHTML    string
+	}{
+		{
+			name:        "ContentType",
+			contentType: "text/html;charset=shift_jis",
+			html:        `<!doctype html><title>test</title>`,
+			wantType:    "text/html; charset=utf-8",
+			wantHTML:    `<!DOCTYPE html><html><head><title>test</title></head><body></body></html>`,
+		},
+		{
+			name:        "MetaCharset",
+			contentType: "",
+			html:        `<!doctype html><meta charset="shift_jis"><title>test</title>`,
+			wantType:    "text/html; charset=utf-8",
+			wantHTML:    `<!DOCTYPE html><html><head><meta charset="utf-8"/><title>test</title></head><body></body></html>`,
+		},
+		{
+			name:        "MetaContent",
+			contentType: "text/html",
+			html:        `<!doctype html><meta http-equiv="content-type" content="text/html; charset=shift_jis"><title>test</title>`,
+			wantType:    "text/html; charset=utf-8",
+			wantHTML:    `<!DOCTYPE html><html><head><meta http-equiv="content-type" content="text/html; charset=utf-8"/><title>test</title></head><body></body></html>`,
+		},
+		{
+			name:        "AlreadyUTF8",
+			contentType: "text/html;charset=UTF-8",
+			html:        `<!doctype html><meta charset="UTF-8"><title>test</title>`,
+			wantType:    "text/html;charset=UTF-8",
+			wantHTML:    `<!DOCTYPE html><html><head><meta charset="UTF-8"/><title>test</title></head><body></body></html>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := ""
+			if test.contentType != "" {
+				header = fmt.Sprintf("Content-Type: %s\r\n", test.contentType)
+			}
+			resp, err := htmldoc.NewHTMLResponse(exchangetest.MakeResponse(
+				"https://example.com/test.html",
+				"HTTP/1.1 200 OK\r\n"+header+"\r\n"+test.html))
+			if err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+
+			if err := resp.DeclareUTF8(); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got := resp.Header.Get("Content-Type"); got != test.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, test.wantType)
+			}
+			if resp.Charset != htmldoc.CharsetUTF8 {
+				t.Errorf("resp.Charset = %q, want %q", resp.Charset, htmldoc.CharsetUTF8)
+			}
+			if got := render(t, resp.Doc.Root); got != test.wantHTML {
+				t.Errorf("html = %q, want %q", got, test.wantHTML)
+			}
+		})
+	}
+}
+
+func render(t *testing.T, n *html.Node) string {
+	var b strings.Builder
+	if err := html.Render(&b, n); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
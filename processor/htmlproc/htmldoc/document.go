@@ -45,6 +45,8 @@ type Document struct {
 }
 
 // NewDocument creates and initializes a new Document from payload and url.
+// payload must be encoded in UTF-8; use DecodePayload to convert documents
+// in other encodings.
 func NewDocument(payload []byte, url *url.URL) (*Document, error) {
 	root, err := html.Parse(bytes.NewReader(payload))
 	if err != nil {
@@ -22,13 +22,23 @@ import (
 type HTMLResponse struct {
 	*exchange.Response
 	Doc *Document
+
+	// Charset is the canonical name of the character encoding of the
+	// payload (e.g. "utf-8" or "shift_jis"). Doc is always parsed from the
+	// payload converted into UTF-8. See DecodePayload for how the encoding
+	// is determined.
+	Charset string
 }
 
 // NewHTMLResponse creates and initializes a new HTMLResponse.
 func NewHTMLResponse(resp *exchange.Response) (*HTMLResponse, error) {
-	doc, err := NewDocument(resp.Payload, resp.Request.URL)
+	payload, charset, err := DecodePayload(resp.Payload, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := NewDocument(payload, resp.Request.URL)
 	if err != nil {
 		return nil, err
 	}
-	return &HTMLResponse{resp, doc}, nil
+	return &HTMLResponse{resp, doc, charset}, nil
 }
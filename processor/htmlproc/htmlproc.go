@@ -36,10 +36,19 @@ type Config struct {
 	//
 	// When ModifyHTML is true, the processor always rewrites the payload
 	// with HTML reconstructed from the parse tree. The response thus always
-	// contains a well-formed HTML after processing.
+	// contains a well-formed HTML after processing. The payload is always
+	// encoded in UTF-8; when the original document was in another encoding,
+	// the processor also rewrites the charset in the Content-Type header and
+	// <meta> elements to utf-8.
 	//
 	// Some HTMLTasks have an effect only when ModifyHTML is true.
 	ModifyHTML bool
+
+	// AMP specifies how to handle AMP documents (<html ⚡> or <html amp>).
+	//
+	// The zero value, AMPIgnore, processes AMP documents like any other
+	// HTML documents.
+	AMP AMPProfile
 }
 
 // NewHTMLProcessor creates and initializes a new Processor to process HTML
@@ -63,6 +72,17 @@ func (hp *htmlProcessor) Process(resp *exchange.Response) error {
 		return err
 	}
 
+	if htmlResp.Doc.IsAMP() {
+		switch hp.AMP {
+		case AMPSkip:
+			return ErrAMPSkipped
+		case AMPStrict:
+			if err := checkAMPRequirements(htmlResp); err != nil {
+				return err
+			}
+		}
+	}
+
 	for _, task := range hp.TaskSet {
 		if err := task.Run(htmlResp); err != nil {
 			return err
@@ -70,6 +90,9 @@ func (hp *htmlProcessor) Process(resp *exchange.Response) error {
 	}
 
 	if hp.ModifyHTML {
+		if err := htmlResp.DeclareUTF8(); err != nil {
+			return err
+		}
 		var payload bytes.Buffer
 		if err := html.Render(&payload, htmlResp.Doc.Root); err != nil {
 			return err
@@ -161,3 +161,63 @@ func TestHTMLProcessor_Error(t *testing.T) {
 		t.Errorf("called = %q, want %q", called, "Task1;Task2;")
 	}
 }
+
+func TestHTMLProcessor_Charset(t *testing.T) {
+	tests := []struct {
+		name        string
+		modifyHTML  bool
+		contentType string
+		html        string
+		wantType    string
+		wantPayload string
+		wantPreload *preload.Preload
+	}{
+		{
+			name:        "Keep",
+			modifyHTML:  false,
+			contentType: "text/html;charset=iso-8859-1",
+			html:        "<!doctype html><link rel=\"stylesheet\" href=\"caf\xe9.css\"><p>caf\xe9</p>",
+			wantType:    "text/html;charset=iso-8859-1",
+			wantPayload: "<!doctype html><link rel=\"stylesheet\" href=\"caf\xe9.css\"><p>caf\xe9</p>",
+			wantPreload: preloadtest.NewPreloadForRawLink(`<https://example.com/caf%C3%A9.css>;rel="preload";as="style"`),
+		},
+		{
+			name:        "Modify",
+			modifyHTML:  true,
+			contentType: "text/html;charset=iso-8859-1",
+			html:        "<!doctype html><link rel=\"stylesheet\" href=\"caf\xe9.css\"><p>caf\xe9</p>",
+			wantType:    "text/html; charset=utf-8",
+			wantPayload: "<!DOCTYPE html><html><head><link rel=\"stylesheet\" href=\"café.css\"/></head><body><p>café</p></body></html>",
+			wantPreload: preloadtest.NewPreloadForRawLink(`<https://example.com/caf%C3%A9.css>;rel="preload";as="style"`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc := htmlproc.NewHTMLProcessor(htmlproc.Config{
+				TaskSet:    htmltask.AggressiveTaskSet,
+				ModifyHTML: test.modifyHTML,
+			})
+			resp := exchangetest.MakeResponse(
+				"https://example.com/test.html",
+				fmt.Sprint(
+					"HTTP/1.1 200 OK\r\n",
+					"Content-Type: ", test.contentType, "\r\n",
+					"\r\n",
+					test.html))
+
+			if err := proc.Process(resp); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if got := resp.Header.Get("Content-Type"); got != test.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, test.wantType)
+			}
+			if got := string(resp.Payload); got != test.wantPayload {
+				t.Errorf("resp.Payload = %q, want %q", got, test.wantPayload)
+			}
+			if diff := cmp.Diff([]*preload.Preload{test.wantPreload}, resp.Preloads); diff != "" {
+				t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -22,19 +22,42 @@ import (
 	"golang.org/x/net/html/atom"
 )
 
+// NoHeaderAttr is the attribute to exclude <link rel="preload"> elements from
+// the Preloads field. It follows the convention among signed exchange tools
+// (see docs/amp_cache_differences.md).
+const NoHeaderAttr = "data-sxg-no-header"
+
 // ExtractPreloadTags detects <link rel="preload"> in the <head> element and
-// adds them to the Preloads field.
+// adds them to the Preloads field. Elements with the NoHeaderAttr attribute
+// (data-sxg-no-header) are excluded.
 func ExtractPreloadTags() HTMLTask {
 	return &extractPreloadTags{}
 }
 
-type extractPreloadTags struct{}
+// ExtractOptInPreloadTags is like ExtractPreloadTags, but only adds elements
+// that have the attr attribute (e.g. "data-sxg-preload"). This allows site
+// owners to control which preload links to promote from their templates.
+// NoHeaderAttr still takes the precedence: elements with both attributes are
+// excluded.
+func ExtractOptInPreloadTags(attr string) HTMLTask {
+	return &extractPreloadTags{attr}
+}
+
+type extractPreloadTags struct {
+	optInAttr string
+}
 
-func (*extractPreloadTags) Run(resp *htmldoc.HTMLResponse) error {
+func (task *extractPreloadTags) Run(resp *htmldoc.HTMLResponse) error {
 	return htmldoc.Traverse(resp.Doc.Root, func(n *html.Node) error {
 		if n.Type != html.ElementNode || n.DataAtom != atom.Link {
 			return nil
 		}
+		if htmldoc.FindAttr(n, NoHeaderAttr) != nil {
+			return nil
+		}
+		if task.optInAttr != "" && htmldoc.FindAttr(n, task.optInAttr) == nil {
+			return nil
+		}
 		href := resolveURLAttr(htmldoc.FindAttr(n, "href"), resp.Doc)
 		if href == nil {
 			return nil
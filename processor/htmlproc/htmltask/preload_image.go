@@ -0,0 +1,259 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmltask
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/webpackager/processor/htmlproc/htmldoc"
+	"github.com/google/webpackager/resource"
+	"github.com/google/webpackager/resource/httplink"
+	"github.com/google/webpackager/resource/preload"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultMaxLCPImages is the default value for MaxCount in LCPImageConfig.
+const DefaultMaxLCPImages = 1
+
+// LCPImageConfig holds parameters to PreloadLCPImages.
+type LCPImageConfig struct {
+	// MaxCount specifies the maximum number of images to preload for each
+	// document. Zero implies DefaultMaxLCPImages.
+	MaxCount int
+
+	// ByteBudget specifies the maximum total size of preloaded images for
+	// each document, in bytes. The size is measured by the packager from
+	// the payloads of the signed exchanges, after content-coding if any;
+	// images exceeding the budget are not preloaded.
+	// When an image has multiple sources (srcset), the largest one counts.
+	// Images failing to be signed are not preloaded either, since their size
+	// is unknown.
+	//
+	// Zero or negative implies no limit.
+	ByteBudget int
+}
+
+// PreloadLCPImages detects images likely to be the Largest Contentful Paint
+// (LCP) element and adds them to the Preloads field with as="image". It picks
+// the following images as candidates, in this order:
+//
+//   - <img> elements with fetchpriority="high";
+//   - the first <img> in the <body> element, unless some other element that
+//     renders non-trivial content (e.g. <video>) precedes it or it has
+//     loading="lazy";
+//   - background images specified in inline styles (style attribute).
+//
+// The srcset and sizes attributes are translated into the imagesrcset and
+// imagesizes parameters, and all image sources in srcset are packaged.
+// <img> elements inside <picture> are not supported and ignored.
+func PreloadLCPImages(config LCPImageConfig) HTMLTask {
+	if config.MaxCount == 0 {
+		config.MaxCount = DefaultMaxLCPImages
+	}
+	return &preloadLCPImages{config}
+}
+
+type preloadLCPImages struct {
+	LCPImageConfig
+}
+
+var cssBackgroundURL = regexp.MustCompile(
+	`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^'"\s)]*))\s*\)`)
+
+func (task *preloadLCPImages) Run(resp *htmldoc.HTMLResponse) error {
+	var candidates []*preload.Preload
+
+	htmldoc.Traverse(resp.Doc.Body, func(n *html.Node) error {
+		if isImage(n) && strings.EqualFold(htmldoc.GetAttr(n, "fetchpriority"), "high") {
+			candidates = appendCandidate(candidates, newImagePreload(resp, n))
+		}
+		return nil
+	})
+
+	htmldoc.Traverse(resp.Doc.Body, func(n *html.Node) error {
+		if n.Type != html.ElementNode {
+			return nil
+		}
+		if isImage(n) {
+			if !strings.EqualFold(htmldoc.GetAttr(n, "loading"), "lazy") {
+				candidates = appendCandidate(candidates, newImagePreload(resp, n))
+			}
+			return htmldoc.ErrStop
+		}
+		if skipElements[n.DataAtom] || n.DataAtom == atom.Script {
+			return htmldoc.ErrSkip
+		}
+		if stopElements[n.DataAtom] {
+			return htmldoc.ErrStop
+		}
+		return nil
+	})
+
+	htmldoc.Traverse(resp.Doc.Body, func(n *html.Node) error {
+		if n.Type != html.ElementNode {
+			return nil
+		}
+		if u := getBackgroundImage(resp.Doc, htmldoc.GetAttr(n, "style")); u != nil {
+			candidates = appendCandidate(candidates, preload.NewPreloadForURL(u, preload.AsImage))
+		}
+		return nil
+	})
+
+	if len(candidates) > task.MaxCount {
+		candidates = candidates[:task.MaxCount]
+	}
+
+	var budget *preload.Budget
+	if task.ByteBudget > 0 {
+		budget = preload.NewBudget(task.ByteBudget)
+	}
+	for _, p := range candidates {
+		p.Budget = budget
+		resp.AddPreload(p)
+	}
+
+	return nil
+}
+
+func isImage(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.DataAtom != atom.Img {
+		return false
+	}
+	return n.Parent == nil || n.Parent.DataAtom != atom.Picture
+}
+
+func appendCandidate(candidates []*preload.Preload, p *preload.Preload) []*preload.Preload {
+	if p == nil {
+		return candidates
+	}
+	for _, q := range candidates {
+		if p.Link.Equal(q.Link) {
+			return candidates
+		}
+	}
+	return append(candidates, p)
+}
+
+func newImagePreload(resp *htmldoc.HTMLResponse, n *html.Node) *preload.Preload {
+	var urls []*url.URL
+
+	src := resolveURLAttr(htmldoc.FindAttr(n, "src"), resp.Doc)
+	if isFetchableURL(src) {
+		urls = append(urls, src)
+	}
+
+	var srcset []string
+	for _, c := range parseSrcset(htmldoc.GetAttr(n, "srcset")) {
+		u := resolveURLAttr(&html.Attribute{Key: "srcset", Val: c.url}, resp.Doc)
+		if !isFetchableURL(u) {
+			return nil // Browsers may pick the unfetchable one.
+		}
+		urls = append(urls, u)
+		srcset = append(srcset, strings.TrimSpace(u.String()+" "+c.descriptor))
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	link := httplink.NewLink(urls[0], httplink.RelPreload)
+	link.Params.Set(httplink.ParamAs, preload.AsImage)
+	if len(srcset) != 0 {
+		link.Params.Set(httplink.ParamImageSrcset, strings.Join(srcset, ", "))
+		if a := htmldoc.FindAttr(n, "sizes"); a != nil {
+			link.Params.Set(httplink.ParamImageSizes, a.Val)
+		}
+	}
+	if a := htmldoc.FindAttr(n, "crossorigin"); a != nil {
+		link.Params.Set(httplink.ParamCrossOrigin, a.Val)
+	}
+
+	p := &preload.Preload{Link: link}
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			p.Resources = append(p.Resources, resource.NewResource(u))
+		}
+	}
+	return p
+}
+
+func getBackgroundImage(doc *htmldoc.Document, style string) *url.URL {
+	for _, decl := range strings.Split(style, ";") {
+		chunks := strings.SplitN(decl, ":", 2)
+		if len(chunks) != 2 {
+			continue
+		}
+		prop := strings.ToLower(strings.TrimSpace(chunks[0]))
+		if prop != "background" && prop != "background-image" {
+			continue
+		}
+		m := cssBackgroundURL.FindStringSubmatch(chunks[1])
+		if m == nil {
+			continue
+		}
+		val := m[1] + m[2] + m[3] // Only one of them is non-empty.
+		u := resolveURLAttr(&html.Attribute{Key: "style", Val: val}, doc)
+		if isFetchableURL(u) {
+			return u
+		}
+	}
+	return nil
+}
+
+func isFetchableURL(u *url.URL) bool {
+	return u != nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset parses the srcset attribute, loosely following the algorithm
+// in the HTML Living Standard.
+func parseSrcset(s string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+
+	for {
+		s = strings.TrimLeft(s, " \t\n\f\r,")
+		if s == "" {
+			return candidates
+		}
+		end := strings.IndexAny(s, " \t\n\f\r")
+		if end < 0 {
+			end = len(s)
+		}
+		c := srcsetCandidate{url: s[:end]}
+		s = s[end:]
+
+		if trimmed := strings.TrimRight(c.url, ","); len(trimmed) < len(c.url) {
+			c.url = trimmed
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			c.descriptor = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+
+		candidates = append(candidates, c)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package htmltask_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/internal/urlutil"
+	"github.com/google/webpackager/processor/htmlproc/htmltask"
+	"github.com/google/webpackager/resource"
+	"github.com/google/webpackager/resource/preload"
+	"github.com/google/webpackager/resource/preload/preloadtest"
+)
+
+func TestPreloadLCPImages(t *testing.T) {
+	pl := preloadtest.NewPreloadForRawLink
+
+	tests := []struct {
+		name   string
+		url    string
+		html   string
+		config htmltask.LCPImageConfig
+		want   []*preload.Preload
+	}{
+		{
+			name: "FirstImage",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <h1>Hello, world.</h1>
+			         <div><img src="hero.jpg"></div>
+			         <img src="second.jpg">
+			       </body>`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/hero.jpg>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "StopElement",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <video src="intro.mp4"></video>
+			         <img src="hero.jpg">
+			       </body>`,
+			want: nil,
+		},
+		{
+			name: "LazyLoading",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="hero.jpg" loading="lazy">
+			         <img src="second.jpg">
+			       </body>`,
+			want: nil,
+		},
+		{
+			name: "FetchPriority",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="logo.png">
+			         <p>Lorem ipsum.</p>
+			         <img src="hero.jpg" fetchpriority="high">
+			       </body>`,
+			config: htmltask.LCPImageConfig{MaxCount: 2},
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/hero.jpg>;rel="preload";as="image"`),
+				pl(`<https://example.com/hello/logo.png>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "MaxCount",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="logo.png">
+			         <img src="hero.jpg" fetchpriority="high">
+			       </body>`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/hero.jpg>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "BackgroundImage",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <div style="color: red; background-image: url('/hero.webp')">
+			           Hello, world.
+			         </div>
+			       </body>`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hero.webp>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "DataURL",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=">
+			       </body>`,
+			want: nil,
+		},
+		{
+			name: "Srcset",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="hero-480.jpg"
+			              srcset="hero-480.jpg 480w, hero-960.jpg 960w"
+			              sizes="(max-width: 600px) 480px, 960px">
+			       </body>`,
+			want: []*preload.Preload{
+				{
+					Link: pl(`<https://example.com/hello/hero-480.jpg>;rel="preload";as="image";` +
+						`imagesizes="(max-width: 600px) 480px, 960px";` +
+						`imagesrcset="https://example.com/hello/hero-480.jpg 480w, https://example.com/hello/hero-960.jpg 960w"`).Link,
+					Resources: []*resource.Resource{
+						resource.NewResource(urlutil.MustParse("https://example.com/hello/hero-480.jpg")),
+						resource.NewResource(urlutil.MustParse("https://example.com/hello/hero-960.jpg")),
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeHTMLResponse(test.url, test.html)
+			if err := htmltask.PreloadLCPImages(test.config).Run(resp); err != nil {
+				t.Errorf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Preloads); diff != "" {
+				t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
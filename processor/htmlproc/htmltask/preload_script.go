@@ -19,7 +19,10 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/google/webpackager/internal/sri"
 	"github.com/google/webpackager/processor/htmlproc/htmldoc"
+	"github.com/google/webpackager/processor/jsproc"
+	"github.com/google/webpackager/resource/httplink"
 	"github.com/google/webpackager/resource/preload"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -75,14 +78,30 @@ func InsecurePreloadScripts() HTMLTask {
 	return &preloadScripts{}
 }
 
-type preloadScripts struct{}
+// PreloadScriptsWithIntegrity is like InsecurePreloadScripts but only detects
+// scripts with a valid integrity attribute (Subresource Integrity). The Web
+// Packager verifies the script payloads against the integrity metadata and
+// does not produce the signed exchanges on mismatch.
+//
+// PreloadScriptsWithIntegrity mitigates the risk described in the security
+// notice of InsecurePreloadScripts when the script URLs change along with
+// their contents (e.g. "script.3fa9c2.js"): a signed exchange for a script
+// with a security issue will not be used once the document is updated to
+// reference the fixed script, since its integrity metadata changes.
+func PreloadScriptsWithIntegrity() HTMLTask {
+	return &preloadScripts{requireIntegrity: true}
+}
+
+type preloadScripts struct {
+	requireIntegrity bool
+}
 
-func (*preloadScripts) Run(resp *htmldoc.HTMLResponse) error {
+func (task *preloadScripts) Run(resp *htmldoc.HTMLResponse) error {
 	return htmldoc.Traverse(resp.Doc.Root, func(n *html.Node) error {
 		switch n.Type {
 		case html.ElementNode:
 			if n.DataAtom == atom.Script {
-				handleScript(resp, n)
+				task.handleScript(resp, n)
 				return htmldoc.ErrSkip
 			}
 			if skipElements[n.DataAtom] {
@@ -111,16 +130,75 @@ func (*preloadScripts) Run(resp *htmldoc.HTMLResponse) error {
 	})
 }
 
-func handleScript(resp *htmldoc.HTMLResponse, n *html.Node) {
+func (task *preloadScripts) handleScript(resp *htmldoc.HTMLResponse, n *html.Node) {
 	if htmldoc.FindAttr(n, "async") != nil {
 		return
 	}
-	if htmldoc.FindAttr(n, "defer") != nil {
+	if htmldoc.FindAttr(n, "nomodule") != nil {
+		return // Never run on browsers supporting signed exchanges.
+	}
+	module := isModuleScript(n)
+	// Module scripts are always deferred, but we still preload them since
+	// they (and the modules they import) are fetched at the page load.
+	if !module && htmldoc.FindAttr(n, "defer") != nil {
+		return
+	}
+
+	if module && htmldoc.FindAttr(n, "src") == nil {
+		if !task.requireIntegrity && n.FirstChild != nil {
+			for _, u := range jsproc.ResolveStaticImports(n.FirstChild.Data, resp.Doc.BaseURL) {
+				resp.AddPreload(jsproc.NewModulePreload(u))
+			}
+		}
+		return
+	}
+
+	u := resolveURLAttr(htmldoc.FindAttr(n, "src"), resp.Doc)
+	if u == nil {
+		return
+	}
+	// Do not preload the same script again without the integrity, which a
+	// preceding PreloadScriptsWithIntegrity may have added.
+	if !task.requireIntegrity && hasPreloadForURL(resp, u.String()) {
 		return
 	}
-	if u := resolveURLAttr(htmldoc.FindAttr(n, "src"), resp.Doc); u != nil {
-		resp.AddPreload(preload.NewPreloadForURL(u, preload.AsScript))
+
+	var integrity string
+	if task.requireIntegrity {
+		integrity = htmldoc.GetAttr(n, "integrity")
+		if _, err := sri.Parse(integrity); err != nil {
+			return
+		}
+	}
+
+	var p *preload.Preload
+	if module {
+		p = jsproc.NewModulePreload(u)
+	} else {
+		p = preload.NewPreloadForURL(u, preload.AsScript)
+	}
+	// Module scripts are fetched in CORS mode regardless of the crossorigin
+	// attribute, which only affects the credentials mode. The attribute is
+	// respected for classic scripts only when verifying the integrity to not
+	// change the existing behavior of InsecurePreloadScripts.
+	if a := htmldoc.FindAttr(n, "crossorigin"); a != nil && (module || task.requireIntegrity) {
+		p.Link.Params.Set(httplink.ParamCrossOrigin, a.Val)
 	}
+	p.Integrity = integrity
+	resp.AddPreload(p)
+}
+
+func hasPreloadForURL(resp *htmldoc.HTMLResponse, url string) bool {
+	for _, p := range resp.Preloads {
+		if p.Link.URL.String() == url {
+			return true
+		}
+	}
+	return false
+}
+
+func isModuleScript(n *html.Node) bool {
+	return strings.EqualFold(strings.TrimSpace(htmldoc.GetAttr(n, "type")), "module")
 }
 
 func isNotSpace(r rune) bool { return !unicode.IsSpace(r) }
@@ -196,6 +196,37 @@ func TestScriptTask(t *testing.T) {
 				pl(`<https://example.com/hello/type.js>;rel="preload";as="script"`),
 			},
 		},
+		{
+			name: "Module",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <head>
+			         <script src="main.mjs" type="module"></script>
+			         <script src="cred.mjs" type="module" crossorigin="use-credentials"></script>
+			         <script src="async.mjs" type="module" async></script>
+			         <script src="legacy.js" nomodule></script>
+			       </head>`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/main.mjs>;rel="modulepreload"`),
+				pl(`<https://example.com/hello/cred.mjs>;rel="modulepreload";crossorigin="use-credentials"`),
+			},
+		},
+		{
+			name: "Module_Inline",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <head>
+			         <script type="module">
+			           import {foo} from "./foo.mjs";
+			           import "/lib/bar.mjs";
+			           import baz from "baz";
+			         </script>
+			       </head>`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/foo.mjs>;rel="modulepreload"`),
+				pl(`<https://example.com/lib/bar.mjs>;rel="modulepreload"`),
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -210,3 +241,76 @@ func TestScriptTask(t *testing.T) {
 		})
 	}
 }
+
+func TestScriptTask_WithIntegrity(t *testing.T) {
+	const integrity = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+
+	withIntegrity := func(rawLink string) *preload.Preload {
+		p := preloadtest.NewPreloadForRawLink(rawLink)
+		p.Integrity = integrity
+		return p
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		html string
+		want []*preload.Preload
+	}{
+		{
+			name: "Integrity",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <head>
+			         <script src="foo.js" integrity="` + integrity + `"></script>
+			         <script src="bar.js"></script>
+			       </head>`,
+			want: []*preload.Preload{
+				withIntegrity(`<https://example.com/hello/foo.js>;rel="preload";as="script"`),
+			},
+		},
+		{
+			name: "CrossOrigin",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <head>
+			         <script src="foo.js" integrity="` + integrity + `"
+			                 crossorigin="anonymous"></script>
+			       </head>`,
+			want: []*preload.Preload{
+				withIntegrity(`<https://example.com/hello/foo.js>;rel="preload";as="script";crossorigin`),
+			},
+		},
+		{
+			name: "InvalidIntegrity",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <head>
+			         <script src="foo.js" integrity="md5-AAAAAAAAAAAAAAAAAAAAAA=="></script>
+			       </head>`,
+			want: nil,
+		},
+		{
+			name: "Body_Image",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <body>
+			         <img src="thumb.jpg">
+			         <script src="foo.js" integrity="` + integrity + `"></script>
+			       </body>`,
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeHTMLResponse(test.url, test.html)
+			if err := htmltask.PreloadScriptsWithIntegrity().Run(resp); err != nil {
+				t.Errorf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Preloads); diff != "" {
+				t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -80,6 +80,29 @@ func TestExtractPreloadTags(t *testing.T) {
 				pl(`<https://example.com/hello/large.jpg>;rel="preload";as="image";media="(min-width: 601px)"`),
 			},
 		},
+		{
+			name: "NoHeader",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <link href="foo.jpg" rel="preload" as="image"
+			             data-sxg-no-header>
+			       <link href="bar.jpg" rel="preload" as="image">`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/bar.jpg>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "ModulePreload",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <link href="main.mjs" rel="modulepreload">
+			       <link href="dep.mjs" rel="modulepreload"
+			             crossorigin="use-credentials">`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/main.mjs>;rel="modulepreload"`),
+				pl(`<https://example.com/hello/dep.mjs>;rel="modulepreload";crossorigin="use-credentials"`),
+			},
+		},
 	}
 
 	extractPreloadTags := htmltask.ExtractPreloadTags()
@@ -96,3 +119,55 @@ func TestExtractPreloadTags(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractOptInPreloadTags(t *testing.T) {
+	pl := preloadtest.NewPreloadForRawLink
+
+	tests := []struct {
+		name string
+		url  string
+		html string
+		want []*preload.Preload
+	}{
+		{
+			name: "OptIn",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <link href="foo.jpg" rel="preload" as="image"
+			             data-sxg-preload>
+			       <link href="bar.jpg" rel="preload" as="image">`,
+			want: []*preload.Preload{
+				pl(`<https://example.com/hello/foo.jpg>;rel="preload";as="image"`),
+			},
+		},
+		{
+			name: "NoHeaderPrecedence",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <link href="foo.jpg" rel="preload" as="image"
+			             data-sxg-preload data-sxg-no-header>`,
+			want: nil,
+		},
+		{
+			name: "NonPreload",
+			url:  "https://example.com/hello/",
+			html: `<!doctype html>
+			       <link href="foo.css" rel="stylesheet" data-sxg-preload>`,
+			want: nil,
+		},
+	}
+
+	extractPreloadTags := htmltask.ExtractOptInPreloadTags("data-sxg-preload")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := makeHTMLResponse(test.url, test.html)
+			if err := extractPreloadTags.Run(resp); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Preloads); diff != "" {
+				t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsproc
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FindStaticImports returns the module specifiers in the static import and
+// export declarations in the JavaScript source src, in the order of their
+// appearance. It recognizes the following forms:
+//
+//	import "module";
+//	import ... from "module";
+//	export ... from "module";
+//
+// FindStaticImports does not implement a full JavaScript parser. It skips
+// comments, string literals, and template literals, but may be confused by
+// regular expression literals containing quotes or "import" keywords.
+// Dynamic imports (import("module")) are not included.
+func FindStaticImports(src string) []string {
+	var specs []string
+
+	s := &scanner{src: src}
+	for {
+		tok := s.next()
+		if tok.kind == tokEOF {
+			return specs
+		}
+		if tok.kind != tokIdent || (tok.text != "import" && tok.text != "export") {
+			continue
+		}
+		if s.prevDot {
+			continue // Property access such as "foo.import".
+		}
+		if spec, ok := s.parseDeclaration(tok.text); ok {
+			specs = append(specs, spec)
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // Unquoted for tokString.
+}
+
+type scanner struct {
+	src     string
+	pos     int
+	prevDot bool // Whether the token before the last one was ".".
+	lastDot bool
+}
+
+// parseDeclaration parses the rest of an import or export declaration and
+// returns the module specifier, if any.
+func (s *scanner) parseDeclaration(keyword string) (string, bool) {
+	tok := s.next()
+	switch {
+	case keyword == "import" && tok.kind == tokString:
+		return tok.text, true // import "module";
+	case tok.kind == tokPunct && (tok.text == "(" || tok.text == "."):
+		return "", false // import(...) or import.meta
+	case keyword == "export" && !(tok.kind == tokPunct && (tok.text == "*" || tok.text == "{")):
+		return "", false // Only export * and export {...} can have "from".
+	}
+
+	// Look for "from" followed by a string, up to the end of the statement.
+	for depth := 0; ; {
+		switch {
+		case tok.kind == tokEOF:
+			return "", false
+		case tok.kind == tokPunct && tok.text == "{":
+			depth++
+		case tok.kind == tokPunct && tok.text == "}":
+			depth--
+		case tok.kind == tokPunct && tok.text == ";" && depth <= 0:
+			return "", false
+		case tok.kind == tokIdent && tok.text == "from" && depth <= 0:
+			if next := s.next(); next.kind == tokString {
+				return next.text, true
+			}
+			return "", false
+		case tok.kind == tokString && depth <= 0:
+			return "", false
+		case tok.kind == tokIdent && (tok.text == "import" || tok.text == "export") && depth <= 0:
+			return s.parseDeclaration(tok.text) // Missing semicolon.
+		}
+		tok = s.next()
+	}
+}
+
+func (s *scanner) next() token {
+	s.skipSpacesAndComments()
+	s.prevDot = s.lastDot
+	s.lastDot = false
+
+	if s.pos >= len(s.src) {
+		return token{kind: tokEOF}
+	}
+
+	r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+	switch {
+	case r == '"' || r == '\'':
+		return token{tokString, s.scanString(byte(r))}
+	case r == '`':
+		s.skipTemplate()
+		return token{tokString, ""}
+	case isIdentStart(r):
+		start := s.pos
+		for s.pos < len(s.src) {
+			r, size := utf8.DecodeRuneInString(s.src[s.pos:])
+			if !isIdentPart(r) {
+				break
+			}
+			s.pos += size
+		}
+		return token{tokIdent, s.src[start:s.pos]}
+	default:
+		s.pos += size
+		s.lastDot = r == '.'
+		return token{tokPunct, string(r)}
+	}
+}
+
+func (s *scanner) skipSpacesAndComments() {
+	for s.pos < len(s.src) {
+		rest := s.src[s.pos:]
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			if i := strings.IndexByte(rest, '\n'); i >= 0 {
+				s.pos += i + 1
+			} else {
+				s.pos = len(s.src)
+			}
+		case strings.HasPrefix(rest, "/*"):
+			if i := strings.Index(rest[2:], "*/"); i >= 0 {
+				s.pos += i + 4
+			} else {
+				s.pos = len(s.src)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(rest)
+			if !unicode.IsSpace(r) {
+				return
+			}
+			s.pos += size
+		}
+	}
+}
+
+func (s *scanner) scanString(quote byte) string {
+	var sb strings.Builder
+	s.pos++ // Opening quote.
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		s.pos++
+		switch c {
+		case quote:
+			return sb.String()
+		case '\\':
+			if s.pos < len(s.src) {
+				sb.WriteByte(s.src[s.pos])
+				s.pos++
+			}
+		case '\n':
+			return sb.String() // Unterminated string.
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func (s *scanner) skipTemplate() {
+	s.pos++ // Opening backquote.
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '`':
+			s.pos++
+			return
+		case '\\':
+			s.pos += 2
+		default:
+			s.pos++
+		}
+	}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '$' || r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
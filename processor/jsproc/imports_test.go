@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsproc_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/processor/jsproc"
+)
+
+func TestFindStaticImports(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "SideEffect",
+			src:  `import "./polyfill.js";`,
+			want: []string{"./polyfill.js"},
+		},
+		{
+			name: "Forms",
+			src: `import foo from './foo.js';
+			      import * as bar from "./bar.js";
+			      import baz, {qux as quux} from "/baz.js";
+			      import {
+			        a,
+			        b,
+			      } from "../ab.js"`,
+			want: []string{"./foo.js", "./bar.js", "/baz.js", "../ab.js"},
+		},
+		{
+			name: "Exports",
+			src: `export * from "./all.js";
+			      export {x, y as z} from './xy.js';
+			      export const from = "./not-a-module.js";
+			      export default function() { return "./nope.js"; }`,
+			want: []string{"./all.js", "./xy.js"},
+		},
+		{
+			name: "MissingSemicolons",
+			src: "export function f() {}\n" +
+				"import './a.js'\n" +
+				"import b from './b.js'\n",
+			want: []string{"./a.js", "./b.js"},
+		},
+		{
+			name: "Ignored",
+			src: `// import "./comment.js";
+			      /* import "./block.js"; */
+			      const s = 'import "./string.js"';
+			      const t = ` + "`import \"./template.js\"`" + `;
+			      import("./dynamic.js");
+			      console.log(import.meta.url);
+			      foo.import("./method.js");`,
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := jsproc.FindStaticImports(test.src)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("FindStaticImports() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
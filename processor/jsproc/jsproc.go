@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsproc implements processors for JavaScript resources.
+package jsproc
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/processor"
+	"github.com/google/webpackager/resource/httplink"
+	"github.com/google/webpackager/resource/preload"
+)
+
+// ExtractModuleImports detects static imports in JavaScript modules (e.g.
+// `import {foo} from "./foo.js"`) and adds the imported modules to the
+// Preloads field, with as="script" and crossorigin, to get the whole module
+// graph preloaded. Only the module specifiers that are URLs (relative or
+// absolute) are recognized; bare specifiers (e.g. "lodash") are ignored since
+// they depend on import maps.
+//
+// Classic scripts cannot contain static imports, so ExtractModuleImports
+// only processes the responses marked as modules, i.e. those having "module"
+// in resp.ExtraData[exchange.ScriptType]. The packager marks the responses
+// for the preloads with Module set to true, such as those created by
+// NewModulePreload.
+var ExtractModuleImports processor.Processor = &extractModuleImports{}
+
+type extractModuleImports struct{}
+
+func (*extractModuleImports) Process(resp *exchange.Response) error {
+	if resp.ExtraData.Get(exchange.ScriptType) != "module" {
+		return nil
+	}
+	for _, u := range ResolveStaticImports(string(resp.Payload), resp.Request.URL) {
+		resp.AddPreload(NewModulePreload(u))
+	}
+	return nil
+}
+
+// NewModulePreload creates and initializes a new Preload for the JavaScript
+// module located at u.
+func NewModulePreload(u *url.URL) *preload.Preload {
+	p := preload.NewPreloadForURL(u, preload.AsScript)
+	p.Link.Params.Set(httplink.ParamCrossOrigin, httplink.CrossOriginAnonymous)
+	p.Module = true
+	return p
+}
+
+// ResolveStaticImports finds the module specifiers of static imports in src
+// and resolves them against base. Bare specifiers and specifiers which fail
+// to parse are excluded.
+func ResolveStaticImports(src string, base *url.URL) []*url.URL {
+	var urls []*url.URL
+	for _, spec := range FindStaticImports(src) {
+		if !isURLSpecifier(spec) {
+			continue
+		}
+		u, err := url.Parse(spec)
+		if err != nil {
+			log.Printf("warning: invalid module specifier %q: %v", spec, err)
+			continue
+		}
+		urls = append(urls, base.ResolveReference(u))
+	}
+	return urls
+}
+
+func isURLSpecifier(spec string) bool {
+	for _, prefix := range []string{"/", "./", "../", "https://", "http://"} {
+		if strings.HasPrefix(spec, prefix) {
+			return true
+		}
+	}
+	return false
+}
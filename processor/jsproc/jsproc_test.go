@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsproc_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor/jsproc"
+	"github.com/google/webpackager/resource/preload"
+	"github.com/google/webpackager/resource/preload/preloadtest"
+)
+
+func TestExtractModuleImports(t *testing.T) {
+	pl := preloadtest.NewPreloadForRawLink
+
+	js := `import {a} from "./a.js";
+	       import b from "/lib/b.js";
+	       import lodash from "lodash";
+	       import c from "https://cdn.example.org/c.js";`
+
+	tests := []struct {
+		name   string
+		module bool
+		want   []*preload.Preload
+	}{
+		{
+			name:   "Module",
+			module: true,
+			want: []*preload.Preload{
+				pl(`<https://example.com/js/a.js>;rel="modulepreload"`),
+				pl(`<https://example.com/lib/b.js>;rel="modulepreload"`),
+				pl(`<https://cdn.example.org/c.js>;rel="modulepreload"`),
+			},
+		},
+		{
+			name:   "ClassicScript",
+			module: false,
+			want:   nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := exchangetest.MakeResponse("https://example.com/js/main.js", fmt.Sprint(
+				"HTTP/1.1 200 OK\r\n",
+				"Cache-Control: public, max-age=604800\r\n",
+				"Content-Length: ", len(js), "\r\n",
+				"Content-Type: application/javascript\r\n",
+				"\r\n",
+				js))
+			if test.module {
+				resp.ExtraData.Set(exchange.ScriptType, "module")
+			}
+
+			if err := jsproc.ExtractModuleImports.Process(resp); err != nil {
+				t.Fatalf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Preloads); diff != "" {
+				t.Errorf("resp.Preloads mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
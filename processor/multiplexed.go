@@ -19,11 +19,17 @@ import (
 	"mime"
 
 	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/mediatype"
 )
 
 // MultiplexedProcessor is a map from media types to processors. The map keys
 // are normalized to lowercase and do not include parameters (e.g. "text/html",
 // not "Text/HTML" or "text/html; charset=utf-8").
+//
+// The map keys may also be patterns with wildcards (e.g. "image/*") or
+// structured syntax suffixes (e.g. "application/*+json"). The most specific
+// key is used when multiple keys match the media type; see
+// mediatype.Candidates for the precedence rule.
 type MultiplexedProcessor map[string]Processor
 
 // Process invokes the processor based on Content-Type of the response.
@@ -42,9 +48,26 @@ func (mp MultiplexedProcessor) Process(resp *exchange.Response) error {
 		log.Printf("warning: invalid Content-Type %q: %v", contentType, err)
 		return nil
 	}
-	p := mp[mediaType]
+	_, p := mp.Lookup(mediaType)
 	if p == nil {
 		return nil
 	}
 	return p.Process(resp)
 }
+
+// Lookup returns the processor for mediaType along with the map key used
+// to find it. mediaType must be normalized like the map keys. Lookup returns
+// an empty key and nil processor when no key matches mediaType.
+//
+// Lookup is what Process uses internally, exposed to help debugging which
+// processor handles which media type.
+func (mp MultiplexedProcessor) Lookup(mediaType string) (key string, p Processor) {
+	key, ok := mediatype.Lookup(mediaType, func(k string) bool {
+		_, ok := mp[k]
+		return ok
+	})
+	if !ok {
+		return "", nil
+	}
+	return key, mp[key]
+}
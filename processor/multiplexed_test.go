@@ -15,6 +15,7 @@
 package processor_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -87,3 +88,65 @@ func TestMultiplexedProcessor(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiplexedProcessor_Wildcard(t *testing.T) {
+	mp := processor.MultiplexedProcessor{
+		"image/svg+xml":      newTestingProcessor("svg"),
+		"image/*":            newTestingProcessor("image"),
+		"image/webp":         nil,
+		"application/*+json": newTestingProcessor("json"),
+		"*/*":                newTestingProcessor("any"),
+	}
+
+	tests := []struct {
+		ctype string
+		key   string
+		want  []string
+	}{
+		{
+			ctype: "image/svg+xml",
+			key:   "image/svg+xml",
+			want:  []string{"svg"},
+		},
+		{
+			ctype: "image/png",
+			key:   "image/*",
+			want:  []string{"image"},
+		},
+		{
+			ctype: "image/webp",
+			key:   "image/webp",
+			want:  nil,
+		},
+		{
+			ctype: "application/ld+json; charset=utf-8",
+			key:   "application/*+json",
+			want:  []string{"json"},
+		},
+		{
+			ctype: "text/plain",
+			key:   "*/*",
+			want:  []string{"any"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ctype, func(t *testing.T) {
+			resp := exchangetest.MakeEmptyResponse("https://dummy.test/")
+			resp.Header.Set("Content-Type", test.ctype)
+			if err := mp.Process(resp); err != nil {
+				t.Errorf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Header["X-Testing"]); diff != "" {
+				t.Errorf("resp.Header[\"X-Testing\"] mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, test := range tests {
+		mediaType := strings.SplitN(test.ctype, ";", 2)[0]
+		if key, _ := mp.Lookup(mediaType); key != test.key {
+			t.Errorf("Lookup(%q) = %q, want %q", mediaType, key, test.key)
+		}
+	}
+}
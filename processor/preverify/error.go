@@ -16,17 +16,24 @@ package preverify
 
 import (
 	"fmt"
+
+	"github.com/google/webpackager/exchange"
 )
 
 // HTTPStatusError represents an HTTP status error.
 type HTTPStatusError struct {
 	// StatusCode represents the HTTP status code returned.
 	StatusCode int
+
+	// Response is the response with the unexpected status code, which can
+	// be used to pass the error response through to the clients. It may be
+	// nil.
+	Response *exchange.Response
 }
 
 // NewHTTPStatusError creates a new HTTPStatusError.
 func NewHTTPStatusError(statusCode int) *HTTPStatusError {
-	return &HTTPStatusError{statusCode}
+	return &HTTPStatusError{StatusCode: statusCode}
 }
 
 // Error implements the error interface.
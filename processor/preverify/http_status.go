@@ -40,7 +40,7 @@ type httpStatusCode struct {
 
 func (h *httpStatusCode) Process(resp *exchange.Response) error {
 	if !h.expected[resp.StatusCode] {
-		return NewHTTPStatusError(resp.StatusCode)
+		return &HTTPStatusError{resp.StatusCode, resp}
 	}
 	return nil
 }
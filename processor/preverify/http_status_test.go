@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/webpackager/exchange/exchangetest"
 	"github.com/google/webpackager/processor"
 	"github.com/google/webpackager/processor/preverify"
@@ -119,9 +120,13 @@ func TestHTTPStatusCode_Error(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			resp := exchangetest.MakeResponse(test.url, test.resp)
 			err := test.proc.Process(resp)
-			if diff := cmp.Diff(test.err, err); diff != "" {
+			ignoreResponse := cmpopts.IgnoreFields(preverify.HTTPStatusError{}, "Response")
+			if diff := cmp.Diff(test.err, err, ignoreResponse); diff != "" {
 				t.Errorf("Process() = %v, want %v", err, test.err)
 			}
+			if statusErr, ok := err.(*preverify.HTTPStatusError); ok && statusErr.Response != resp {
+				t.Errorf("Process().Response = %p, want %p", statusErr.Response, resp)
+			}
 		})
 	}
 }
@@ -0,0 +1,50 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor
+
+import (
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/urlmatcher"
+)
+
+// URLRoute associates a processor with the URLs matching Matcher.
+type URLRoute struct {
+	// Matcher specifies the URLs to run Processor for. nil matches any URL.
+	Matcher urlmatcher.Matcher
+
+	// Processor is run for the URLs matching Matcher. It may be nil to do
+	// nothing for those URLs.
+	Processor Processor
+}
+
+// URLRoutedProcessor is a list of URLRoutes. It is the URL-based counterpart
+// of MultiplexedProcessor.
+type URLRoutedProcessor []URLRoute
+
+// Process invokes the processor of the first route matching the request URL.
+// Process does nothing when no route matches the URL.
+func (rp URLRoutedProcessor) Process(resp *exchange.Response) error {
+	u := resp.Request.URL
+	for _, route := range rp {
+		if route.Matcher != nil && !route.Matcher.Match(u) {
+			continue
+		}
+		if route.Processor == nil {
+			return nil
+		}
+		return route.Processor.Process(resp)
+	}
+	return nil
+}
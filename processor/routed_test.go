@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/exchange/exchangetest"
+	"github.com/google/webpackager/processor"
+	"github.com/google/webpackager/urlmatcher"
+)
+
+func TestURLRoutedProcessor(t *testing.T) {
+	rp := processor.URLRoutedProcessor{
+		{
+			Matcher:   urlmatcher.HasEscapedPathPrefix("/blog/"),
+			Processor: newTestingProcessor("blog"),
+		},
+		{
+			Matcher:   urlmatcher.HasEscapedPathPrefix("/checkout/"),
+			Processor: nil,
+		},
+		{
+			Matcher:   urlmatcher.HasHostname("static.example.com"),
+			Processor: newTestingProcessor("static"),
+		},
+		{
+			Matcher:   nil,
+			Processor: newTestingProcessor("default"),
+		},
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{
+			url:  "https://example.com/blog/hello.html",
+			want: []string{"blog"},
+		},
+		{
+			url:  "https://static.example.com/blog/hello.html",
+			want: []string{"blog"},
+		},
+		{
+			url:  "https://example.com/checkout/cart.html",
+			want: nil,
+		},
+		{
+			url:  "https://static.example.com/style.css",
+			want: []string{"static"},
+		},
+		{
+			url:  "https://example.com/index.html",
+			want: []string{"default"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			resp := exchangetest.MakeEmptyResponse(test.url)
+			if err := rp.Process(resp); err != nil {
+				t.Errorf("got error(%q), want success", err)
+			}
+			if diff := cmp.Diff(test.want, resp.Header["X-Testing"]); diff != "" {
+				t.Errorf("resp.Header[\"X-Testing\"] mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestURLRoutedProcessor_NoMatch(t *testing.T) {
+	rp := processor.URLRoutedProcessor{
+		{
+			Matcher:   urlmatcher.HasEscapedPathPrefix("/blog/"),
+			Processor: newTestingProcessor("blog"),
+		},
+	}
+
+	resp := exchangetest.MakeEmptyResponse("https://example.com/index.html")
+	if err := rp.Process(resp); err != nil {
+		t.Errorf("got error(%q), want success", err)
+	}
+	if got := resp.Header["X-Testing"]; got != nil {
+		t.Errorf("resp.Header[\"X-Testing\"] = %q, want nil", got)
+	}
+}
@@ -17,6 +17,7 @@ package cache
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/google/webpackager/resource"
 
@@ -24,8 +25,15 @@ import (
 	"golang.org/x/xerrors"
 )
 
+// maxVariantsPerURL is the maximum number of variants boundedCache keeps for
+// each URL. The variants of a URL count as one entry toward the size limit,
+// so they need their own bound.
+const maxVariantsPerURL = 8
+
 // NewBoundedInMemoryCache returns a new ResourceCache that stores Resources in
 // memory, with an eviction policy after `size` entries. size must be positive.
+// Each entry holds up to eight variants of the same URL; the least recently
+// stored variant is evicted first.
 func NewBoundedInMemoryCache(size int) ResourceCache {
 	if size > 1 {
 		// The extra memory/CPU overhead of lru.TwoQueueCache over lru.Cache
@@ -36,7 +44,7 @@ func NewBoundedInMemoryCache(size int) ResourceCache {
 			// Only occurs if size < 2.
 			panic(xerrors.Errorf("constructing 2Q cache: %w", err))
 		}
-		return &boundedCache{c}
+		return &boundedCache{cache: c}
 	} else {
 		// lru.New2Q can't construct a TwoQueueCache of size 1, because
 		// it rounds 1*ratio down to 0 when constructing its inner
@@ -47,18 +55,21 @@ func NewBoundedInMemoryCache(size int) ResourceCache {
 			// Only occurs if size < 1.
 			panic(xerrors.Errorf("constructing LRU cache: %w", err))
 		}
-		return &boundedCache{lruCache{c}}
+		return &boundedCache{cache: lruCache{c}}
 	}
 }
 
 type boundedCache struct {
+	// mu serializes the read-modify-write sequences on cache, which is
+	// safe for concurrent use only in each single operation.
+	mu    sync.Mutex
 	cache cache
 }
 
 func (c *boundedCache) Lookup(req *http.Request) (*resource.Resource, error) {
 	switch r, _ := c.cache.Get(req.URL.String()); t := r.(type) {
-	case *resource.Resource:
-		return t, nil
+	case []*resource.Resource:
+		return MatchVariant(t, req), nil
 	case nil:
 		return nil, nil
 	default:
@@ -66,14 +77,50 @@ func (c *boundedCache) Lookup(req *http.Request) (*resource.Resource, error) {
 	}
 }
 
+// Store stores r along with the other variants of the same URL, as a single
+// entry counting toward the size limit. It drops the oldest variant when the
+// URL already has maxVariantsPerURL variants.
 func (c *boundedCache) Store(r *resource.Resource) error {
-	c.cache.Add(r.RequestURL.String(), r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := r.RequestURL.String()
+	variants, _ := c.cache.Get(key)
+	list, _ := variants.([]*resource.Resource)
+	list = AddVariant(list, r)
+	if len(list) > maxVariantsPerURL {
+		// AddVariant puts r first, so the tail holds the oldest variants.
+		list = list[:maxVariantsPerURL]
+	}
+	c.cache.Add(key, list)
 	return nil
 }
 
+func (c *boundedCache) Entries() []*resource.Resource {
+	var entries []*resource.Resource
+	for _, key := range c.cache.Keys() {
+		// Peek does not update the recentness of the entry.
+		variants, _ := c.cache.Peek(key)
+		list, _ := variants.([]*resource.Resource)
+		entries = append(entries, list...)
+	}
+	return entries
+}
+
+func (c *boundedCache) Purge(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	variants, _ := c.cache.Peek(url)
+	list, _ := variants.([]*resource.Resource)
+	c.cache.Remove(url)
+	return len(list)
+}
+
 type cache interface {
 	Add(key, value interface{})
 	Get(key interface{}) (value interface{}, ok bool)
+	Peek(key interface{}) (value interface{}, ok bool)
+	Keys() []interface{}
+	Remove(key interface{})
 }
 
 // Compiler check that both lruCache and lru.TwoQueueCache implement cache:
@@ -95,3 +142,15 @@ func (c lruCache) Add(key, value interface{}) {
 func (c lruCache) Get(key interface{}) (value interface{}, ok bool) {
 	return c.lru.Get(key)
 }
+
+func (c lruCache) Peek(key interface{}) (value interface{}, ok bool) {
+	return c.lru.Peek(key)
+}
+
+func (c lruCache) Keys() []interface{} {
+	return c.lru.Keys()
+}
+
+func (c lruCache) Remove(key interface{}) {
+	c.lru.Remove(key)
+}
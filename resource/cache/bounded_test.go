@@ -141,3 +141,40 @@ func TestBoundedCache_2Q(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundedCache_MaxVariants(t *testing.T) {
+	const url = "https://example.com/foo.html"
+	langs := []string{"de", "en", "es", "fr", "it", "ja", "ko", "pt", "zh"}
+	bc := cache.NewBoundedInMemoryCache(10)
+
+	for _, lang := range langs {
+		if err := bc.Store(makeVariant(url, lang)); err != nil {
+			t.Fatalf("bc.Store(%q) = error(%q), want success", lang, err)
+		}
+	}
+
+	// The oldest variant is evicted.
+	{
+		req := makeRequest(url)
+		req.Header.Set("Accept-Language", "de")
+		got, err := bc.Lookup(req)
+		if err != nil {
+			t.Errorf("bc.Lookup(de) = error(%q), want success", err)
+		}
+		if got != nil {
+			t.Errorf("bc.Lookup(de) = %v, want %v", got, nil)
+		}
+	}
+	// The newer variants are still present.
+	for _, lang := range langs[1:] {
+		req := makeRequest(url)
+		req.Header.Set("Accept-Language", lang)
+		got, err := bc.Lookup(req)
+		if err != nil {
+			t.Errorf("bc.Lookup(%q) = error(%q), want success", lang, err)
+		}
+		if got == nil || got.VaryHeader.Get("Accept-Language") != lang {
+			t.Errorf("bc.Lookup(%q) = %v, want the %q variant", lang, got, lang)
+		}
+	}
+}
@@ -39,3 +39,15 @@ type ResourceCache interface {
 	// Store stores the provided Resource r into the cache.
 	Store(r *resource.Resource) error
 }
+
+// Purger is implemented by ResourceCaches which can list and remove the
+// stored Resources, e.g. for administrative operations. All ResourceCaches
+// in this package implement it.
+type Purger interface {
+	// Entries returns all the stored Resources, including all variants.
+	Entries() []*resource.Resource
+
+	// Purge removes the Resources for the request URL url, including all
+	// variants. It returns the number of removed Resources.
+	Purge(url string) int
+}
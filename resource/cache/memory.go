@@ -16,25 +16,52 @@ package cache
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/google/webpackager/resource"
 )
 
 // NewOnMemoryCache creates and initializes a new ResourceCache storing
-// Resources on memory.
+// Resources on memory. It is safe for concurrent use.
 func NewOnMemoryCache() ResourceCache {
-	return make(onMemoryCache)
+	return &onMemoryCache{entries: make(map[string][]*resource.Resource)}
 }
 
-// BUG(yuizumi): OnMemoryCache uses only RequestURL for the cache key at this
-// moment; it is not aware of Vary or Variants yet.
-type onMemoryCache map[string]*resource.Resource
+// BUG(yuizumi): OnMemoryCache uses only RequestURL and Resource.VaryHeader
+// for the cache key at this moment; it is not aware of Vary or Variants yet.
+type onMemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string][]*resource.Resource
+}
 
-func (mc onMemoryCache) Lookup(req *http.Request) (*resource.Resource, error) {
-	return mc[req.URL.String()], nil
+func (mc *onMemoryCache) Lookup(req *http.Request) (*resource.Resource, error) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	return MatchVariant(mc.entries[req.URL.String()], req), nil
 }
 
-func (mc onMemoryCache) Store(r *resource.Resource) error {
-	mc[r.RequestURL.String()] = r
+func (mc *onMemoryCache) Store(r *resource.Resource) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	key := r.RequestURL.String()
+	mc.entries[key] = AddVariant(mc.entries[key], r)
 	return nil
 }
+
+func (mc *onMemoryCache) Entries() []*resource.Resource {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	var entries []*resource.Resource
+	for _, variants := range mc.entries {
+		entries = append(entries, variants...)
+	}
+	return entries
+}
+
+func (mc *onMemoryCache) Purge(url string) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	n := len(mc.entries[url])
+	delete(mc.entries, url)
+	return n
+}
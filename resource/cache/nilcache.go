@@ -36,3 +36,11 @@ func (_ nilCache) Lookup(req *http.Request) (*resource.Resource, error) {
 func (_ nilCache) Store(r *resource.Resource) error {
 	return nil
 }
+
+func (_ nilCache) Entries() []*resource.Resource {
+	return nil
+}
+
+func (_ nilCache) Purge(url string) int {
+	return 0
+}
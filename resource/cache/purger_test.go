@@ -0,0 +1,121 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/webpackager/resource"
+	"github.com/google/webpackager/resource/cache"
+)
+
+func TestPurger(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache cache.ResourceCache
+	}{
+		{"OnMemoryCache", cache.NewOnMemoryCache()},
+		{"BoundedInMemoryCache", cache.NewBoundedInMemoryCache(10)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.cache
+			p, ok := c.(cache.Purger)
+			if !ok {
+				t.Fatalf("%T does not implement Purger", c)
+			}
+			for _, url := range []string{"https://example.com/foo.html", "https://example.com/bar.html"} {
+				if err := c.Store(makeResource(url)); err != nil {
+					t.Fatalf("c.Store(%q) = error(%q), want success", url, err)
+				}
+			}
+
+			if got := len(p.Entries()); got != 2 {
+				t.Errorf("len(p.Entries()) = %v, want %v", got, 2)
+			}
+			if got := p.Purge("https://example.com/foo.html"); got != 1 {
+				t.Errorf("p.Purge(foo) = %v, want %v", got, 1)
+			}
+			if got := p.Purge("https://example.com/baz.html"); got != 0 {
+				t.Errorf("p.Purge(baz) = %v, want %v", got, 0)
+			}
+			if got, _ := c.Lookup(makeRequest("https://example.com/foo.html")); got != nil {
+				t.Errorf("c.Lookup(foo) = %v, want nil", got)
+			}
+			entries := p.Entries()
+			if len(entries) != 1 || entries[0].RequestURL.String() != "https://example.com/bar.html" {
+				t.Errorf("p.Entries() = %v, want [bar]", entries)
+			}
+		})
+	}
+}
+
+func TestPurger_Concurrent(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache cache.ResourceCache
+	}{
+		{"OnMemoryCache", cache.NewOnMemoryCache()},
+		{"BoundedInMemoryCache", cache.NewBoundedInMemoryCache(10)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.cache
+			p := c.(cache.Purger)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						url := fmt.Sprintf("https://example.com/%d/%d.html", i, j)
+						c.Store(makeResource(url))
+						c.Lookup(makeRequest(url))
+					}
+				}(i)
+			}
+			for j := 0; j < 100; j++ {
+				p.Entries()
+				p.Purge(fmt.Sprintf("https://example.com/0/%d.html", j))
+			}
+			wg.Wait()
+
+			// The variants of the same URL stored at once are all kept.
+			const url = "https://example.com/variants.html"
+			langs := []string{"de", "en", "fr", "ja"}
+			for j := 0; j < 100; j++ {
+				start := make(chan struct{})
+				for _, lang := range langs {
+					wg.Add(1)
+					go func(r *resource.Resource) {
+						defer wg.Done()
+						<-start
+						c.Store(r)
+					}(makeVariant(url, lang))
+				}
+				close(start)
+				wg.Wait()
+				if got := p.Purge(url); got != len(langs) {
+					t.Fatalf("p.Purge(variants) = %v, want %v", got, len(langs))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/webpackager/resource"
+)
+
+// MatchVariant returns the first Resource in variants matching req, that
+// is, whose VaryHeader fields have the same values in req. It returns nil
+// when no Resource matches.
+func MatchVariant(variants []*resource.Resource, req *http.Request) *resource.Resource {
+	for _, r := range variants {
+		if varyMatches(r.VaryHeader, req.Header) {
+			return r
+		}
+	}
+	return nil
+}
+
+// AddVariant returns a new slice of variants with r added. r replaces the
+// existing Resource with the same VaryHeader, if any. AddVariant does not
+// modify variants, so it is safe to use with the slices shared among
+// goroutines.
+func AddVariant(variants []*resource.Resource, r *resource.Resource) []*resource.Resource {
+	added := make([]*resource.Resource, 0, len(variants)+1)
+	added = append(added, r)
+	for _, v := range variants {
+		if !sameVary(v.VaryHeader, r.VaryHeader) {
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+func varyMatches(vary, header http.Header) bool {
+	for key, values := range vary {
+		if joinValues(header[key]) != joinValues(values) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameVary(a, b http.Header) bool {
+	return len(a) == len(b) && varyMatches(a, b)
+}
+
+func joinValues(values []string) string {
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/webpackager/resource"
+	"github.com/google/webpackager/resource/cache"
+)
+
+func makeVariant(rawurl string, lang string) *resource.Resource {
+	r := makeResource(rawurl)
+	r.VaryHeader = http.Header{"Accept-Language": nil}
+	if lang != "" {
+		r.VaryHeader.Set("Accept-Language", lang)
+	}
+	return r
+}
+
+func TestCacheVariants(t *testing.T) {
+	const url = "https://example.com/foo.html"
+	en := makeVariant(url, "en")
+	ja := makeVariant(url, "ja")
+	none := makeVariant(url, "")
+
+	caches := map[string]cache.ResourceCache{
+		"OnMemoryCache": cache.NewOnMemoryCache(),
+		"BoundedCache":  cache.NewBoundedInMemoryCache(10),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			for _, r := range []*resource.Resource{en, ja, none} {
+				if err := c.Store(r); err != nil {
+					t.Fatalf("Store() = error(%q), want success", err)
+				}
+			}
+			tests := []struct {
+				lang string
+				want *resource.Resource
+			}{
+				{"en", en},
+				{"ja", ja},
+				{"", none},
+				{"fr", nil},
+			}
+			for _, test := range tests {
+				req := makeRequest(url)
+				if test.lang != "" {
+					req.Header.Set("Accept-Language", test.lang)
+				}
+				got, err := c.Lookup(req)
+				if err != nil {
+					t.Errorf("Lookup(%q) = error(%q), want success", test.lang, err)
+				}
+				if got != test.want {
+					t.Errorf("Lookup(%q) = %v, want %v", test.lang, got, test.want)
+				}
+			}
+
+			// Storing the same variant again replaces the old one.
+			en2 := makeVariant(url, "en")
+			c.Store(en2)
+			req := makeRequest(url)
+			req.Header.Set("Accept-Language", "en")
+			if got, _ := c.Lookup(req); got != en2 {
+				t.Errorf("Lookup(%q) = %p, want %p", "en", got, en2)
+			}
+		})
+	}
+}
@@ -35,11 +35,21 @@ func NewLink(u *url.URL, rel string) *Link {
 	return &Link{u, p}
 }
 
-// IsPreload reports whether the Link involves preloading of the resource.
+// IsPreload reports whether the Link involves preloading of the resource,
+// namely whether the Link has rel="preload" or rel="modulepreload".
 func (l *Link) IsPreload() bool {
 	// TODO(yuizumi): Maybe include rel="prefetch" and similar.
+	return l.hasRel(RelPreload) || l.hasRel(RelModulePreload)
+}
+
+// IsModulePreload reports whether the Link has rel="modulepreload".
+func (l *Link) IsModulePreload() bool {
+	return l.hasRel(RelModulePreload)
+}
+
+func (l *Link) hasRel(rel string) bool {
 	for _, s := range strings.Fields(l.Params.Get(ParamRel)) {
-		if strings.EqualFold(s, RelPreload) {
+		if strings.EqualFold(s, rel) {
 			return true
 		}
 	}
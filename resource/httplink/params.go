@@ -29,12 +29,15 @@ const (
 	ParamCrossOrigin = "crossorigin"
 	ParamMedia       = "media"
 	ParamType        = "type"
+	ParamImageSrcset = "imagesrcset"
+	ParamImageSizes  = "imagesizes"
 )
 
 // Special parameter values recognized by LinkParams.
 const (
 	// Value(s) for the "rel" parameter.
-	RelPreload = "preload"
+	RelPreload       = "preload"
+	RelModulePreload = "modulepreload"
 
 	// Value(s) for the "crossorigin" parameter.
 	CrossOriginAnonymous = "anonymous"
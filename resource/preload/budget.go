@@ -0,0 +1,45 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preload
+
+import (
+	"sync"
+)
+
+// Budget represents the remaining amount of bytes allowed for preloading.
+// It is safe for concurrent use.
+type Budget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// NewBudget creates and initializes a new Budget with the given number of
+// bytes.
+func NewBudget(bytes int) *Budget {
+	return &Budget{remaining: bytes}
+}
+
+// Consume deducts n bytes from b and reports true if they fit in b. It leaves
+// b unchanged and reports false otherwise.
+func (b *Budget) Consume(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > b.remaining {
+		return false
+	}
+	b.remaining -= n
+	return true
+}
@@ -47,6 +47,26 @@ type Preload struct {
 	// resources when the preload offers more than one option, such as images
 	// with multi-source ("imagesrcset") or content negotiations ("variants").
 	Resources []*resource.Resource
+
+	// Integrity specifies the Subresource Integrity metadata (the value of
+	// the integrity attribute, e.g. "sha384-...") which the payloads of
+	// Resources must match. The packager verifies the payloads against it
+	// and fails to produce the signed exchanges on mismatch. Empty implies
+	// no verification.
+	//
+	// Integrity is not included in the Link header.
+	Integrity string
+
+	// Budget, if non-nil, limits the total size of resources preloaded
+	// together with this Preload. The packager drops the Preload when its
+	// resources do not fit in the remaining Budget. Preloads sharing the same
+	// Budget are admitted on a first-come-first-served basis.
+	Budget *Budget
+
+	// Module indicates the preload is for JavaScript modules. The packager
+	// marks the responses of Resources as modules, so their static imports
+	// are preloaded as well (see jsproc.ExtractModuleImports).
+	Module bool
 }
 
 // NewPreloadForURL creates and initializes a new Preload to preload u.
@@ -60,7 +80,7 @@ func NewPreloadForURL(u *url.URL, as string) *Preload {
 	if as != "" {
 		link.Params.Set(httplink.ParamAs, as)
 	}
-	return &Preload{link, []*resource.Resource{resource.NewResource(u)}}
+	return &Preload{Link: link, Resources: []*resource.Resource{resource.NewResource(u)}}
 }
 
 // NewPreloadForLink creates and initializes a new Preload to perform
@@ -68,10 +88,26 @@ func NewPreloadForURL(u *url.URL, as string) *Preload {
 // a new single Resource requesting to link.URL. Note it implies link.URL
 // should be absolute.
 //
-// NewPreloadForLink assumes link.IsPreload() to be true.
+// NewPreloadForLink assumes link.IsPreload() to be true. When link has
+// rel="modulepreload", NewPreloadForLink translates it to the equivalent
+// rel="preload" since signed exchange caches only accept the latter: the new
+// Preload has a copy of link with "as" set to "script" and "crossorigin" to
+// "anonymous" unless specified, and has Module set to true. link itself is
+// never modified.
 func NewPreloadForLink(link *httplink.Link) *Preload {
+	module := link.IsModulePreload()
+	if module {
+		link = &httplink.Link{URL: link.URL, Params: link.Params.Clone()}
+		link.Params.Set(httplink.ParamRel, httplink.RelPreload)
+		if link.Params.Get(httplink.ParamAs) == "" {
+			link.Params.Set(httplink.ParamAs, AsScript)
+		}
+		if link.Params.Get(httplink.ParamCrossOrigin) == "" {
+			link.Params.Set(httplink.ParamCrossOrigin, httplink.CrossOriginAnonymous)
+		}
+	}
 	r := resource.NewResource(link.URL)
-	return &Preload{link, []*resource.Resource{r}}
+	return &Preload{Link: link, Resources: []*resource.Resource{r}, Module: module}
 }
 
 // NewPreloadForResource creates and initializes a new Preload to preload
@@ -84,5 +120,5 @@ func NewPreloadForResource(r *resource.Resource, as string) *Preload {
 	if as != "" {
 		link.Params.Set(httplink.ParamAs, as)
 	}
-	return &Preload{link, []*resource.Resource{r}}
+	return &Preload{Link: link, Resources: []*resource.Resource{r}}
 }
@@ -20,9 +20,11 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/google/webpackager/resource/httplink"
 )
 
 // Resource represents a resource for which a signed exchange is generated.
@@ -60,6 +62,19 @@ type Resource struct {
 	//
 	// Integrity is set by the SetExchange method.
 	Integrity string
+
+	// Dependencies represents the preload links for the modules imported by
+	// this resource, a JavaScript module loaded as a subresource, which its
+	// signed exchange cannot carry. The Packager adds them to the signed
+	// exchange of the main resource.
+	Dependencies []*httplink.Link
+
+	// VaryHeader holds the request header fields this resource may vary on
+	// besides the URL (see webpackager.Config.CacheVaryHeaders), with the
+	// values it was fetched with. The fields absent in the request are
+	// present with no values. ResourceCache implementations use VaryHeader
+	// to tell the variants of the same URL apart.
+	VaryHeader http.Header
 }
 
 // NewResource creates and initializes a new Resource for url.
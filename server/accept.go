@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/WICG/webpackage/go/signedexchange/version"
+)
+
+// mediaRange is an element of the Accept header.
+type mediaRange struct {
+	mediaType string
+	params    map[string]string
+	q         float64
+}
+
+// parseAccept parses the Accept header values. Malformed elements are
+// skipped. The media types and the parameter names are lowercased.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			if strings.TrimSpace(elem) == "" {
+				continue
+			}
+			mediaType, params, err := mime.ParseMediaType(elem)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(s, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+				delete(params, "q")
+			}
+			ranges = append(ranges, mediaRange{mediaType, params, q})
+		}
+	}
+	return ranges
+}
+
+// prefersExchange reports whether the Accept header values prefer the signed
+// exchange of version v over any other content: application/signed-exchange
+// with the matching v= parameter must have a nonzero q-value and no other
+// media range may have a higher q-value. Wildcards like "*/*" do not count
+// as accepting signed exchanges.
+func prefersExchange(accept []string, v version.Version) bool {
+	wantV := strings.TrimPrefix(string(v), "1")
+	sxgQ, otherQ := 0.0, 0.0
+	for _, r := range parseAccept(accept) {
+		if r.mediaType == mimeTypeExchange {
+			if r.params["v"] == wantV && r.q > sxgQ {
+				sxgQ = r.q
+			}
+			continue // Other versions are not acceptable to us.
+		}
+		if r.q > otherQ {
+			otherQ = r.q
+		}
+	}
+	return sxgQ > 0 && sxgQ >= otherQ
+}
@@ -0,0 +1,274 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/webpackager/certchain/certmanager"
+	"github.com/google/webpackager/resource/cache"
+	"github.com/google/webpackager/server/tomlconfig"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+)
+
+const (
+	mimeTypeJSON = "application/json"
+
+	redacted = "REDACTED"
+)
+
+// AdminHandler serves the administrative endpoints to inspect and operate
+// a running Server. Every request must have the Authorization header with
+// the bearer token. See cmd/webpkgserver/webpkgserver.example.toml for the
+// list of the endpoints.
+//
+// AdminHandler should be served on a listener separate from the Server and
+// not exposed to the public.
+type AdminHandler struct {
+	mux    *http.ServeMux
+	server *Server
+	token  string
+}
+
+var _ http.Handler = (*AdminHandler)(nil)
+
+// NewAdminHandler creates and initializes a new AdminHandler for s, which
+// accepts the requests with token. token must be non-empty.
+func NewAdminHandler(s *Server, token string) *AdminHandler {
+	if token == "" {
+		panic("server: empty admin token")
+	}
+	h := &AdminHandler{new(http.ServeMux), s, token}
+
+	h.mux.HandleFunc("/certs", h.handleCerts)
+	h.mux.HandleFunc("/certs/ocsp", h.handleCertsRefresh)
+	h.mux.HandleFunc("/certs/renew", h.handleCertsRefresh)
+	h.mux.HandleFunc("/cache", h.handleCache)
+	h.mux.HandleFunc("/cache/purge", h.handleCachePurge)
+	h.mux.HandleFunc("/config", h.handleConfig)
+	h.mux.HandleFunc("/fetch/stats", h.handleFetchStats)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="webpkgserver"`)
+		replyError(w, http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, req)
+}
+
+func (h *AdminHandler) authorized(req *http.Request) bool {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	token := auth[len(prefix):]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// adminCert describes a certificate chain in the /certs response.
+type adminCert struct {
+	Digest         string     `json:"digest"`
+	SANs           []string   `json:"sans"`
+	NotAfter       time.Time  `json:"notAfter"`
+	OCSPNextUpdate *time.Time `json:"ocspNextUpdate,omitempty"`
+}
+
+func (h *AdminHandler) handleCerts(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	certs := []adminCert{}
+	for _, m := range h.server.currentCertManagers() {
+		ac := m.GetAugmentedChain()
+		if ac == nil {
+			continue
+		}
+		cert := adminCert{
+			Digest:   ac.Digest,
+			SANs:     ac.Leaf.DNSNames,
+			NotAfter: ac.Leaf.NotAfter,
+		}
+		if ac.OCSPResp != nil && ac.OCSPResp.Response != nil {
+			cert.OCSPNextUpdate = &ac.OCSPResp.NextUpdate
+		}
+		certs = append(certs, cert)
+	}
+	replyJSON(w, certs)
+}
+
+// handleCertsRefresh handles /certs/ocsp and /certs/renew. The "digest"
+// parameter selects the certificate chain; all chains are refreshed when
+// it is absent.
+func (h *AdminHandler) handleCertsRefresh(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	refresh := (*certmanager.Manager).RefreshOCSPResp
+	if req.URL.Path == "/certs/renew" {
+		refresh = (*certmanager.Manager).RenewRawChain
+	}
+	digest := req.URL.Query().Get("digest")
+
+	var errs *multierror.Error
+	found := false
+	for _, m := range h.server.currentCertManagers() {
+		if digest != "" {
+			ac := m.GetAugmentedChain()
+			if ac == nil || ac.Digest != digest {
+				continue
+			}
+		}
+		found = true
+		errs = multierror.Append(errs, refresh(m))
+	}
+	if !found {
+		replyError(w, http.StatusNotFound)
+		return
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		replyServerError(w, xerrors.Errorf("refreshing certificates: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminCacheEntry describes a Resource in the /cache response.
+type adminCacheEntry struct {
+	URL       string      `json:"url"`
+	Vary      http.Header `json:"vary,omitempty"`
+	Integrity string      `json:"integrity,omitempty"`
+}
+
+func (h *AdminHandler) handleCache(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := h.server.currentResourceCache().(cache.Purger)
+	if !ok {
+		replyError(w, http.StatusNotImplemented)
+		return
+	}
+	entries := []adminCacheEntry{}
+	for _, r := range p.Entries() {
+		entries = append(entries, adminCacheEntry{
+			URL:       r.RequestURL.String(),
+			Vary:      r.VaryHeader,
+			Integrity: r.Integrity,
+		})
+	}
+	replyJSON(w, entries)
+}
+
+func (h *AdminHandler) handleCachePurge(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	url := req.URL.Query().Get("url")
+	if url == "" {
+		replyClientError(w, xerrors.New("missing url parameter"))
+		return
+	}
+	p, ok := h.server.currentResourceCache().(cache.Purger)
+	if !ok {
+		replyError(w, http.StatusNotImplemented)
+		return
+	}
+	replyJSON(w, map[string]int{"purged": p.Purge(url)})
+}
+
+func (h *AdminHandler) handleConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	c := h.server.currentTOMLConfig()
+	if c == nil {
+		replyError(w, http.StatusNotFound)
+		return
+	}
+	replyJSON(w, redactConfig(c))
+}
+
+// adminFetchStats is the /fetch/stats response.
+type adminFetchStats struct {
+	Requests int64 `json:"requests"`
+	Retries  int64 `json:"retries"`
+	Failures int64 `json:"failures"`
+	Rejected int64 `json:"rejected"`
+}
+
+func (h *AdminHandler) handleFetchStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		replyError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	rc := h.server.currentRetryClient()
+	if rc == nil {
+		replyError(w, http.StatusNotImplemented)
+		return
+	}
+	stats := rc.Stats()
+	replyJSON(w, adminFetchStats{
+		Requests: stats.Requests,
+		Retries:  stats.Retries,
+		Failures: stats.Failures,
+		Rejected: stats.Rejected,
+	})
+}
+
+// redactConfig returns a copy of c with the secrets redacted.
+func redactConfig(c *tomlconfig.Config) *tomlconfig.Config {
+	r := *c
+	if r.SXG.ACME.EABHmac != "" {
+		r.SXG.ACME.EABHmac = redacted
+	}
+	r.Identity = append([]tomlconfig.IdentityConfig(nil), c.Identity...)
+	for i := range r.Identity {
+		if r.Identity[i].ACME.EABHmac != "" {
+			r.Identity[i].ACME.EABHmac = redacted
+		}
+	}
+	if c.Fetch.CustomHeaders != nil {
+		r.Fetch.CustomHeaders = make(map[string]string, len(c.Fetch.CustomHeaders))
+		for key := range c.Fetch.CustomHeaders {
+			r.Fetch.CustomHeaders[key] = redacted
+		}
+	}
+	return &r
+}
+
+func replyJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		replyServerError(w, xerrors.Errorf("encoding json: %w", err))
+		return
+	}
+	replyOK(w, append(body, '\n'), mimeTypeJSON)
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/webpackager/certchain/certmanager"
+	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/internal/timeutil"
+	"github.com/google/webpackager/server"
+)
+
+const (
+	adminToken = "s3cret"
+	testDigest = "qwk4hz4Swff9wKMvr1hri3YH4MeFAH8_PE9jnJ9nx6A"
+)
+
+// setupAdmin starts a Server with setupServer and an admin server for it.
+// It waits until the certificate chain becomes available.
+func setupAdmin(t *testing.T, www *httptest.Server) (*server.Server, string, *httptest.Server) {
+	return setupAdminWithConfig(t, www, nil)
+}
+
+// setupAdminWithConfig is like setupAdmin, but lets configure mutate the
+// server.Config before the server is created.
+func setupAdminWithConfig(t *testing.T, www *httptest.Server, configure func(*server.Config)) (*server.Server, string, *httptest.Server) {
+	var m *certmanager.Manager
+	s, addr := setupServerWithConfig(www, func(c *server.Config) {
+		m = c.CertManager
+		if configure != nil {
+			configure(c)
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for m.GetAugmentedChain() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate chain not available")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s, addr, httptest.NewServer(server.NewAdminHandler(s, adminToken))
+}
+
+func doAdmin(t *testing.T, method, url, token string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAdmin_Unauthorized(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, _, admin := setupAdmin(t, www)
+	defer s.Close()
+	defer admin.Close()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"NoToken", ""},
+		{"WrongToken", "wrong"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := doAdmin(t, http.MethodGet, admin.URL+"/certs", test.token)
+			defer resp.Body.Close()
+			if got := resp.StatusCode; got != http.StatusUnauthorized {
+				t.Errorf("StatusCode = %v, want %v", got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestAdmin_Certs(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, _, admin := setupAdmin(t, www)
+	defer s.Close()
+	defer admin.Close()
+
+	resp := doAdmin(t, http.MethodGet, admin.URL+"/certs", adminToken)
+	defer resp.Body.Close()
+	if got := resp.StatusCode; got != http.StatusOK {
+		t.Fatalf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+	var certs []struct {
+		Digest         string
+		OCSPNextUpdate *time.Time
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 {
+		t.Fatalf("len(certs) = %d, want 1", len(certs))
+	}
+	if got := certs[0].Digest; got != testDigest {
+		t.Errorf("digest = %q, want %q", got, testDigest)
+	}
+	if certs[0].OCSPNextUpdate == nil {
+		t.Errorf("ocspNextUpdate = nil, want non-nil")
+	}
+}
+
+func TestAdmin_CertsRefresh(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, _, admin := setupAdmin(t, www)
+	defer s.Close()
+	defer admin.Close()
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"OCSP", "/certs/ocsp", http.StatusNoContent},
+		{"OCSPWithDigest", "/certs/ocsp?digest=" + testDigest, http.StatusNoContent},
+		{"Renew", "/certs/renew", http.StatusNoContent},
+		{"UnknownDigest", "/certs/ocsp?digest=unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := doAdmin(t, http.MethodPost, admin.URL+test.path, adminToken)
+			defer resp.Body.Close()
+			if got := resp.StatusCode; got != test.want {
+				t.Errorf("StatusCode = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdmin_Cache(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, addr, admin := setupAdmin(t, www)
+	defer s.Close()
+	defer admin.Close()
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	const signURL = "https://example.com/public/hello.html"
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/priv/doc/"+signURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Accept", "application/signed-exchange;v=b3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.StatusCode; got != http.StatusOK {
+		t.Fatalf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+
+	listCache := func() []string {
+		t.Helper()
+		resp := doAdmin(t, http.MethodGet, admin.URL+"/cache", adminToken)
+		defer resp.Body.Close()
+		var entries []struct{ URL string }
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		var urls []string
+		for _, e := range entries {
+			urls = append(urls, e.URL)
+		}
+		return urls
+	}
+
+	if diff := cmp.Diff([]string{signURL}, listCache()); diff != "" {
+		t.Errorf("GET /cache mismatch (-want +got):\n%s", diff)
+	}
+
+	resp = doAdmin(t, http.MethodPost, admin.URL+"/cache/purge?url="+signURL, adminToken)
+	defer resp.Body.Close()
+	var purged struct{ Purged int }
+	if err := json.NewDecoder(resp.Body).Decode(&purged); err != nil {
+		t.Fatal(err)
+	}
+	if purged.Purged != 1 {
+		t.Errorf("purged = %d, want 1", purged.Purged)
+	}
+
+	if got := listCache(); len(got) != 0 {
+		t.Errorf("GET /cache after purge = %q, want empty", got)
+	}
+}
+
+func TestAdmin_FetchStats(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	var rc *fetch.RetryClient
+	s, addr, admin := setupAdminWithConfig(t, www, func(c *server.Config) {
+		rc = fetch.WithRetry(c.Packager.FetchClient, fetch.RetryConfig{})
+		c.Packager.FetchClient = rc
+		c.RetryClient = rc
+	})
+	defer s.Close()
+	defer admin.Close()
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/priv/doc/https://example.com/public/hello.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Accept", "application/signed-exchange;v=b3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp = doAdmin(t, http.MethodGet, admin.URL+"/fetch/stats", adminToken)
+	defer resp.Body.Close()
+	if got := resp.StatusCode; got != http.StatusOK {
+		t.Fatalf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+	var got fetch.RetryStats
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (fetch.RetryStats{Requests: 1}); got != want {
+		t.Errorf("GET /fetch/stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestAdmin_FetchStatsDisabled(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, _ := setupServer(www)
+	defer s.Close()
+	admin := httptest.NewServer(server.NewAdminHandler(s, adminToken))
+	defer admin.Close()
+
+	resp := doAdmin(t, http.MethodGet, admin.URL+"/fetch/stats", adminToken)
+	resp.Body.Close()
+	if got := resp.StatusCode; got != http.StatusNotImplemented {
+		t.Errorf("StatusCode = %v, want %v", got, http.StatusNotImplemented)
+	}
+}
@@ -99,5 +99,13 @@ available." The request looks like:
 
 where "/webpkg/validity" can be customized through ValidityPath. It does not
 take any argument, such as the document URL, at this moment.
+
+The doc handler serves the signed exchange only when the Accept header prefers
+it to any other media type. Otherwise, it rejects the request, or in the
+reverse-proxy mode (ReverseProxy in tomlconfig.ServerConfig), forwards the
+request to the origin server. In the reverse-proxy mode, Handler also takes
+the requests to any other paths as the requests for the same path on the
+host in the Host header, and serves either the signed exchange or the origin
+response depending on the Accept header.
 */
 package server
@@ -16,23 +16,31 @@ package server
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/google/webpackager/certchain/certmanager/acmeclient"
 
 	"github.com/google/webpackager"
 	"github.com/google/webpackager/certchain/certchainutil"
 	"github.com/google/webpackager/certchain/certmanager"
+	"github.com/google/webpackager/exchange"
 	"github.com/google/webpackager/exchange/vprule"
 	"github.com/google/webpackager/fetch"
 	"github.com/google/webpackager/processor"
 	"github.com/google/webpackager/processor/complexproc"
+	"github.com/google/webpackager/processor/execproc"
 	"github.com/google/webpackager/processor/htmlproc"
 	"github.com/google/webpackager/processor/htmlproc/htmltask"
 	"github.com/google/webpackager/processor/preverify"
@@ -43,13 +51,70 @@ import (
 	"github.com/hashicorp/go-multierror"
 )
 
+// tomlState keeps the TOML config a Server was created from, along with the
+// CertManagers and the ResourceCache created for it, for ReloadTOMLConfig.
+type tomlState struct {
+	config   *tomlconfig.Config
+	managers map[certSettings]*certmanager.Manager
+	cache    cache.ResourceCache
+}
+
+// certSettings is the part of [SXG] or [[Identity]] to determine the
+// CertManager.
+type certSettings struct {
+	Cert tomlconfig.SXGCertConfig
+	ACME tomlconfig.SXGACMEConfig
+}
+
+// certManagerPool creates the CertManagers, reusing those in reuse with
+// the same settings.
+type certManagerPool struct {
+	reuse    map[certSettings]*certmanager.Manager
+	made     map[certSettings]*certmanager.Manager
+	managers []*certmanager.Manager // In the order of creation.
+}
+
+func newCertManagerPool(reuse map[certSettings]*certmanager.Manager) *certManagerPool {
+	return &certManagerPool{reuse: reuse, made: make(map[certSettings]*certmanager.Manager)}
+}
+
+func (p *certManagerPool) get(sc *tomlconfig.SXGConfig) (*certmanager.Manager, error) {
+	key := certSettings{sc.Cert, sc.ACME}
+	if m, ok := p.made[key]; ok {
+		return m, nil
+	}
+	m, ok := p.reuse[key]
+	if !ok {
+		var err error
+		if m, err = makeCertManager(sc); err != nil {
+			return nil, err
+		}
+	}
+	p.made[key] = m
+	p.managers = append(p.managers, m)
+	return m, nil
+}
+
+// allowTestCert returns the CertManagers made for the certificates with
+// AllowTestCert, for Config.AllowTestCertFor.
+func (p *certManagerPool) allowTestCert() map[*certmanager.Manager]bool {
+	allow := make(map[*certmanager.Manager]bool)
+	for key, m := range p.made {
+		if key.Cert.AllowTestCert {
+			allow[m] = true
+		}
+	}
+	return allow
+}
+
 // FromTOMLConfig creates and initializes a Server from TOML config.
 func FromTOMLConfig(c *tomlconfig.Config) (*Server, error) {
 	var errs *multierror.Error
 
 	tlsConfig, err := makeTLSConfig(c)
 	errs = multierror.Append(errs, err)
-	exchangeFactory, err := makeExchangeFactory(c)
+	pool := newCertManagerPool(nil)
+	config, err := makeConfig(c, pool, nil)
 	errs = multierror.Append(errs, err)
 
 	if err := errs.ErrorOrNil(); err != nil {
@@ -61,23 +126,135 @@ func FromTOMLConfig(c *tomlconfig.Config) (*Server, error) {
 			c.Listen.Host,
 			strconv.Itoa(c.Listen.Port),
 		),
-		TLSConfig: tlsConfig,
-		// TODO(yuizumi): Allow changing timeouts in config.
-		ReadTimeout:       10 * time.Second,
-		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      60 * time.Second,
-		IdleTimeout:       120 * time.Second,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       c.Listen.GetReadTimeout(),
+		ReadHeaderTimeout: c.Listen.GetReadHeaderTimeout(),
+		WriteTimeout:      c.Listen.GetWriteTimeout(),
+		IdleTimeout:       c.Listen.GetIdleTimeout(),
+	}
+
+	s := NewServer(server, config)
+	s.toml = &tomlState{c, pool.made, config.Packager.ResourceCache}
+	return s, nil
+}
+
+// ReloadTOMLConfig replaces the config of s, created by FromTOMLConfig, with
+// new TOML config c through s.Reload. Packager is created anew from c, with
+// the new fetch client and processors, while the CertManagers are reused for
+// the unchanged certificate settings. The resource cache is also reused,
+// keeping the cached signed exchanges, unless [Cache] has changed or c would
+// produce different signed exchanges (see sameResources). The changes to
+// [Listen] require a restart and are ignored with a warning. On error, s keeps
+// the old config. ReloadTOMLConfig must not be called concurrently.
+func (s *Server) ReloadTOMLConfig(c *tomlconfig.Config) error {
+	s.mu.Lock()
+	old := s.toml
+	s.mu.Unlock()
+	if old == nil {
+		return errors.New("server not created from TOML config")
+	}
+	if c.Listen != old.config.Listen {
+		log.Print("warning: [Listen] changes take effect only after restart")
+	}
+	if c.Admin != old.config.Admin {
+		log.Print("warning: [Admin] changes take effect only after restart")
+	}
+	var reuseCache cache.ResourceCache
+	if c.Cache == old.config.Cache && sameResources(c, old.config) {
+		reuseCache = old.cache
+	}
+	pool := newCertManagerPool(old.managers)
+	config, err := makeConfig(c, pool, reuseCache)
+	if err != nil {
+		return err
+	}
+	if err := s.Reload(config); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.toml = &tomlState{c, pool.made, config.Packager.ResourceCache}
+	s.mu.Unlock()
+	return nil
+}
+
+// sameResources reports whether a and b produce the same signed exchanges,
+// thus the resources cached under a remain valid under b. They may differ
+// only in the sections and the settings affecting neither what is fetched
+// nor how it is processed and signed.
+func sameResources(a, b *tomlconfig.Config) bool {
+	return reflect.DeepEqual(resourceSettings(a), resourceSettings(b))
+}
+
+func resourceSettings(c *tomlconfig.Config) tomlconfig.Config {
+	r := *c
+	r.Listen = tomlconfig.ListenConfig{}
+	r.Relay = tomlconfig.RelayConfig{}
+	r.Cache = tomlconfig.CacheConfig{}
+	r.Admin = tomlconfig.AdminConfig{}
+	r.Fetch = tomlconfig.FetchConfig{
+		ForwardHeaders: c.Fetch.ForwardHeaders,
+		CustomHeaders:  c.Fetch.CustomHeaders,
+	}
+	return r
+}
+
+// AdminServerFromTOMLConfig creates an http.Server to serve AdminHandler for
+// s as configured in the [Admin] section of c. It returns nil if the admin
+// endpoints are disabled.
+func AdminServerFromTOMLConfig(s *Server, c *tomlconfig.Config) (*http.Server, error) {
+	if !c.Admin.Enable {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(c.Admin.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("no token found in %s", c.Admin.TokenFile)
+	}
+	return &http.Server{
+		Addr: net.JoinHostPort(
+			c.Admin.Host,
+			strconv.Itoa(c.Admin.Port),
+		),
+		Handler:           NewAdminHandler(s, token),
+		ReadTimeout:       c.Listen.GetReadTimeout(),
+		ReadHeaderTimeout: c.Listen.GetReadHeaderTimeout(),
+		WriteTimeout:      c.Listen.GetWriteTimeout(),
+		IdleTimeout:       c.Listen.GetIdleTimeout(),
+	}, nil
+}
+
+// makeConfig creates the Config for Handler from c, except for the [Listen]
+// section. The CertManagers are taken from pool. resourceCache is used for
+// Packager if non-nil; otherwise a new one is created as configured in c.
+func makeConfig(c *tomlconfig.Config, pool *certManagerPool, resourceCache cache.ResourceCache) (Config, error) {
+	var errs *multierror.Error
+
+	exchangeFactory, err := makeExchangeFactory(c, pool)
+	errs = multierror.Append(errs, err)
+	fetchClient, proxyClient, retryClient, err := makeFetchClient(c)
+	errs = multierror.Append(errs, err)
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return Config{}, err
 	}
 
 	pc := webpackager.Config{
-		FetchClient:     makeFetchClient(c),
+		RequestTweaker:  makeRequestTweaker(c),
+		FetchClient:     fetchClient,
 		ValidityURLRule: makeValidityURLRule(c),
 		Processor:       makeProcessor(c),
 		ValidPeriodRule: makeValidPeriodRule(c),
 		ExchangeFactory: exchangeFactory,
+		// CustomHeaders are constant, thus do not make the resources vary.
+		CacheVaryHeaders: c.Fetch.ForwardHeaders,
 	}
 
-	if size := c.Cache.MaxEntries; size > 0 {
+	if resourceCache != nil {
+		pc.ResourceCache = resourceCache
+	} else if size := c.Cache.MaxEntries; size > 0 {
 		pc.ResourceCache = cache.NewBoundedInMemoryCache(size)
 	} else if size == 0 {
 		pc.ResourceCache = cache.NilCache()
@@ -86,13 +263,23 @@ func FromTOMLConfig(c *tomlconfig.Config) (*Server, error) {
 	}
 
 	config := Config{
-		Packager:      webpackager.NewPackager(pc),
-		CertManager:   exchangeFactory.CertManager,
-		ServerConfig:  c.Server,
-		AllowTestCert: c.SXG.Cert.AllowTestCert,
+		Packager:         webpackager.NewPackager(pc),
+		CertManagers:     pool.managers,
+		ServerConfig:     c.Server,
+		AllowTestCertFor: pool.allowTestCert(),
+		ProxyClient:      proxyClient,
+		RetryClient:      retryClient,
+		Relay: RelayConfig{
+			SizeLimit:   c.Relay.SizeLimit,
+			Redirects:   c.Relay.Redirects,
+			NotFoundTTL: c.Relay.GetNotFoundTTL(),
+		},
+	}
+	if len(c.Fetch.ForwardHeaders) > 0 {
+		config.RequestTweaker = fetch.CopyParentHeaders(c.Fetch.ForwardHeaders)
 	}
 
-	return NewServer(server, config), nil
+	return config, nil
 }
 
 func makeTLSConfig(c *tomlconfig.Config) (*tls.Config, error) {
@@ -109,47 +296,246 @@ func makeTLSConfig(c *tomlconfig.Config) (*tls.Config, error) {
 	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
 }
 
-func makeFetchClient(c *tomlconfig.Config) fetch.FetchClient {
+// makeFetchClient returns the FetchClient for Packager, which only fetches
+// the URLs covered by [[Sign]] sections, and the one for the reverse-proxy
+// mode, which fetches any URLs on their domains. It also returns the
+// RetryClient underlying both, or nil if retries and the circuit breaker
+// are disabled.
+func makeFetchClient(c *tomlconfig.Config) (fetch.FetchClient, fetch.FetchClient, *fetch.RetryClient, error) {
 	allow := make([]urlmatcher.Matcher, len(c.Sign))
+	domains := make([]urlmatcher.Matcher, len(c.Sign))
 	for i, uc := range c.Sign {
-		allow[i] = urlmatcher.AllOf(
+		allow[i] = makeURLMatcher(&uc)
+		domains[i] = urlmatcher.AllOf(
 			urlmatcher.HasScheme("https"),
 			urlmatcher.HasHostname(uc.Domain),
-			urlmatcher.HasEscapedPathRegexp(uc.GetPathRE()),
-			urlmatcher.HasRawQueryRegexp(uc.GetQueryRE()),
 		)
 	}
 	selector := &fetch.Selector{Allow: allow}
-	return fetch.WithSelector(fetch.DefaultFetchClient, selector)
+
+	guarded := fetch.NewGuardedFetchClient(&fetch.AddressGuard{
+		AllowedNets: c.Fetch.GetAllowedNetworks(),
+	})
+	guarded.Timeout = c.Fetch.GetTimeout()
+	var client fetch.FetchClient = guarded
+	overrides, err := makeOriginOverrides(c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(overrides) > 0 {
+		client = fetch.WithOriginOverrides(client, overrides)
+	}
+	if fc := &c.Fetch; fc.RequestsPerSecond > 0 || fc.MaxConcurrency > 0 || fc.RespectRetryAfter {
+		client = fetch.WithPoliteness(client, fetch.PolitenessConfig{
+			RequestsPerSecond: fc.RequestsPerSecond,
+			Burst:             fc.Burst,
+			MaxConcurrency:    fc.MaxConcurrency,
+			RespectRetryAfter: fc.RespectRetryAfter,
+			MaxRetryAfter:     fc.GetMaxRetryAfter(),
+		})
+	}
+	var retryClient *fetch.RetryClient
+	if fc := &c.Fetch; fc.MaxRetries > 0 || fc.BreakerThreshold > 0 {
+		config := fetch.RetryConfig{
+			MaxRetries:       fc.MaxRetries,
+			RetryStatusCodes: fc.RetryStatusCodes, // nil implies the default.
+			BreakerThreshold: fc.BreakerThreshold,
+			BreakerCooldown:  fc.GetBreakerCooldown(),
+		}
+		if config.MaxRetries == 0 {
+			config.MaxRetries = -1
+		}
+		if config.BreakerThreshold == 0 {
+			config.BreakerThreshold = -1
+		}
+		retryClient = fetch.WithRetry(client, config)
+		client = retryClient
+	}
+	proxyClient := fetch.WithSelector(client, &fetch.Selector{Allow: domains})
+	return fetch.WithSelector(client, selector), proxyClient, retryClient, nil
+}
+
+func makeOriginOverrides(c *tomlconfig.Config) ([]fetch.OriginOverride, error) {
+	var overrides []fetch.OriginOverride
+	for _, uc := range c.Sign {
+		bc := uc.Backend
+		if bc == nil {
+			continue
+		}
+		backend, err := url.Parse(bc.URL)
+		if err != nil {
+			return nil, err
+		}
+		o := fetch.OriginOverride{
+			Hostname:   uc.Domain,
+			Backend:    backend,
+			ServerName: bc.ServerName,
+			Timeout:    c.Fetch.GetTimeout(),
+		}
+		if bc.CAFile != "" {
+			pem, err := ioutil.ReadFile(bc.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			o.RootCAs = x509.NewCertPool()
+			if !o.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", bc.CAFile)
+			}
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// makeRequestTweaker returns the RequestTweaker for the Packager. The main
+// resource requests get ForwardHeaders from the client requests in Handler;
+// the subresource requests get them from the main resource requests here.
+func makeRequestTweaker(c *tomlconfig.Config) fetch.RequestTweaker {
+	seq := fetch.RequestTweakerSequence{fetch.DefaultRequestTweaker}
+	if len(c.Fetch.ForwardHeaders) > 0 {
+		seq = append(seq, fetch.CopyParentHeaders(c.Fetch.ForwardHeaders))
+	}
+	if len(c.Fetch.CustomHeaders) > 0 {
+		seq = append(seq, fetch.SetCustomHeaders(c.Fetch.GetCustomHeaders()))
+	}
+	return seq
+}
+
+func makeURLMatcher(uc *tomlconfig.URLConfig) urlmatcher.Matcher {
+	return urlmatcher.AllOf(
+		urlmatcher.HasScheme("https"),
+		urlmatcher.HasHostname(uc.Domain),
+		urlmatcher.HasEscapedPathRegexp(uc.GetPathRE()),
+		urlmatcher.HasRawQueryRegexp(uc.GetQueryRE()),
+	)
+}
+
+// identityHosts maps the domains of the [[Sign]] sections, in lowercase, to
+// the indices of the [[Identity]] sections they use. The domains using the
+// default identity are not included.
+func identityHosts(c *tomlconfig.Config) map[string]int {
+	index := make(map[string]int)
+	for i, ic := range c.Identity {
+		index[ic.Name] = i
+	}
+	hosts := make(map[string]int)
+	for _, uc := range c.Sign {
+		if uc.Identity != "" {
+			hosts[strings.ToLower(uc.Domain)] = index[uc.Identity]
+		}
+	}
+	return hosts
 }
 
 func makeValidityURLRule(c *tomlconfig.Config) validity.URLRule {
-	return validity.FixedURL(c.SXG.GetValidityURL())
+	ruleElse := makeSXGValidityURLRule(&c.SXG)
+	if len(c.Identity) == 0 {
+		return ruleElse
+	}
+	rules := make(map[string]validity.URLRule)
+	for host, i := range identityHosts(c) {
+		rules[host] = makeSXGValidityURLRule(&c.Identity[i].SXGConfig)
+	}
+	return &hostValidityURLRule{rules, ruleElse}
+}
+
+func makeSXGValidityURLRule(sc *tomlconfig.SXGConfig) validity.URLRule {
+	return validity.FixedURL(sc.GetValidityURL())
 }
 
 func makeProcessor(c *tomlconfig.Config) processor.Processor {
+	config := makeProcessorConfig(&c.Processor)
+	for i := range c.Sign {
+		uc := &c.Sign[i]
+		if uc.Processor == nil {
+			continue
+		}
+		config.URLRoutes = append(config.URLRoutes, complexproc.URLRoute{
+			Matcher: makeURLMatcher(uc),
+			Config:  makeProcessorConfig(uc.Processor),
+		})
+	}
+	return complexproc.NewComprehensiveProcessor(config)
+}
+
+func makeProcessorConfig(pc *tomlconfig.ProcessorConfig) complexproc.Config {
 	var tasks []htmltask.HTMLTask
 
-	tasks = append(tasks, htmltask.ConservativeTaskSet...)
+	if pc.PreloadOptInAttr == "" {
+		tasks = append(tasks, htmltask.ConservativeTaskSet...)
+	} else {
+		tasks = append(tasks,
+			htmltask.ExtractSubContentTypes(),
+			htmltask.ExtractOptInPreloadTags(pc.PreloadOptInAttr),
+		)
+	}
 
-	if c.Processor.PreloadCSS {
+	if pc.PreloadCSS {
 		tasks = append(tasks, htmltask.PreloadStylesheets())
 	}
-	if c.Processor.PreloadJS {
+	// Run PreloadScriptsWithIntegrity first: InsecurePreloadScripts skips the
+	// scripts already preloaded, so those with the integrity attribute are
+	// never signed without the verification.
+	if pc.PreloadJSWithIntegrity {
+		tasks = append(tasks, htmltask.PreloadScriptsWithIntegrity())
+	}
+	if pc.PreloadJS {
 		tasks = append(tasks, htmltask.InsecurePreloadScripts())
 	}
+	if pc.PreloadLCPImages > 0 {
+		tasks = append(tasks, htmltask.PreloadLCPImages(htmltask.LCPImageConfig{
+			MaxCount:   pc.PreloadLCPImages,
+			ByteBudget: pc.LCPImageBudget,
+		}))
+	}
 
 	config := complexproc.Config{
-		Preverify: preverify.Config{MaxContentLength: c.Processor.SizeLimit},
-		HTML:      htmlproc.Config{TaskSet: tasks},
+		Preverify:       preverify.Config{MaxContentLength: pc.SizeLimit},
+		ContentEncoding: pc.ContentEncoding,
+		HTML: htmlproc.Config{
+			TaskSet: tasks,
+			AMP:     pc.GetAMPProfile(),
+		},
+	}
+	for i := range pc.Plugin {
+		config.CustomPreprocessors = append(config.CustomPreprocessors, makePlugin(&pc.Plugin[i]))
 	}
 
-	return complexproc.NewComprehensiveProcessor(config)
+	return config
+}
+
+func makePlugin(c *tomlconfig.PluginConfig) processor.Processor {
+	proc := execproc.NewExecProcessor(execproc.Config{
+		Command:        c.Command,
+		Args:           c.Args,
+		Timeout:        c.GetTimeout(),
+		MaxPayloadSize: c.MaxPayloadSize,
+	})
+	if len(c.MediaTypes) == 0 {
+		return proc
+	}
+	mp := make(processor.MultiplexedProcessor)
+	for _, mt := range c.MediaTypes {
+		mp[mt] = proc
+	}
+	return mp
 }
 
 func makeValidPeriodRule(c *tomlconfig.Config) vprule.Rule {
-	jsExpiry := c.SXG.GetJSExpiry()
-	expiry := c.SXG.GetExpiry()
+	ruleElse := makeSXGValidPeriodRule(&c.SXG)
+	if len(c.Identity) == 0 {
+		return ruleElse
+	}
+	rules := make(map[string]vprule.Rule)
+	for host, i := range identityHosts(c) {
+		rules[host] = makeSXGValidPeriodRule(&c.Identity[i].SXGConfig)
+	}
+	return &hostValidPeriodRule{rules, ruleElse}
+}
+
+func makeSXGValidPeriodRule(sc *tomlconfig.SXGConfig) vprule.Rule {
+	jsExpiry := sc.GetJSExpiry()
+	expiry := sc.GetExpiry()
 
 	return vprule.PerContentType(
 		map[string]vprule.Rule{
@@ -161,17 +547,69 @@ func makeValidPeriodRule(c *tomlconfig.Config) vprule.Rule {
 	)
 }
 
-func makeExchangeFactory(c *tomlconfig.Config) (*ExchangeMetaFactory, error) {
-	ec := ExchangeConfig{CertURLBase: c.SXG.GetCertURLBase()}
+// makeExchangeFactory returns the ExchangeFactory for Packager, with the
+// CertManagers from pool. With [[Identity]] sections, the ExchangeFactory is
+// a HostFactoryProvider to select the identity by the hostname.
+func makeExchangeFactory(c *tomlconfig.Config, pool *certManagerPool) (exchange.FactoryProvider, error) {
+	if len(c.Identity) == 0 {
+		f, err := makeExchangeMetaFactory(&c.SXG, pool)
+		if err != nil {
+			return nil, err
+		}
+		if c.Processor.PreloadCrossOrigin {
+			// Select the Factory per URL, so the certificate is verified
+			// to cover the hostname of each resource, including those on
+			// other origins.
+			return &HostFactoryProvider{Default: f}, nil
+		}
+		return f, nil
+	}
+
+	var errs *multierror.Error
+
+	provider := &HostFactoryProvider{
+		Hosts: make(map[string]exchange.FactoryProvider),
+	}
+	// [SXG] may be left unconfigured when no [[Sign]] uses it.
+	if c.Sign.UsesDefaultIdentity() {
+		f, err := makeExchangeMetaFactory(&c.SXG, pool)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		} else {
+			provider.Default = f
+		}
+	}
+	factories := make([]*ExchangeMetaFactory, len(c.Identity))
+	for i := range c.Identity {
+		ic := &c.Identity[i]
+		f, err := makeExchangeMetaFactory(&ic.SXGConfig, pool)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("Identity %q: %w", ic.Name, err))
+			continue
+		}
+		factories[i] = f
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	for host, i := range identityHosts(c) {
+		provider.Hosts[host] = factories[i]
+	}
+	return provider, nil
+}
+
+func makeExchangeMetaFactory(sc *tomlconfig.SXGConfig, pool *certManagerPool) (*ExchangeMetaFactory, error) {
+	ec := ExchangeConfig{CertURLBase: sc.GetCertURLBase()}
 
 	var errs *multierror.Error
 	var err error
 
-	ec.CertManager, err = makeCertManager(c)
+	ec.CertManager, err = pool.get(sc)
 	errs = multierror.Append(errs, err)
-	ec.PrivateKey, err = certchainutil.ReadPrivateKeyFile(c.SXG.Cert.KeyFile)
+	ec.PrivateKey, err = certchainutil.ReadPrivateKeyFile(sc.Cert.KeyFile)
 	errs = multierror.Append(errs, err)
-	ec.KeepNonSXGPreloads = c.SXG.KeepNonSXGPreloads
+	ec.KeepNonSXGPreloads = sc.KeepNonSXGPreloads
 
 	if err := errs.ErrorOrNil(); err != nil {
 		return nil, err
@@ -179,30 +617,30 @@ func makeExchangeFactory(c *tomlconfig.Config) (*ExchangeMetaFactory, error) {
 	return NewExchangeMetaFactory(ec), nil
 }
 
-func makeCertManager(c *tomlconfig.Config) (*certmanager.Manager, error) {
+func makeCertManager(sc *tomlconfig.SXGConfig) (*certmanager.Manager, error) {
 	var rcs certmanager.RawChainSource
 
-	if c.SXG.ACME.Enable {
-		key, err := certchainutil.ReadPrivateKeyFile(c.SXG.Cert.KeyFile)
+	if sc.ACME.Enable {
+		key, err := certchainutil.ReadPrivateKeyFile(sc.Cert.KeyFile)
 		if err != nil {
 			return nil, err
 		}
 
-		csr, err := certchainutil.ReadCertificateRequestFile(c.SXG.ACME.CSRFile)
+		csr, err := certchainutil.ReadCertificateRequestFile(sc.ACME.CSRFile)
 		if err != nil {
 			return nil, err
 		}
 
 		rcs, err = acmeclient.NewClient(acmeclient.Config{
 			CertSignRequest:   csr,
-			User:              acmeclient.NewUser(c.SXG.ACME.Email, key),
-			DiscoveryURL:      c.SXG.ACME.DiscoveryURL,
-			EABHmac:           c.SXG.ACME.EABHmac,
-			EABKid:            c.SXG.ACME.EABKid,
-			HTTPChallengePort: c.SXG.ACME.HTTPChallengePort,
-			HTTPWebRootDir:    c.SXG.ACME.HTTPWebRootDir,
-			TLSChallengePort:  c.SXG.ACME.TLSChallengePort,
-			DNSProvider:       c.SXG.ACME.DNSProvider,
+			User:              acmeclient.NewUser(sc.ACME.Email, key),
+			DiscoveryURL:      sc.ACME.DiscoveryURL,
+			EABHmac:           sc.ACME.EABHmac,
+			EABKid:            sc.ACME.EABKid,
+			HTTPChallengePort: sc.ACME.HTTPChallengePort,
+			HTTPWebRootDir:    sc.ACME.HTTPWebRootDir,
+			TLSChallengePort:  sc.ACME.TLSChallengePort,
+			DNSProvider:       sc.ACME.DNSProvider,
 			ShouldRegister:    true,
 			FetchTiming:       certmanager.FetchHourly,
 		})
@@ -211,8 +649,8 @@ func makeCertManager(c *tomlconfig.Config) (*certmanager.Manager, error) {
 		}
 	} else {
 		rcs = certmanager.NewLocalCertFile(certmanager.LocalCertFileConfig{
-			Path:          c.SXG.Cert.PEMFile,
-			AllowTestCert: c.SXG.Cert.AllowTestCert,
+			Path:          sc.Cert.PEMFile,
+			AllowTestCert: sc.Cert.AllowTestCert,
 		})
 	}
 
@@ -220,17 +658,17 @@ func makeCertManager(c *tomlconfig.Config) (*certmanager.Manager, error) {
 		RawChainSource: rcs,
 		OCSPRespSource: certmanager.NewOCSPClient(
 			certmanager.OCSPClientConfig{
-				AllowTestCert: c.SXG.Cert.AllowTestCert,
+				AllowTestCert: sc.Cert.AllowTestCert,
 			},
 		),
 	}
-	if c.SXG.Cert.CacheDir != "" {
-		fmt.Printf("Creating SXG certificate cache directory: %s\n", c.SXG.Cert.CacheDir)
-		if err := os.MkdirAll(c.SXG.Cert.CacheDir, 0700); err != nil {
+	if sc.Cert.CacheDir != "" {
+		fmt.Printf("Creating SXG certificate cache directory: %s\n", sc.Cert.CacheDir)
+		if err := os.MkdirAll(sc.Cert.CacheDir, 0700); err != nil {
 			return nil, err
 		}
 		// Clean the path with symlinks respected.
-		dir, err := filepath.EvalSymlinks(c.SXG.Cert.CacheDir)
+		dir, err := filepath.EvalSymlinks(sc.Cert.CacheDir)
 		if err != nil {
 			return nil, err
 		}
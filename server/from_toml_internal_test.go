@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/webpackager/server/tomlconfig"
+)
+
+const reloadTestConfig = `
+[SXG.Cert]
+  PEMFile = '../testdata/certs/chain/ecdsap256.pem'
+  KeyFile = '../testdata/keys/ecdsap256.key'
+  CacheDir = '%s'
+
+[[Sign]]
+  Domain = 'example.com'
+`
+
+func TestReloadTOMLConfig_ResourceCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutate    func(c *tomlconfig.Config)
+		wantReuse bool
+	}{
+		{
+			name:      "Unchanged",
+			mutate:    func(c *tomlconfig.Config) {},
+			wantReuse: true,
+		},
+		{
+			name:      "FetchTimeout",
+			mutate:    func(c *tomlconfig.Config) { c.Fetch.Timeout = "10s" },
+			wantReuse: true,
+		},
+		{
+			name:      "Relay",
+			mutate:    func(c *tomlconfig.Config) { c.Relay.Redirects = true },
+			wantReuse: true,
+		},
+		{
+			name:      "Cache",
+			mutate:    func(c *tomlconfig.Config) { c.Cache.MaxEntries = 100 },
+			wantReuse: false,
+		},
+		{
+			name:      "Processor",
+			mutate:    func(c *tomlconfig.Config) { c.Processor.PreloadCSS = true },
+			wantReuse: false,
+		},
+		{
+			name:      "SXG",
+			mutate:    func(c *tomlconfig.Config) { c.SXG.Expiry = "24h" },
+			wantReuse: false,
+		},
+		{
+			name:      "Sign",
+			mutate:    func(c *tomlconfig.Config) { c.Sign[0].PathRE = "/public/.*" },
+			wantReuse: false,
+		},
+		{
+			name:      "ForwardHeaders",
+			mutate:    func(c *tomlconfig.Config) { c.Fetch.ForwardHeaders = []string{"Accept-Language"} },
+			wantReuse: false,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "from_toml_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := []byte(fmt.Sprintf(reloadTestConfig, dir))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := tomlconfig.ParseConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := FromTOMLConfig(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := s.currentResourceCache()
+
+			c2, err := tomlconfig.ParseConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.mutate(c2)
+			if err := s.ReloadTOMLConfig(c2); err != nil {
+				t.Fatalf("ReloadTOMLConfig() = error(%q), want success", err)
+			}
+			if got := s.currentResourceCache() == before; got != test.wantReuse {
+				t.Errorf("ResourceCache reused = %v, want %v", got, test.wantReuse)
+			}
+		})
+	}
+}
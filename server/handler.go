@@ -21,13 +21,16 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/WICG/webpackage/go/signedexchange/version"
 	"github.com/google/webpackager"
+	"github.com/google/webpackager/certchain"
 	"github.com/google/webpackager/certchain/certmanager"
+	"github.com/google/webpackager/exchange"
 	"github.com/google/webpackager/fetch"
 	"github.com/google/webpackager/internal/timeutil"
 	"github.com/google/webpackager/internal/urlutil"
-	"github.com/google/webpackager/processor/preverify"
 	"github.com/google/webpackager/server/tomlconfig"
 	"github.com/hashicorp/go-multierror"
 	"golang.org/x/xerrors"
@@ -45,7 +48,8 @@ var (
 
 // Handler handles HTTP requests. See the package GoDoc for details.
 type Handler struct {
-	mux *http.ServeMux
+	mux      *http.ServeMux
+	negative *negativeCache
 	Config
 }
 
@@ -56,15 +60,48 @@ type Config struct {
 	// Packager is used to produce signed exchanges. ExchangeFactory should
 	// be an ExchangeMetaFactory set with CertManager (the following field)
 	// to keep the signing certificate and the cert-url parameter consistent
-	// with this Handler.
+	// with this Handler. To sign with multiple identities, ExchangeFactory
+	// can be a HostFactoryProvider of ExchangeMetaFactories, each set with
+	// one of CertManagers.
 	Packager *webpackager.Packager
 
 	// CertManager provides the AugmentedChain to serve from this Handler.
+	// It may be nil when CertManagers is non-empty.
 	CertManager *certmanager.Manager
 
+	// CertManagers provide additional AugmentedChains to serve, e.g. for
+	// the signing identities other than the default in HostFactoryProvider.
+	// The cert endpoint serves the chains from all of them, and the health
+	// endpoint requires all of them to be healthy.
+	CertManagers []*certmanager.Manager
+
 	// AllowTestCert indicates if it's ok to allow test certs.
 	AllowTestCert bool
 
+	// AllowTestCertFor indicates the CertManagers for which it's ok to allow
+	// test certs even when AllowTestCert is false, so each signing identity
+	// can have its own setting.
+	AllowTestCertFor map[*certmanager.Manager]bool
+
+	// ProxyClient is used to fetch the origin responses in the reverse-proxy
+	// mode (see ServerConfig.ReverseProxy). nil implies the FetchClient of
+	// Packager.
+	ProxyClient fetch.FetchClient
+
+	// RetryClient, if non-nil, is the RetryClient underlying the FetchClient
+	// of Packager and ProxyClient. AdminHandler reports its stats.
+	RetryClient *fetch.RetryClient
+
+	// RequestTweaker is applied to the request to fetch the document, with
+	// the client request as the parent, before the request is passed to
+	// Packager. It is typically fetch.CopyParentHeaders to forward some
+	// request headers from the client to the origin server. nil implies no
+	// mutation.
+	RequestTweaker fetch.RequestTweaker
+
+	// Relay specifies how to relay the upstream error responses.
+	Relay RelayConfig
+
 	// ServerConfig specifies the endpoints. All fields must contain a valid
 	// value as described in cmd/webpkgserver/webpkgserver.example.toml.
 	tomlconfig.ServerConfig
@@ -78,7 +115,7 @@ func NewHandler(c Config) *Handler {
 	c.ValidityPath = path.Clean(c.ValidityPath)
 	c.HealthPath = path.Clean(c.HealthPath)
 
-	h := &Handler{new(http.ServeMux), c}
+	h := &Handler{new(http.ServeMux), new(negativeCache), c}
 
 	h.mux.HandleFunc(c.CertPath+"/", h.handleCert)
 	h.mux.HandleFunc(c.DocPath, h.handleDoc)
@@ -90,14 +127,21 @@ func NewHandler(c Config) *Handler {
 
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.EscapedPath()
+
+	// In the reverse-proxy mode, the requests to any other paths are for
+	// the public URLs, which may use any methods.
+	if h.ReverseProxy && !h.isOwnPath(path) {
+		h.handleProxy(w, req)
+		return
+	}
+
 	// All handlers assume GET requests.
 	if req.Method != http.MethodGet {
 		replyError(w, http.StatusMethodNotAllowed)
 		return
 	}
 
-	path := req.URL.EscapedPath()
-
 	// http.ServeMux normalizes the URL path and causes multiple issues:
 	//   - "https://..." is reduced to "https:/...".
 	//   - ".." can be used to replace the authority
@@ -113,15 +157,30 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// isOwnPath reports whether path is for one of the child handlers.
+func (h *Handler) isOwnPath(path string) bool {
+	return path == h.DocPath || strings.HasPrefix(path, h.DocPath+"/") ||
+		strings.HasPrefix(path, h.CertPath+"/") ||
+		path == h.ValidityPath || path == h.HealthPath
+}
+
 func (h *Handler) handleCert(w http.ResponseWriter, req *http.Request) {
 	digest := strings.TrimPrefix(req.URL.Path, h.CertPath+"/")
-	ac, err := h.CertManager.Cache.Read(digest)
-	if errors.Is(err, certmanager.ErrNotFound) {
-		replyError(w, http.StatusNotFound)
-		return
+	var ac *certchain.AugmentedChain
+	for _, m := range h.allCertManagers() {
+		var err error
+		ac, err = m.Cache.Read(digest)
+		if errors.Is(err, certmanager.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			replyServerError(w, xerrors.Errorf("unable to read cert from cache: %w", err))
+			return
+		}
+		break
 	}
-	if err != nil {
-		replyServerError(w, xerrors.Errorf("unable to read cert from cache: %w", err))
+	if ac == nil {
+		replyError(w, http.StatusNotFound)
 		return
 	}
 
@@ -138,34 +197,74 @@ func (h *Handler) handleDoc(w http.ResponseWriter, req *http.Request) {
 }
 
 func (h *Handler) handleDocImpl(w http.ResponseWriter, req *http.Request, signURL string) {
-	if err := verifyAcceptHeader(req); err != nil {
-		replyClientError(w, err)
-		return
-	}
 	u, err := parseSignURL(signURL)
 	if err != nil {
 		replyClientError(w, xerrors.Errorf("invalid sign url: %w", err))
 		return
 	}
-	// TODO(yuizumi): Copy some request headers from req.
+	if !h.prefersExchange(req) {
+		if h.ReverseProxy {
+			h.proxyOrigin(w, req, u)
+			return
+		}
+		replyClientError(w, xerrors.Errorf("Accept header not preferring %s",
+			h.exchangeVersion().MimeType()))
+		return
+	}
+	h.handleExchange(w, req, u)
+}
+
+// handleExchange replies with the signed exchange for u.
+func (h *Handler) handleExchange(w http.ResponseWriter, req *http.Request, u *url.URL) {
 	newReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
 		replyServerError(w, err)
 		return
 	}
+	if h.RequestTweaker != nil {
+		if err := h.RequestTweaker.Tweak(newReq, req); err != nil {
+			replyServerError(w, xerrors.Errorf("tweaking request: %w", err))
+			return
+		}
+	}
+	negativeKey := h.negativeCacheKey(newReq)
+	if h.Relay.NotFoundTTL > 0 {
+		if rr := h.negative.lookup(negativeKey, time.Now()); rr != nil {
+			if h.ReverseProxy {
+				w.Header().Add("Vary", "Accept")
+			}
+			rr.reply(w)
+			return
+		}
+	}
 	r, err := h.Packager.RunForRequest(newReq, timeutil.Now())
 	if err != nil {
 		err = filterError(err, u.String())
-		// TODO(banaag): ideally, we should pass through that error response
-		// from the upstream.
-		if httpErr, ok := err.(*preverify.HTTPStatusError); ok {
-			replyError(w, httpErr.StatusCode)
+		if rr := h.newRelayedResponse(err); rr != nil {
+			if h.Relay.NotFoundTTL > 0 && isNotFound(rr.statusCode) {
+				now := time.Now()
+				h.negative.store(negativeKey, rr, now.Add(h.Relay.NotFoundTTL), now)
+			}
+			if h.ReverseProxy {
+				w.Header().Add("Vary", "Accept")
+			}
+			rr.reply(w)
 			return
 		}
 		if xerrors.Is(err, fetch.ErrURLMismatch) {
+			if h.ReverseProxy {
+				// Not signable; serve the origin response instead,
+				// as the client would get without preferring SXG.
+				h.proxyOrigin(w, req, u)
+				return
+			}
 			replyClientErrorSilent(w)
 			return
 		}
+		if xerrors.Is(err, fetch.ErrForbiddenAddress) {
+			replyForbidden(w, err)
+			return
+		}
 		if err != nil {
 			replyServerError(w, xerrors.Errorf("Packager.RunForRequest: %w", err))
 			return
@@ -180,29 +279,56 @@ func (h *Handler) handleDocImpl(w http.ResponseWriter, req *http.Request, signUR
 		replyServerError(w, xerrors.Errorf("serializing exchange: %w", err))
 		return
 	}
+	if h.ReverseProxy {
+		w.Header().Add("Vary", "Accept")
+	}
 	replyOK(w, body.Bytes(), r.Exchange.Version.MimeType())
 }
 
+func (h *Handler) prefersExchange(req *http.Request) bool {
+	return prefersExchange(req.Header["Accept"], h.exchangeVersion())
+}
+
+// exchangeVersion returns the version of the signed exchanges Packager
+// produces.
+func (h *Handler) exchangeVersion() version.Version {
+	if f, ok := h.Packager.ExchangeFactory.(*ExchangeMetaFactory); ok && f.Version != "" {
+		return f.Version
+	}
+	return exchange.DefaultVersion
+}
+
 func (h *Handler) handleValidity(w http.ResponseWriter, req *http.Request) {
 	replyOK(w, emptyMapCBOR, mimeTypeValidity)
 }
 
 func (h *Handler) handleHealth(w http.ResponseWriter, req *http.Request) {
-	ac := h.CertManager.GetAugmentedChain()
-	if ac == nil {
-		replyError(w, http.StatusNotFound)
-		return
-	}
-	err := ac.VerifyAll(timeutil.Now(), !h.AllowTestCert)
-	if err != nil {
-		replyServerError(w, xerrors.Errorf("not healthy: %w", err))
-		return
+	for _, m := range h.allCertManagers() {
+		ac := m.GetAugmentedChain()
+		if ac == nil {
+			replyError(w, http.StatusNotFound)
+			return
+		}
+		allowTestCert := h.AllowTestCert || h.AllowTestCertFor[m]
+		err := ac.VerifyAll(timeutil.Now(), !allowTestCert)
+		if err != nil {
+			replyServerError(w, xerrors.Errorf("not healthy: %w", err))
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
 
+// allCertManagers returns CertManager, if not nil, and CertManagers.
+func (c *Config) allCertManagers() []*certmanager.Manager {
+	if c.CertManager == nil {
+		return c.CertManagers
+	}
+	return append([]*certmanager.Manager{c.CertManager}, c.CertManagers...)
+}
+
 func filterError(err error, url string) error {
 	switch err := err.(type) {
 	case *webpackager.Error:
@@ -253,16 +379,3 @@ func parseSignURL(rawurl string) (*url.URL, error) {
 
 	return u, nil
 }
-
-func verifyAcceptHeader(req *http.Request) error {
-	// TODO(yuizumi): Parse the Accept header properly. If SXG has a lower
-	// q value (say, than "text/html"), behave like a reverse proxy.
-	// For now, we just verify it contains application/signed-exchange and
-	// and reject the request otherwise for minimal safety.
-	for _, v := range req.Header["Accept"] {
-		if strings.Contains(v, mimeTypeExchange) {
-			return nil
-		}
-	}
-	return xerrors.Errorf("Accept header missing %q", mimeTypeExchange)
-}
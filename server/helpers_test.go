@@ -16,6 +16,7 @@ package server_test
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/webpackager/certchain"
@@ -59,17 +60,20 @@ var _ certmanager.Cache = (*stubCache)(nil)
 
 type stubCache struct {
 	avail    chan struct{}
+	mu       sync.RWMutex
 	chainMap map[string]*certchain.AugmentedChain
 }
 
 func newStubCache() *stubCache {
 	return &stubCache{
-		make(chan struct{}, 1),
-		make(map[string]*certchain.AugmentedChain),
+		avail:    make(chan struct{}, 1),
+		chainMap: make(map[string]*certchain.AugmentedChain),
 	}
 }
 
 func (c *stubCache) Read(digest string) (*certchain.AugmentedChain, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if _, ok := c.chainMap[digest]; !ok {
 		return nil, certmanager.ErrNotFound
 	}
@@ -85,7 +89,9 @@ func (c *stubCache) Write(ac *certchain.AugmentedChain) error {
 	if ac == nil {
 		return errors.New("Write: nil augmented chain")
 	}
+	c.mu.Lock()
 	c.chainMap[ac.Digest] = ac
+	c.mu.Unlock()
 	c.avail <- struct{}{}
 	return nil
 }
@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/exchange/vprule"
+	"github.com/google/webpackager/validity"
+)
+
+// HostFactoryProvider is an exchange.URLFactoryProvider to sign resources
+// with multiple signing identities. Unlike exchange.MultiCertFactoryProvider,
+// it selects the identity by the exact hostname of the resource URL, rather
+// than by trying the certificates in order.
+type HostFactoryProvider struct {
+	// Hosts maps the hostnames, all in lowercase, to the FactoryProviders
+	// to sign the resources on them.
+	Hosts map[string]exchange.FactoryProvider
+
+	// Default is used for the hostnames not in Hosts. nil causes an error
+	// for those hostnames.
+	Default exchange.FactoryProvider
+}
+
+var _ exchange.URLFactoryProvider = (*HostFactoryProvider)(nil)
+
+// Get returns the Factory from h.Default.
+func (h *HostFactoryProvider) Get() (*exchange.Factory, error) {
+	if h.Default == nil {
+		return nil, fmt.Errorf("no default signing identity")
+	}
+	return h.Default.Get()
+}
+
+// GetForURL returns the Factory from the FactoryProvider for the hostname
+// of u.
+func (h *HostFactoryProvider) GetForURL(u *url.URL) (*exchange.Factory, error) {
+	if p, ok := h.Hosts[strings.ToLower(u.Hostname())]; ok {
+		return p.Get()
+	}
+	if h.Default == nil {
+		return nil, fmt.Errorf("no signing identity for %q", u.Hostname())
+	}
+	return h.Default.Get()
+}
+
+// hostValidPeriodRule selects the vprule.Rule by the hostname of the
+// request URL, like HostFactoryProvider.
+type hostValidPeriodRule struct {
+	hosts    map[string]vprule.Rule
+	ruleElse vprule.Rule
+}
+
+func (h *hostValidPeriodRule) Get(resp *exchange.Response, date time.Time) exchange.ValidPeriod {
+	if r, ok := h.hosts[strings.ToLower(resp.Request.URL.Hostname())]; ok {
+		return r.Get(resp, date)
+	}
+	return h.ruleElse.Get(resp, date)
+}
+
+// hostValidityURLRule selects the validity.URLRule by the hostname of the
+// request URL, like HostFactoryProvider.
+type hostValidityURLRule struct {
+	hosts    map[string]validity.URLRule
+	ruleElse validity.URLRule
+}
+
+func (h *hostValidityURLRule) Apply(physurl *url.URL, resp *exchange.Response, vp exchange.ValidPeriod) (*url.URL, error) {
+	if r, ok := h.hosts[strings.ToLower(resp.Request.URL.Hostname())]; ok {
+		return r.Apply(physurl, resp, vp)
+	}
+	return h.ruleElse.Apply(physurl, resp, vp)
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"testing"
+
+	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/internal/certchaintest"
+	"github.com/google/webpackager/internal/urlutil"
+	"github.com/google/webpackager/server"
+)
+
+func newFactory(certURL string) *exchange.Factory {
+	return exchange.NewFactory(exchange.Config{
+		CertChain:  certchaintest.MustReadAugmentedChainFile(cborFile),
+		CertURL:    urlutil.MustParse(certURL),
+		PrivateKey: certchaintest.MustReadPrivateKeyFile("../testdata/keys/ecdsap256.key"),
+	})
+}
+
+func TestHostFactoryProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		def     exchange.FactoryProvider
+		certURL string
+		wantErr bool
+	}{
+		{
+			name:    "Host",
+			url:     "https://example.com/index.html",
+			certURL: "https://example.com/cert",
+		},
+		{
+			name:    "HostCaseInsensitive",
+			url:     "https://Example.NET:8443/index.html",
+			certURL: "https://example.net/cert",
+		},
+		{
+			name:    "Default",
+			url:     "https://example.org/index.html",
+			def:     newFactory("https://example.org/cert"),
+			certURL: "https://example.org/cert",
+		},
+		{
+			name:    "NoDefault",
+			url:     "https://example.org/index.html",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &server.HostFactoryProvider{
+				Hosts: map[string]exchange.FactoryProvider{
+					"example.com": newFactory("https://example.com/cert"),
+					"example.net": newFactory("https://example.net/cert"),
+				},
+				Default: test.def,
+			}
+			fty, err := provider.GetForURL(urlutil.MustParse(test.url))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("GetForURL() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetForURL() = error(%q), want success", err)
+			}
+			if got := fty.CertURL.String(); got != test.certURL {
+				t.Errorf("GetForURL().CertURL = %q, want %q", got, test.certURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/google/webpackager/fetch"
+	"golang.org/x/xerrors"
+)
+
+// handleProxy handles the requests to the public URLs in the reverse-proxy
+// mode. It serves the signed exchange when the client prefers it, or the
+// origin response as is otherwise.
+func (h *Handler) handleProxy(w http.ResponseWriter, req *http.Request) {
+	u, err := parseSignURL("https://" + req.Host + req.URL.RequestURI())
+	if err != nil {
+		replyClientError(w, xerrors.Errorf("invalid request url: %w", err))
+		return
+	}
+	if req.Method == http.MethodGet && h.prefersExchange(req) {
+		h.handleExchange(w, req, u)
+		return
+	}
+	h.proxyOrigin(w, req, u)
+}
+
+// proxyOrigin sends req to u through ProxyClient and copies the response
+// to w, adding "Vary: Accept" since the same URL may also serve the signed
+// exchange.
+func (h *Handler) proxyOrigin(w http.ResponseWriter, req *http.Request, u *url.URL) {
+	client := h.ProxyClient
+	if client == nil {
+		client = h.Packager.FetchClient
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL = u
+			out.Host = ""
+			out.RequestURI = "" // Not allowed in client requests.
+		},
+		Transport: roundTripper{client},
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Add("Vary", "Accept")
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			switch {
+			case xerrors.Is(err, fetch.ErrURLMismatch):
+				replyClientErrorSilent(w)
+			case xerrors.Is(err, fetch.ErrForbiddenAddress):
+				replyForbidden(w, err)
+			default:
+				replyBadGateway(w, xerrors.Errorf("proxying %s: %w", u, err))
+			}
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// roundTripper adapts a FetchClient to http.RoundTripper.
+type roundTripper struct {
+	client fetch.FetchClient
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.client.Do(req)
+}
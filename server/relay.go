@@ -0,0 +1,175 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/webpackager"
+	"github.com/google/webpackager/processor/preverify"
+	"golang.org/x/xerrors"
+)
+
+// maxNegativeEntries is the maximum number of entries in negativeCache.
+const maxNegativeEntries = 1024
+
+// relayHeaders lists the upstream response header fields safe to relay.
+// Other fields, e.g. Set-Cookie, are dropped.
+var relayHeaders = []string{
+	"Cache-Control",
+	"Content-Language",
+	"Content-Type",
+	"Expires",
+	"Last-Modified",
+	"Retry-After",
+}
+
+// RelayConfig specifies how Handler relays the upstream responses it does
+// not produce signed exchanges for.
+type RelayConfig struct {
+	// SizeLimit is the maximum size of the upstream response bodies to
+	// relay. Larger bodies are replaced with a short message. Zero relays
+	// no bodies.
+	SizeLimit int
+
+	// Redirects instructs Handler to relay the upstream redirects (3xx
+	// responses) with the Location header. Otherwise they are reported as
+	// server errors.
+	Redirects bool
+
+	// NotFoundTTL is the duration to remember the upstream 404 (Not Found)
+	// and 410 (Gone) responses and relay them without fetching again. Zero
+	// disables it.
+	NotFoundTTL time.Duration
+}
+
+// relayedResponse is an upstream response to relay to the clients.
+type relayedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// newRelayedResponse returns the upstream response to relay for err from
+// Packager, or nil if err is not from an upstream response to relay.
+func (h *Handler) newRelayedResponse(err error) *relayedResponse {
+	var redirectErr *webpackager.RedirectError
+	if h.Relay.Redirects && xerrors.As(err, &redirectErr) {
+		header := make(http.Header)
+		header.Set("Location", redirectErr.Location.String())
+		return &relayedResponse{redirectErr.StatusCode, header, nil}
+	}
+
+	var statusErr *preverify.HTTPStatusError
+	if !xerrors.As(err, &statusErr) {
+		return nil
+	}
+	code := statusErr.StatusCode
+	if code >= 300 && code < 400 {
+		// Redirects are RedirectErrors; others like 304 make no sense.
+		return nil
+	}
+	rr := &relayedResponse{statusCode: code, header: make(http.Header)}
+	resp := statusErr.Response
+	if resp == nil || len(resp.Payload) > h.Relay.SizeLimit {
+		return rr // With the default body by replyError.
+	}
+	for _, key := range relayHeaders {
+		if values, ok := resp.Header[key]; ok {
+			rr.header[key] = append([]string(nil), values...)
+		}
+	}
+	rr.body = resp.Payload
+	return rr
+}
+
+// reply writes rr to w.
+func (rr *relayedResponse) reply(w http.ResponseWriter) {
+	if rr.body == nil && rr.header.Get("Location") == "" {
+		replyError(w, rr.statusCode)
+		return
+	}
+	for key, values := range rr.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(rr.body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(rr.statusCode)
+	w.Write(rr.body)
+}
+
+func isNotFound(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+// negativeCache remembers the upstream 404 and 410 responses for a while.
+type negativeCache struct {
+	mu      sync.Mutex
+	entries map[string]*negativeEntry
+}
+
+type negativeEntry struct {
+	resp    *relayedResponse
+	expires time.Time
+}
+
+// negativeCacheKey returns the key for req, which varies on the header
+// fields the Packager's resources vary on.
+func (h *Handler) negativeCacheKey(req *http.Request) string {
+	var key strings.Builder
+	key.WriteString(req.URL.String())
+	for _, name := range h.Packager.CacheVaryHeaders {
+		key.WriteString("\n")
+		key.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return key.String()
+}
+
+func (c *negativeCache) lookup(key string, now time.Time) *relayedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e.resp
+}
+
+func (c *negativeCache) store(key string, resp *relayedResponse, expires time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*negativeEntry)
+	}
+	if len(c.entries) >= maxNegativeEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxNegativeEntries {
+			return // Still full.
+		}
+	}
+	c.entries[key] = &negativeEntry{resp, expires}
+}
@@ -45,6 +45,16 @@ func replyClientErrorSilent(w http.ResponseWriter) {
 	replyError(w, http.StatusBadRequest)
 }
 
+func replyForbidden(w http.ResponseWriter, err error) {
+	log.Print(err)
+	replyError(w, http.StatusForbidden)
+}
+
+func replyBadGateway(w http.ResponseWriter, err error) {
+	log.Print(err)
+	replyError(w, http.StatusBadGateway)
+}
+
 func replyError(w http.ResponseWriter, code int) {
 	http.Error(w, fmt.Sprintf("%d %s", code, http.StatusText(code)), code)
 }
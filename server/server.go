@@ -15,57 +15,209 @@
 package server
 
 import (
+	"context"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/webpackager/certchain/certmanager"
+	"github.com/google/webpackager/fetch"
+	"github.com/google/webpackager/resource/cache"
+	"github.com/google/webpackager/server/tomlconfig"
 )
 
 // Server encapsulates http.Server and Config so it can start and stop
-// CertManager automatically in Serve.
+// CertManager, as well as CertManagers, automatically in Serve. Config can
+// be replaced with Reload while the Server is serving.
 type Server struct {
 	*http.Server
 	Config
+
+	mu      sync.Mutex
+	handler atomic.Value // *Handler
+	serving bool         // The CertManagers have been started.
+	toml    *tomlState   // Set by FromTOMLConfig.
+
+	shutdown     chan struct{} // Closed when Shutdown completes.
+	shutdownOnce sync.Once
 }
 
-// NewServer creates a new Server. s.Handler is replaced with NewHandler(c).
+// NewServer creates a new Server. s.Handler is replaced with a handler which
+// serves with NewHandler(c), or the Handler for the Config given to Reload.
 func NewServer(s *http.Server, c Config) *Server {
-	s.Handler = NewHandler(c)
-	return &Server{s, c}
+	server := &Server{Server: s, Config: c}
+	server.handler.Store(NewHandler(c))
+	s.Handler = http.HandlerFunc(server.serveHTTP)
+	return server
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.Load().(*Handler).ServeHTTP(w, req)
+}
+
+// Reload replaces the Config of s with c. The requests received after Reload
+// are served with c, while those in flight are completed with the old Config.
+// If s is serving, Reload starts the CertManagers in c and stops those no
+// longer in use; the CertManagers in both Configs are kept running. Reload
+// keeps the old Config when it fails to start any of the CertManagers.
+func (s *Server) Reload(c Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serving {
+		running := make(map[*certmanager.Manager]bool)
+		for _, m := range s.allCertManagers() {
+			running[m] = true
+		}
+		var started []*certmanager.Manager
+		for _, m := range c.allCertManagers() {
+			if running[m] {
+				delete(running, m)
+				continue
+			}
+			if err := m.Start(); err != nil {
+				for _, m := range started {
+					m.Stop()
+				}
+				return err
+			}
+			started = append(started, m)
+		}
+		for m := range running {
+			m.Stop()
+		}
+	}
+
+	s.handler.Store(NewHandler(c))
+	s.Config = c
+	return nil
 }
 
 // ListenAndServe wraps s.Server.ListenAndServe to start/stop s.CertManager
 // automatically.
 func (s *Server) ListenAndServe() error {
-	if err := s.CertManager.Start(); err != nil {
-		return err
-	}
-	defer s.CertManager.Stop()
-	return s.Server.ListenAndServe()
+	return s.serve(s.Server.ListenAndServe)
 }
 
 // ListenAndServeTLS wraps s.Server.ListenAndServeTLS to start/stop
 // s.CertManager automatically.
 func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
-	if err := s.CertManager.Start(); err != nil {
-		return err
-	}
-	defer s.CertManager.Stop()
-	return s.Server.ListenAndServeTLS(certFile, keyFile)
+	return s.serve(func() error {
+		return s.Server.ListenAndServeTLS(certFile, keyFile)
+	})
 }
 
 // Serve wraps s.Server.Serve to start/stop s.CertManager automatically.
 func (s *Server) Serve(l net.Listener) error {
-	if err := s.CertManager.Start(); err != nil {
-		return err
-	}
-	defer s.CertManager.Stop()
-	return s.Server.Serve(l)
+	return s.serve(func() error {
+		return s.Server.Serve(l)
+	})
 }
 
 // ServeTLS wraps s.Server.ServeTLS to start/stop s.CertManager automatically.
 func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
-	if err := s.CertManager.Start(); err != nil {
+	return s.serve(func() error {
+		return s.Server.ServeTLS(l, certFile, keyFile)
+	})
+}
+
+// serve runs serve with the CertManagers started. When s is being shut down
+// by Shutdown, it waits for Shutdown to complete.
+func (s *Server) serve(serve func() error) error {
+	if err := s.startCertManagers(); err != nil {
 		return err
 	}
-	defer s.CertManager.Stop()
-	return s.Server.ServeTLS(l, certFile, keyFile)
+	defer s.stopCertManagers()
+	err := serve()
+	if err == http.ErrServerClosed {
+		s.mu.Lock()
+		shutdown := s.shutdown
+		s.mu.Unlock()
+		if shutdown != nil {
+			<-shutdown
+		}
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down s like http.Server.Shutdown: it stops
+// accepting new connections and waits for the requests in flight, including
+// those producing signed exchanges, to complete until ctx is done. Then it
+// stops the CertManagers. Serve and its variants return http.ErrServerClosed
+// after Shutdown completes.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.shutdown == nil {
+		s.shutdown = make(chan struct{})
+	}
+	shutdown := s.shutdown
+	s.mu.Unlock()
+	defer s.shutdownOnce.Do(func() { close(shutdown) })
+
+	err := s.Server.Shutdown(ctx)
+	s.stopCertManagers()
+	return err
+}
+
+// startCertManagers starts all the CertManagers. When one of them fails,
+// it stops those already started.
+func (s *Server) startCertManagers() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	managers := s.allCertManagers()
+	for i, m := range managers {
+		if err := m.Start(); err != nil {
+			for _, started := range managers[:i] {
+				started.Stop()
+			}
+			return err
+		}
+	}
+	s.serving = true
+	return nil
+}
+
+func (s *Server) stopCertManagers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.serving {
+		return
+	}
+	for _, m := range s.allCertManagers() {
+		m.Stop()
+	}
+	s.serving = false
+}
+
+// currentCertManagers returns the CertManagers of the current Config.
+func (s *Server) currentCertManagers() []*certmanager.Manager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.allCertManagers()
+}
+
+// currentResourceCache returns the ResourceCache of the current Packager.
+func (s *Server) currentResourceCache() cache.ResourceCache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Packager.ResourceCache
+}
+
+// currentRetryClient returns the RetryClient of the current Config.
+func (s *Server) currentRetryClient() *fetch.RetryClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RetryClient
+}
+
+// currentTOMLConfig returns the TOML config of s, or nil if s was not
+// created by FromTOMLConfig.
+func (s *Server) currentTOMLConfig() *tomlconfig.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.toml == nil {
+		return nil
+	}
+	return s.toml.config
 }
@@ -15,6 +15,7 @@
 package server_test
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net"
@@ -23,6 +24,8 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -44,6 +47,12 @@ import (
 const cborFile = "../testdata/certs/cbor/ecdsap256_nosct.cbor"
 
 func setupServer(www *httptest.Server) (*server.Server, string) {
+	return setupServerWithConfig(www, nil)
+}
+
+// setupServerWithConfig is like setupServer, but lets configure mutate the
+// server.Config before the server is created.
+func setupServerWithConfig(www *httptest.Server, configure func(*server.Config)) (*server.Server, string) {
 	ac := certchaintest.MustReadAugmentedChainFile(cborFile)
 
 	certManager := certmanager.NewManager(certmanager.Config{
@@ -52,7 +61,7 @@ func setupServer(www *httptest.Server) (*server.Server, string) {
 		Cache:          newStubCache(),
 	})
 
-	s := server.NewServer(new(http.Server), server.Config{
+	config := server.Config{
 		ServerConfig: tomlconfig.ServerConfig{
 			DocPath:      "/priv/doc",
 			CertPath:     "/webpkg/cert",
@@ -60,8 +69,9 @@ func setupServer(www *httptest.Server) (*server.Server, string) {
 			HealthPath:   "/healthz",
 			SignParam:    "sign",
 		},
-		AllowTestCert: true,
-		CertManager:   certManager,
+		AllowTestCert:  true,
+		CertManager:    certManager,
+		RequestTweaker: fetch.CopyParentHeaders([]string{"Accept-Language"}),
 		Packager: webpackager.NewPackager(webpackager.Config{
 			FetchClient: fetch.WithSelector(
 				fetchtest.NewFetchClient(www),
@@ -80,8 +90,13 @@ func setupServer(www *httptest.Server) (*server.Server, string) {
 				CertURLBase: urlutil.MustParse("/webpkg/cert"),
 				PrivateKey:  certchaintest.MustReadPrivateKeyFile("../testdata/keys/ecdsap256.key"),
 			}),
+			CacheVaryHeaders: []string{"Accept-Language"},
 		}),
-	})
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	s := server.NewServer(new(http.Server), config)
 
 	l, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
@@ -108,6 +123,10 @@ func setupContentServer() *httptest.Server {
 			http.Error(w, "404 Not Found", http.StatusNotFound)
 		}
 	})
+	mux.HandleFunc("/public/lang.html", func(w http.ResponseWriter, r *http.Request) {
+		html := "<!doctype html><p>lang=" + r.Header.Get("Accept-Language") + "</p>"
+		http.ServeContent(w, r, "lang.html", time.Time{}, strings.NewReader(html))
+	})
 	mux.HandleFunc("/private/hello.html", func(w http.ResponseWriter, r *http.Request) {
 		html := "<!doctype html><p>hello, world</p>"
 		http.ServeContent(w, r, "hello.html", time.Time{}, strings.NewReader(html))
@@ -193,6 +212,326 @@ func TestHandleDoc(t *testing.T) {
 	}
 }
 
+func TestHandleDoc_ForwardHeaders(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, addr := setupServer(www)
+	defer s.Close()
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	// Repeat "ja" to make sure the cached exchange for "en" is not reused.
+	for _, lang := range []string{"ja", "en", "ja"} {
+		t.Run(lang, func(t *testing.T) {
+			url := "http://" + addr + "/priv/doc/https://example.com/public/lang.html"
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Add("Accept", "application/signed-exchange;v=b3")
+			req.Header.Add("Accept-Language", lang)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.StatusCode; got != http.StatusOK {
+				t.Fatalf("StatusCode = %v, want %v", got, http.StatusOK)
+			}
+			sxg, err := signedexchange.ReadExchange(resp.Body)
+			if err != nil {
+				t.Fatalf("ReadExchange() = error(%q), want success", err)
+			}
+			if want := "lang=" + lang; !strings.Contains(string(sxg.Payload), want) {
+				t.Errorf("sxg.Payload = %q, want containing %q", sxg.Payload, want)
+			}
+		})
+	}
+}
+
+func TestReverseProxy(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, addr := setupServerWithConfig(www, func(c *server.Config) {
+		c.ReverseProxy = true
+	})
+	defer s.Close()
+
+	const (
+		mimeTypeHTML = "text/html; charset=utf-8"
+		mimeTypeSXG  = "application/signed-exchange;v=b3"
+	)
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		wantType string
+	}{
+		{
+			name:     "SXG",
+			path:     "/public/hello.html",
+			accept:   "application/signed-exchange;v=b3",
+			wantType: mimeTypeSXG,
+		},
+		{
+			name:     "SXGPreferred",
+			path:     "/public/hello.html",
+			accept:   "text/html;q=0.9,application/signed-exchange;v=b3",
+			wantType: mimeTypeSXG,
+		},
+		{
+			name:     "SXGTied",
+			path:     "/public/hello.html",
+			accept:   "text/html,application/signed-exchange;v=b3;q=1.0",
+			wantType: mimeTypeSXG,
+		},
+		{
+			name:     "HTMLPreferred",
+			path:     "/public/hello.html",
+			accept:   "text/html,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+			wantType: mimeTypeHTML,
+		},
+		{
+			name:     "SXGWrongVersion",
+			path:     "/public/hello.html",
+			accept:   "application/signed-exchange;v=b2,*/*;q=0.1",
+			wantType: mimeTypeHTML,
+		},
+		{
+			name:     "SXGZeroQ",
+			path:     "/public/hello.html",
+			accept:   "application/signed-exchange;v=b3;q=0",
+			wantType: mimeTypeHTML,
+		},
+		{
+			name:     "NoAccept",
+			path:     "/public/hello.html",
+			wantType: mimeTypeHTML,
+		},
+		{
+			name:     "DocPath",
+			path:     "/priv/doc/https://example.com/public/hello.html",
+			accept:   "text/html",
+			wantType: mimeTypeHTML,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+test.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = "example.com"
+			if test.accept != "" {
+				req.Header.Add("Accept", test.accept)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.StatusCode; got != http.StatusOK {
+				t.Errorf("StatusCode = %v, want %v", got, http.StatusOK)
+			}
+			if got := resp.Header.Get("Content-Type"); got != test.wantType {
+				t.Errorf("[Content-Type] = %q, want %q", got, test.wantType)
+			}
+			if got := resp.Header.Get("Vary"); got != "Accept" {
+				t.Errorf("[Vary] = %q, want %q", got, "Accept")
+			}
+		})
+	}
+}
+
+func TestReverseProxy_URLMismatch(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, addr := setupServerWithConfig(www, func(c *server.Config) {
+		c.ReverseProxy = true
+		c.ProxyClient = fetchtest.NewFetchClient(www)
+	})
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/private/hello.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "example.com"
+	req.Header.Add("Accept", "application/signed-exchange;v=b3")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.StatusCode; got != http.StatusOK {
+		t.Errorf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf("[Content-Type] = %q, want %q", got, want)
+	}
+	if got := resp.Header.Get("Vary"); got != "Accept" {
+		t.Errorf("[Vary] = %q, want %q", got, "Accept")
+	}
+}
+
+func TestHandleDoc_Relay(t *testing.T) {
+	var missingHits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public/missing.html", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&missingHits, 1)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("custom not found"))
+	})
+	mux.HandleFunc("/public/old.html", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/public/new.html", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/public/broken.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	})
+	www := httptest.NewTLSServer(mux)
+	defer www.Close()
+
+	s, addr := setupServerWithConfig(www, func(c *server.Config) {
+		c.Relay = server.RelayConfig{
+			SizeLimit:   100,
+			Redirects:   true,
+			NotFoundTTL: time.Minute,
+		}
+	})
+	defer s.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantHeader http.Header
+		wantBody   string
+	}{
+		{
+			name:       "NotFound",
+			path:       "/public/missing.html",
+			wantStatus: http.StatusNotFound,
+			wantHeader: http.Header{
+				"Content-Type": {"text/plain; charset=utf-8"},
+				"Set-Cookie":   nil,
+			},
+			wantBody: "custom not found",
+		},
+		{
+			name:       "NotFoundCached",
+			path:       "/public/missing.html",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "custom not found",
+		},
+		{
+			name:       "Redirect",
+			path:       "/public/old.html",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: http.Header{
+				"Location": {"https://example.com/public/new.html"},
+			},
+		},
+		{
+			name:       "OversizedBody",
+			path:       "/public/broken.html",
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   "500 Internal Server Error\n",
+		},
+	}
+
+	client := &http.Client{CheckRedirect: fetch.NeverRedirect}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url := "http://" + addr + "/priv/doc/https://example.com" + test.path
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Add("Accept", "application/signed-exchange;v=b3")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.StatusCode; got != test.wantStatus {
+				t.Errorf("StatusCode = %v, want %v", got, test.wantStatus)
+			}
+			for key, want := range test.wantHeader {
+				if got := resp.Header[key]; !cmp.Equal(got, want) {
+					t.Errorf("[%s] = %q, want %q", key, got, want)
+				}
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.wantBody != "" && string(body) != test.wantBody {
+				t.Errorf("Body = %q, want %q", body, test.wantBody)
+			}
+		})
+	}
+
+	if got := atomic.LoadInt32(&missingHits); got != 1 {
+		t.Errorf("missing.html was fetched %d times, want 1", got)
+	}
+}
+
+func TestReverseProxy_NotFoundCached(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public/missing.html", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+	})
+	www := httptest.NewTLSServer(mux)
+	defer www.Close()
+
+	s, addr := setupServerWithConfig(www, func(c *server.Config) {
+		c.ReverseProxy = true
+		c.Relay = server.RelayConfig{NotFoundTTL: time.Minute}
+	})
+	defer s.Close()
+
+	// The second request is served from the negative cache.
+	for _, name := range []string{"NotFound", "NotFoundCached"} {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/public/missing.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = "example.com"
+			req.Header.Add("Accept", "application/signed-exchange;v=b3")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.StatusCode; got != http.StatusNotFound {
+				t.Errorf("StatusCode = %v, want %v", got, http.StatusNotFound)
+			}
+			if got := resp.Header.Get("Vary"); got != "Accept" {
+				t.Errorf("[Vary] = %q, want %q", got, "Accept")
+			}
+		})
+	}
+}
+
 func TestHandleDoc_ClientError(t *testing.T) {
 	www := setupContentServer()
 	defer www.Close()
@@ -209,6 +548,16 @@ func TestHandleDoc_ClientError(t *testing.T) {
 			url:    "http://" + addr + "/priv/doc/https://example.com/public/hello.html",
 			accept: "text/html,application/xhtml+xml;q=0.9",
 		},
+		{
+			name:   "Accept_SXGNotPreferred",
+			url:    "http://" + addr + "/priv/doc/https://example.com/public/hello.html",
+			accept: "text/html,application/signed-exchange;v=b3;q=0.9",
+		},
+		{
+			name:   "Accept_SXGWrongVersion",
+			url:    "http://" + addr + "/priv/doc/https://example.com/public/hello.html",
+			accept: "application/signed-exchange;v=b2",
+		},
 		{
 			name:   "SignURL_Missing",
 			url:    "http://" + addr + "/priv/doc/",
@@ -376,6 +725,48 @@ func TestHandleHealth(t *testing.T) {
 	}
 }
 
+func TestHandleHealth_AllowTestCertFor(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name  string
+		allow bool
+		want  int
+	}{
+		{"Allowed", true, http.StatusOK},
+		{"NotAllowed", false, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m *certmanager.Manager
+			s, addr := setupServerWithConfig(www, func(c *server.Config) {
+				m = c.CertManager
+				c.AllowTestCert = false
+				c.AllowTestCertFor = map[*certmanager.Manager]bool{m: test.allow}
+			})
+			defer s.Close()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for m.GetAugmentedChain() == nil && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			resp, err := http.Get("http://" + addr + "/healthz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.StatusCode; got != test.want {
+				t.Errorf("StatusCode = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
 func TestHandleValidity(t *testing.T) {
 	www := setupContentServer()
 	defer www.Close()
@@ -411,3 +802,104 @@ func TestHandleValidity(t *testing.T) {
 		t.Errorf("Body mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestReload(t *testing.T) {
+	www := setupContentServer()
+	defer www.Close()
+	s, addr := setupServer(www)
+	defer s.Close()
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Fatalf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+
+	// Keep the CertManager running.
+	config := s.Config
+	config.HealthPath = "/status"
+	if err := s.Reload(config); err != nil {
+		t.Fatalf("Reload() = error(%q), want success", err)
+	}
+	if got := get("/healthz"); got != http.StatusNotFound {
+		t.Errorf("StatusCode for /healthz = %v, want %v", got, http.StatusNotFound)
+	}
+	if got := get("/status"); got != http.StatusOK {
+		t.Errorf("StatusCode for /status = %v, want %v", got, http.StatusOK)
+	}
+
+	// Replace the CertManager with a new one.
+	ac := certchaintest.MustReadAugmentedChainFile(cborFile)
+	config.CertManager = certmanager.NewManager(certmanager.Config{
+		RawChainSource: &stubRawChainSource{ac.RawChain},
+		OCSPRespSource: &stubOCSPRespSource{ac.OCSPResp},
+		Cache:          newStubCache(),
+	})
+	if err := s.Reload(config); err != nil {
+		t.Fatalf("Reload() = error(%q), want success", err)
+	}
+	if got := get("/status"); got != http.StatusOK {
+		t.Errorf("StatusCode for /status = %v, want %v", got, http.StatusOK)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var entered sync.Once
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	www := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered.Do(func() { close(inFlight) })
+		<-release
+		html := "<!doctype html><p>Hello, world!</p>"
+		http.ServeContent(w, r, "slow.html", time.Time{}, strings.NewReader(html))
+	}))
+	defer www.Close()
+	s, addr := setupServer(www)
+
+	timeutil.StubNowToAdjust(time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	status := make(chan int, 1)
+	go func() {
+		url := "http://" + addr + "/priv/doc/https://example.com/public/slow.html"
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			panic(err)
+		}
+		req.Header.Add("Accept", "application/signed-exchange;v=b3")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-inFlight
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() = %v before the request completed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("StatusCode = %v, want %v", got, http.StatusOK)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() = error(%q), want success", err)
+	}
+	if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		t.Errorf("http.Get() after Shutdown() = success, want error")
+	}
+}
@@ -26,17 +26,26 @@ import (
 type Config struct {
 	Listen    ListenConfig
 	Server    ServerConfig
+	Relay     RelayConfig
 	SXG       SXGConfig
+	Identity  []IdentityConfig
 	Sign      SignConfig
+	Fetch     FetchConfig
 	Processor ProcessorConfig
 	Cache     CacheConfig
+	Admin     AdminConfig
 }
 
 // ListenConfig represents the [Listen] section.
 type ListenConfig struct {
-	Host string
-	Port int
-	TLS  TLSConfig
+	Host              string
+	Port              int
+	TLS               TLSConfig
+	ReadTimeout       string `default:"10s"`
+	ReadHeaderTimeout string `default:"5s"`
+	WriteTimeout      string `default:"60s"`
+	IdleTimeout       string `default:"120s"`
+	ShutdownTimeout   string `default:"30s"`
 }
 
 // TLSConfig is part of ListenConfig.
@@ -52,6 +61,14 @@ type ServerConfig struct {
 	ValidityPath string `default:"/webpkg/validity"`
 	HealthPath   string `default:"/healthz"`
 	SignParam    string `default:"sign"`
+	ReverseProxy bool
+}
+
+// RelayConfig represents the [Relay] section.
+type RelayConfig struct {
+	SizeLimit   int `default:"65536"`
+	Redirects   bool
+	NotFoundTTL string `default:"0s"`
 }
 
 // SXGConfig represents the [SXG] section.
@@ -87,21 +104,73 @@ type SXGACMEConfig struct {
 	DNSProvider       string
 }
 
+// IdentityConfig represents the [[Identity]] sections. Each of them is a
+// named signing identity, which takes the same parameters as [SXG].
+type IdentityConfig struct {
+	Name string
+	SXGConfig
+}
+
 // SignConfig represents the [[Sign]] sections.
 type SignConfig []URLConfig
 
 // URLConfig represents each of the [[Sign]] sections.
 type URLConfig struct {
-	Domain  string
-	PathRE  string `default:".*"`
-	QueryRE string `default:""`
+	Domain    string
+	PathRE    string `default:".*"`
+	QueryRE   string `default:""`
+	Identity  string
+	Processor *ProcessorConfig
+	Backend   *BackendConfig
+}
+
+// BackendConfig represents the [Sign.Backend] sections.
+type BackendConfig struct {
+	URL        string
+	CAFile     string
+	ServerName string
 }
 
-// ProcessorConfig represents the [Processor] section.
+// FetchConfig represents the [Fetch] section.
+type FetchConfig struct {
+	Timeout           string `default:"0s"`
+	RequestsPerSecond float64
+	Burst             int `default:"1"`
+	MaxConcurrency    int
+	RespectRetryAfter bool
+	MaxRetryAfter     string `default:"1m"`
+	MaxRetries        int
+	RetryStatusCodes  []int
+	BreakerThreshold  int
+	BreakerCooldown   string `default:"30s"`
+	AllowedNetworks   []string
+	ForwardHeaders    []string
+	CustomHeaders     map[string]string
+}
+
+// ProcessorConfig represents the [Processor] section, as well as the
+// [Sign.Processor] sections.
 type ProcessorConfig struct {
-	SizeLimit  int `default:"4194304"`
-	PreloadCSS bool
-	PreloadJS  bool
+	SizeLimit              int `default:"4194304"`
+	ContentEncoding        string
+	PreloadCSS             bool
+	PreloadJS              bool
+	PreloadJSWithIntegrity bool
+	PreloadLCPImages       int
+	LCPImageBudget         int
+	PreloadOptInAttr       string
+	AMPProfile             string `default:"ignore"`
+	PreloadCrossOrigin     bool
+	Plugin                 []PluginConfig
+}
+
+// PluginConfig represents the [[Processor.Plugin]] sections.
+type PluginConfig struct {
+	Command        string
+	Args           []string
+	MediaTypes     []string
+	Timeout        string `default:"10s"`
+	MaxPayloadSize int
 }
 
 // CacheConfig represents the [Cache] section.
@@ -109,6 +178,14 @@ type CacheConfig struct {
 	MaxEntries int `default:"200"`
 }
 
+// AdminConfig represents the [Admin] section.
+type AdminConfig struct {
+	Enable    bool
+	Host      string `default:"localhost"`
+	Port      int
+	TokenFile string
+}
+
 // ReadFromFile reads a Config from filename. It also validates all fields
 // and returns error if the validation fails.
 func ReadFromFile(filename string) (*Config, error) {
@@ -16,7 +16,9 @@ package tomlconfig_test
 
 import (
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/webpackager/server/tomlconfig"
 )
 
@@ -28,3 +30,498 @@ func TestReadFromFile(t *testing.T) {
 		t.Errorf("ReadFromFile(%q) = error(%q), want success", filename, err)
 	}
 }
+
+func TestParseConfig_SignProcessor(t *testing.T) {
+	const data = `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+  PathRE = '/blog/.*'
+  [Sign.Processor]
+    PreloadCSS = true
+
+[[Sign]]
+  Domain = 'example.org'
+
+[Processor]
+  SizeLimit = 1000
+`
+	cfg, err := tomlconfig.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig() = error(%q), want success", err)
+	}
+
+	pc := cfg.Sign[0].Processor
+	if pc == nil {
+		t.Fatalf("Sign[0].Processor = nil, want non-nil")
+	}
+	if !pc.PreloadCSS {
+		t.Errorf("Sign[0].Processor.PreloadCSS = false, want true")
+	}
+	// Not inherited from [Processor].
+	if pc.SizeLimit != 4194304 {
+		t.Errorf("Sign[0].Processor.SizeLimit = %v, want 4194304", pc.SizeLimit)
+	}
+	if cfg.Sign[1].Processor != nil {
+		t.Errorf("Sign[1].Processor = %+v, want nil", cfg.Sign[1].Processor)
+	}
+}
+
+func TestParseConfig_PreloadCrossOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "TopLevel",
+			data: `
+[[Sign]]
+  Domain = 'example.org'
+
+[Processor]
+  PreloadCrossOrigin = true
+`,
+		},
+		{
+			name: "SignProcessor",
+			data: `
+[[Sign]]
+  Domain = 'example.org'
+  [Sign.Processor]
+    PreloadCrossOrigin = true
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+` + test.data
+			_, err := tomlconfig.ParseConfig([]byte(data))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseConfig() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseConfig() = error(%q), want success", err)
+			}
+		})
+	}
+}
+
+func TestParseConfig_PluginArgs(t *testing.T) {
+	const data = `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+
+[[Processor.Plugin]]
+  Command = '/opt/plugins/rewrite'
+  Args = ['--title', 'Hello, world', '--quote="x y"']
+`
+	c, err := tomlconfig.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig() = error(%q), want success", err)
+	}
+	want := []string{"--title", "Hello, world", `--quote="x y"`}
+	if diff := cmp.Diff(want, c.Processor.Plugin[0].Args); diff != "" {
+		t.Errorf("Plugin[0].Args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseConfig_Fetch(t *testing.T) {
+	const data = `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+
+[Fetch]
+  Timeout = '20s'
+  RequestsPerSecond = 0.5
+  MaxConcurrency = 4
+  MaxRetries = 2
+  RetryStatusCodes = [500, 503]
+  AllowedNetworks = ['10.1.0.0/16']
+  ForwardHeaders = ['Accept-Language']
+  [Fetch.CustomHeaders]
+    X-Webpkgserver = '1'
+`
+	cfg, err := tomlconfig.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig() = error(%q), want success", err)
+	}
+
+	want := tomlconfig.FetchConfig{
+		Timeout:           "20s",
+		RequestsPerSecond: 0.5,
+		Burst:             1,
+		MaxConcurrency:    4,
+		MaxRetryAfter:     "1m",
+		MaxRetries:        2,
+		RetryStatusCodes:  []int{500, 503},
+		BreakerCooldown:   "30s",
+		AllowedNetworks:   []string{"10.1.0.0/16"},
+		ForwardHeaders:    []string{"Accept-Language"},
+		CustomHeaders:     map[string]string{"X-Webpkgserver": "1"},
+	}
+	if diff := cmp.Diff(want, cfg.Fetch); diff != "" {
+		t.Errorf("Fetch mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseConfig_SignBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr bool
+	}{
+		{
+			name:    "HTTP",
+			backend: `URL = 'http://10.0.0.5:8080'`,
+		},
+		{
+			name:    "HTTPSWithCAFile",
+			backend: "URL = 'https://origin.internal/'\nCAFile = 'ca.pem'",
+		},
+		{
+			name:    "MissingURL",
+			backend: `ServerName = 'example.org'`,
+			wantErr: true,
+		},
+		{
+			name:    "WithPath",
+			backend: `URL = 'http://10.0.0.5/app/'`,
+			wantErr: true,
+		},
+		{
+			name:    "NotHTTP",
+			backend: `URL = 'ftp://10.0.0.5'`,
+			wantErr: true,
+		},
+		{
+			name:    "CAFileWithHTTP",
+			backend: "URL = 'http://10.0.0.5'\nCAFile = 'ca.pem'",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+  [Sign.Backend]
+` + test.backend + "\n"
+			cfg, err := tomlconfig.ParseConfig([]byte(data))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseConfig() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfig() = error(%q), want success", err)
+			}
+			if cfg.Sign[0].Backend == nil {
+				t.Errorf("Sign[0].Backend = nil, want non-nil")
+			}
+		})
+	}
+}
+
+func TestParseConfig_Relay(t *testing.T) {
+	const data = `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+
+[Relay]
+  Redirects = true
+  NotFoundTTL = '30s'
+`
+	cfg, err := tomlconfig.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig() = error(%q), want success", err)
+	}
+
+	want := tomlconfig.RelayConfig{
+		SizeLimit:   65536,
+		Redirects:   true,
+		NotFoundTTL: "30s",
+	}
+	if diff := cmp.Diff(want, cfg.Relay); diff != "" {
+		t.Errorf("Relay mismatch (-want +got):\n%s", diff)
+	}
+	if got := cfg.Relay.GetNotFoundTTL(); got != 30*time.Second {
+		t.Errorf("GetNotFoundTTL() = %v, want 30s", got)
+	}
+}
+
+func TestParseConfig_Identity(t *testing.T) {
+	const identities = `
+[[Identity]]
+  Name = 'com'
+  CertURLBase = 'https://example.com/webpkg/cert'
+  [Identity.Cert]
+    PEMFile = 'com.pem'
+    KeyFile = 'com.key'
+    CacheDir = '/tmp/webpkg/com'
+
+[[Identity]]
+  Name = 'net'
+  [Identity.Cert]
+    PEMFile = 'net.pem'
+    KeyFile = 'net.key'
+`
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "WithoutDefault",
+			data: identities + `
+[[Sign]]
+  Domain = 'example.com'
+  Identity = 'com'
+
+[[Sign]]
+  Domain = 'example.net'
+  Identity = 'net'
+`,
+		},
+		{
+			name: "WithDefault",
+			data: identities + `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+
+[[Sign]]
+  Domain = 'example.com'
+  Identity = 'com'
+`,
+		},
+		{
+			name: "MissingDefault",
+			data: identities + `
+[[Sign]]
+  Domain = 'example.org'
+`,
+			wantErr: true,
+		},
+		{
+			name: "NoSuchIdentity",
+			data: identities + `
+[[Sign]]
+  Domain = 'example.org'
+  Identity = 'org'
+`,
+			wantErr: true,
+		},
+		{
+			name: "InconsistentIdentity",
+			data: identities + `
+[[Sign]]
+  Domain = 'example.com'
+  PathRE = '/a/.*'
+  Identity = 'com'
+
+[[Sign]]
+  Domain = 'Example.com'
+  Identity = 'net'
+`,
+			wantErr: true,
+		},
+		{
+			name: "DuplicateName",
+			data: identities + `
+[[Identity]]
+  Name = 'com'
+  [Identity.Cert]
+    PEMFile = 'com2.pem'
+    KeyFile = 'com2.key'
+
+[[Sign]]
+  Domain = 'example.com'
+  Identity = 'com'
+`,
+			wantErr: true,
+		},
+		{
+			name: "SharedCacheDir",
+			data: identities + `
+[[Identity]]
+  Name = 'org'
+  [Identity.Cert]
+    PEMFile = 'org.pem'
+    KeyFile = 'org.key'
+    CacheDir = '/tmp/webpkg/com/'
+
+[[Sign]]
+  Domain = 'example.org'
+  Identity = 'org'
+`,
+			wantErr: true,
+		},
+		{
+			name: "MissingName",
+			data: `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Identity]]
+  [Identity.Cert]
+    PEMFile = 'com.pem'
+    KeyFile = 'com.key'
+
+[[Sign]]
+  Domain = 'example.org'
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := tomlconfig.ParseConfig([]byte(test.data))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseConfig() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfig() = error(%q), want success", err)
+			}
+			// Unspecified parameters take the same defaults as [SXG].
+			if got, want := cfg.Identity[1].Expiry, cfg.SXG.Expiry; got != want {
+				t.Errorf("Identity[1].Expiry = %q, want %q", got, want)
+			}
+			if got := cfg.Identity[0].GetCertURLBase().String(); got != "https://example.com/webpkg/cert" {
+				t.Errorf("Identity[0].GetCertURLBase() = %q, want %q", got, "https://example.com/webpkg/cert")
+			}
+		})
+	}
+}
+
+func TestParseConfig_ListenTimeouts(t *testing.T) {
+	const data = `
+[Listen]
+  WriteTimeout = '2m'
+  IdleTimeout = '0s'
+
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+`
+	cfg, err := tomlconfig.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig() = error(%q), want success", err)
+	}
+
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"ReadTimeout", cfg.Listen.GetReadTimeout(), 10 * time.Second},
+		{"ReadHeaderTimeout", cfg.Listen.GetReadHeaderTimeout(), 5 * time.Second},
+		{"WriteTimeout", cfg.Listen.GetWriteTimeout(), 2 * time.Minute},
+		{"IdleTimeout", cfg.Listen.GetIdleTimeout(), 0},
+		{"ShutdownTimeout", cfg.Listen.GetShutdownTimeout(), 30 * time.Second},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("Get%s() = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	if _, err := tomlconfig.ParseConfig([]byte(data + "\n[Fetch]\n  Timeout = '-1s'\n")); err == nil {
+		t.Errorf("ParseConfig() with negative Fetch.Timeout = success, want error")
+	}
+}
+
+func TestParseConfig_Admin(t *testing.T) {
+	const data = `
+[SXG.Cert]
+  PEMFile = 'cert.pem'
+  KeyFile = 'priv.key'
+
+[[Sign]]
+  Domain = 'example.org'
+`
+	tests := []struct {
+		name    string
+		admin   string
+		wantErr bool
+	}{
+		{
+			name:    "Disabled",
+			admin:   "",
+			wantErr: false,
+		},
+		{
+			name:    "Enabled",
+			admin:   "[Admin]\n  Enable = true\n  Port = 8081\n  TokenFile = 'admin.token'\n",
+			wantErr: false,
+		},
+		{
+			name:    "NoTokenFile",
+			admin:   "[Admin]\n  Enable = true\n  Port = 8081\n",
+			wantErr: true,
+		},
+		{
+			name:    "PortOutOfRange",
+			admin:   "[Admin]\n  Enable = true\n  Port = 65536\n  TokenFile = 'admin.token'\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := tomlconfig.ParseConfig([]byte(data + test.admin))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseConfig() = success, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfig() = error(%q), want success", err)
+			}
+			if got := cfg.Admin.Host; got != "localhost" {
+				t.Errorf("Admin.Host = %q, want %q", got, "localhost")
+			}
+		})
+	}
+}
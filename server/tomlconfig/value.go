@@ -16,12 +16,15 @@ package tomlconfig
 
 import (
 	"errors"
+	"net"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/webpackager/internal/urlutil"
+	"github.com/google/webpackager/processor/htmlproc"
 	"golang.org/x/xerrors"
 )
 
@@ -34,6 +37,41 @@ const (
 	maxJSExpiry = 24 * time.Hour
 )
 
+// GetReadTimeout returns a parsed c.ReadTimeout. It panics if c.ReadTimeout
+// contains an invalid value; it should not happen if c is obtained using
+// ParseConfig or ReadFromFile.
+func (c *ListenConfig) GetReadTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.ReadTimeout)
+}
+
+// GetReadHeaderTimeout returns a parsed c.ReadHeaderTimeout. It panics if
+// c.ReadHeaderTimeout contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *ListenConfig) GetReadHeaderTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.ReadHeaderTimeout)
+}
+
+// GetWriteTimeout returns a parsed c.WriteTimeout. It panics if
+// c.WriteTimeout contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *ListenConfig) GetWriteTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.WriteTimeout)
+}
+
+// GetIdleTimeout returns a parsed c.IdleTimeout. It panics if c.IdleTimeout
+// contains an invalid value; it should not happen if c is obtained using
+// ParseConfig or ReadFromFile.
+func (c *ListenConfig) GetIdleTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.IdleTimeout)
+}
+
+// GetShutdownTimeout returns a parsed c.ShutdownTimeout. It panics if
+// c.ShutdownTimeout contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *ListenConfig) GetShutdownTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.ShutdownTimeout)
+}
+
 // GetExpiry returns a parsed c.Expiry. It panics if c.Expiry contains an
 // invalid value; it should not happen if c is obtained using ParseConfig
 // or ReadFromFile.
@@ -98,6 +136,17 @@ func (c *SXGConfig) GetValidityURL() *url.URL {
 	return urlutil.MustParse(c.ValidityURL)
 }
 
+// UsesDefaultIdentity reports whether any of the [[Sign]] sections uses
+// the default signing identity, i.e. [SXG], rather than an [[Identity]].
+func (c SignConfig) UsesDefaultIdentity() bool {
+	for _, uc := range c {
+		if uc.Identity == "" {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPathRE returns a compiled c.PathRE. It also encloses the regexp with
 // `\A(?:...)\z` to make it a full match. It panics if c.PathRE is malformed;
 // it should not happen if c is obtained using ParseConfig or ReadFromFile.
@@ -115,3 +164,119 @@ func (c *URLConfig) GetQueryRE() *regexp.Regexp {
 func mustCompileFullMatch(pattern string) *regexp.Regexp {
 	return regexp.MustCompile(`\A(?:` + pattern + `)\z`)
 }
+
+// GetAMPProfile returns a parsed c.AMPProfile. It panics if c.AMPProfile
+// contains an invalid value; it should not happen if c is obtained using
+// ParseConfig or ReadFromFile.
+func (c *ProcessorConfig) GetAMPProfile() htmlproc.AMPProfile {
+	p, err := htmlproc.ParseAMPProfile(c.AMPProfile)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// GetTimeout returns a parsed c.Timeout. It panics if c.Timeout contains an
+// invalid value; it should not happen if c is obtained using ParseConfig or
+// ReadFromFile.
+func (c *PluginConfig) GetTimeout() time.Duration {
+	d, err := parsePositiveDuration(c.Timeout)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// GetTimeout returns a parsed c.Timeout. It panics if c.Timeout contains an
+// invalid value; it should not happen if c is obtained using ParseConfig or
+// ReadFromFile.
+func (c *FetchConfig) GetTimeout() time.Duration {
+	return mustParseNonNegativeDuration(c.Timeout)
+}
+
+// GetMaxRetryAfter returns a parsed c.MaxRetryAfter. It panics if
+// c.MaxRetryAfter contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *FetchConfig) GetMaxRetryAfter() time.Duration {
+	d, err := parsePositiveDuration(c.MaxRetryAfter)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// GetBreakerCooldown returns a parsed c.BreakerCooldown. It panics if
+// c.BreakerCooldown contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *FetchConfig) GetBreakerCooldown() time.Duration {
+	d, err := parsePositiveDuration(c.BreakerCooldown)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// GetAllowedNetworks returns parsed c.AllowedNetworks. It panics if
+// c.AllowedNetworks contains an invalid value; it should not happen if c is
+// obtained using ParseConfig or ReadFromFile.
+func (c *FetchConfig) GetAllowedNetworks() []*net.IPNet {
+	nets := make([]*net.IPNet, len(c.AllowedNetworks))
+	for i, cidr := range c.AllowedNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// GetNotFoundTTL returns a parsed c.NotFoundTTL. It panics if c.NotFoundTTL
+// contains an invalid value; it should not happen if c is obtained using
+// ParseConfig or ReadFromFile.
+func (c *RelayConfig) GetNotFoundTTL() time.Duration {
+	d, err := parseNonNegativeDuration(c.NotFoundTTL)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// GetCustomHeaders returns c.CustomHeaders as an http.Header.
+func (c *FetchConfig) GetCustomHeaders() http.Header {
+	header := make(http.Header, len(c.CustomHeaders))
+	for key, value := range c.CustomHeaders {
+		header.Set(key, value)
+	}
+	return header
+}
+
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
+
+func parseNonNegativeDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("duration must not be negative")
+	}
+	return d, nil
+}
+
+func mustParseNonNegativeDuration(value string) time.Duration {
+	d, err := parseNonNegativeDuration(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
@@ -17,12 +17,16 @@ package tomlconfig
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"path"
 	"regexp"
 	"strings"
 
+	"github.com/google/webpackager/mediatype"
+	"github.com/google/webpackager/processor/htmlproc"
 	"github.com/hashicorp/go-multierror"
+	"golang.org/x/net/http/httpguts"
 )
 
 var (
@@ -41,15 +45,33 @@ func (c *Config) Verify() error {
 	if err := c.Server.verify(); err != nil {
 		errs = multierror.Append(errs, wrapError("Server", err))
 	}
-	if err := c.SXG.verify(); err != nil {
+	if err := c.Relay.verify(); err != nil {
+		errs = multierror.Append(errs, wrapError("Relay", err))
+	}
+	if err := c.SXG.verify(c.Sign.UsesDefaultIdentity()); err != nil {
 		errs = multierror.Append(errs, wrapError("SXG", err))
 	}
+	for i, ic := range c.Identity {
+		if err := ic.verify(); err != nil {
+			name := fmt.Sprintf("Identity[%d]", i)
+			errs = multierror.Append(errs, wrapError(name, err))
+		}
+	}
 	if err := c.Sign.verify(); err != nil {
 		errs = multierror.Append(errs, wrapError("Sign", err))
 	}
+	if err := c.verifyIdentities(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := c.Fetch.verify(); err != nil {
+		errs = multierror.Append(errs, wrapError("Fetch", err))
+	}
 	if err := c.Processor.verify(); err != nil {
 		errs = multierror.Append(errs, wrapError("Processor", err))
 	}
+	if err := c.Admin.verify(); err != nil {
+		errs = multierror.Append(errs, wrapError("Admin", err))
+	}
 
 	return errs.ErrorOrNil() // TODO(yuizumi): Format it better.
 }
@@ -63,6 +85,21 @@ func (c *ListenConfig) verify() error {
 	if err := c.TLS.verify(); err != nil {
 		errs = multierror.Append(errs, wrapError("TLS", err))
 	}
+	timeouts := []struct {
+		name  string
+		value string
+	}{
+		{"ReadTimeout", c.ReadTimeout},
+		{"ReadHeaderTimeout", c.ReadHeaderTimeout},
+		{"WriteTimeout", c.WriteTimeout},
+		{"IdleTimeout", c.IdleTimeout},
+		{"ShutdownTimeout", c.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if _, err := parseNonNegativeDuration(t.value); err != nil {
+			errs = multierror.Append(errs, wrapError(t.name, err))
+		}
+	}
 
 	return errs.ErrorOrNil()
 }
@@ -96,7 +133,80 @@ func (c *ServerConfig) verify() error {
 	return errs.ErrorOrNil()
 }
 
-func (c *SXGConfig) verify() error {
+func (c *RelayConfig) verify() error {
+	var errs *multierror.Error
+
+	if c.SizeLimit < 0 {
+		errs = multierror.Append(errs, wrapError("SizeLimit", errRange))
+	}
+	if _, err := parseNonNegativeDuration(c.NotFoundTTL); err != nil {
+		errs = multierror.Append(errs, wrapError("NotFoundTTL", err))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// verifyIdentities verifies the references to and among the signing
+// identities across the sections.
+func (c *Config) verifyIdentities() error {
+	var errs *multierror.Error
+
+	names := make(map[string]bool)
+	for i, ic := range c.Identity {
+		if names[ic.Name] {
+			name := fmt.Sprintf("Identity[%d].Name", i)
+			errs = multierror.Append(errs, newError(name, "duplicate name"))
+		}
+		names[ic.Name] = true
+	}
+
+	domains := make(map[string]string)
+	for i, uc := range c.Sign {
+		name := fmt.Sprintf("Sign[%d].Identity", i)
+		if uc.Identity != "" && !names[uc.Identity] {
+			errs = multierror.Append(errs, newError(name, "no such identity"))
+		}
+		domain := strings.ToLower(uc.Domain)
+		if id, ok := domains[domain]; ok && id != uc.Identity {
+			errs = multierror.Append(errs, newError(name, "must be the same for the same Domain"))
+		}
+		domains[domain] = uc.Identity
+	}
+
+	cacheDirs := make(map[string]bool)
+	if c.Sign.UsesDefaultIdentity() && c.SXG.Cert.CacheDir != "" {
+		cacheDirs[path.Clean(c.SXG.Cert.CacheDir)] = true
+	}
+	for i, ic := range c.Identity {
+		if ic.Cert.CacheDir == "" {
+			continue
+		}
+		dir := path.Clean(ic.Cert.CacheDir)
+		if cacheDirs[dir] {
+			name := fmt.Sprintf("Identity[%d].Cert.CacheDir", i)
+			errs = multierror.Append(errs, newError(name, "must not be shared"))
+		}
+		cacheDirs[dir] = true
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *IdentityConfig) verify() error {
+	var errs *multierror.Error
+
+	if c.Name == "" {
+		errs = multierror.Append(errs, wrapError("Name", errEmpty))
+	}
+	if err := c.SXGConfig.verify(true); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// verify verifies c. The certificate is verified only if withCert is true.
+func (c *SXGConfig) verify(withCert bool) error {
 	var errs *multierror.Error
 
 	if _, err := parseExpiry(c.Expiry); err != nil {
@@ -111,6 +221,9 @@ func (c *SXGConfig) verify() error {
 	if err := verifyValidityURL(c.ValidityURL); err != nil {
 		errs = multierror.Append(errs, wrapError("ValidityURL", err))
 	}
+	if !withCert {
+		return errs.ErrorOrNil()
+	}
 	if err := c.Cert.verify(); err != nil {
 		errs = multierror.Append(errs, wrapError("Cert", err))
 	}
@@ -190,6 +303,100 @@ func (c *URLConfig) verify() error {
 	if _, err := regexp.Compile(c.QueryRE); err != nil {
 		errs = multierror.Append(errs, wrapError("QueryRE", err))
 	}
+	if c.Processor != nil {
+		if err := c.Processor.verify(); err != nil {
+			errs = multierror.Append(errs, wrapError("Processor", err))
+		}
+		if c.Processor.PreloadCrossOrigin {
+			// It selects the certificates, which applies to all [[Sign]].
+			errs = multierror.Append(errs, newError("Processor.PreloadCrossOrigin", "allowed only in the top-level [Processor]"))
+		}
+	}
+	if c.Backend != nil {
+		if err := c.Backend.verify(); err != nil {
+			errs = multierror.Append(errs, wrapError("Backend", err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *BackendConfig) verify() error {
+	var errs *multierror.Error
+
+	if c.URL == "" {
+		errs = multierror.Append(errs, wrapError("URL", errEmpty))
+	} else if u, err := url.Parse(c.URL); err != nil {
+		errs = multierror.Append(errs, wrapError("URL", err))
+	} else {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			errs = multierror.Append(errs, newError("URL", "must be an http:// or https:// url"))
+		}
+		if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") ||
+			u.RawQuery != "" || u.Fragment != "" {
+			errs = multierror.Append(errs, newError("URL", "must only contain the scheme, host, and port"))
+		}
+		if u.Scheme != "https" && (c.CAFile != "" || c.ServerName != "") {
+			errs = multierror.Append(errs, errors.New("CAFile and ServerName require an https:// URL"))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *FetchConfig) verify() error {
+	var errs *multierror.Error
+
+	if _, err := parseNonNegativeDuration(c.Timeout); err != nil {
+		errs = multierror.Append(errs, wrapError("Timeout", err))
+	}
+	if c.RequestsPerSecond < 0 {
+		errs = multierror.Append(errs, wrapError("RequestsPerSecond", errRange))
+	}
+	if c.Burst <= 0 {
+		errs = multierror.Append(errs, wrapError("Burst", errRange))
+	}
+	if c.MaxConcurrency < 0 {
+		errs = multierror.Append(errs, wrapError("MaxConcurrency", errRange))
+	}
+	if _, err := parsePositiveDuration(c.MaxRetryAfter); err != nil {
+		errs = multierror.Append(errs, wrapError("MaxRetryAfter", err))
+	}
+	if c.MaxRetries < 0 {
+		errs = multierror.Append(errs, wrapError("MaxRetries", errRange))
+	}
+	for i, code := range c.RetryStatusCodes {
+		if code < 100 || code > 599 {
+			name := fmt.Sprintf("RetryStatusCodes[%d]", i)
+			errs = multierror.Append(errs, wrapError(name, errRange))
+		}
+	}
+	if c.BreakerThreshold < 0 {
+		errs = multierror.Append(errs, wrapError("BreakerThreshold", errRange))
+	}
+	if _, err := parsePositiveDuration(c.BreakerCooldown); err != nil {
+		errs = multierror.Append(errs, wrapError("BreakerCooldown", err))
+	}
+	for i, key := range c.ForwardHeaders {
+		if !httpguts.ValidHeaderFieldName(key) {
+			name := fmt.Sprintf("ForwardHeaders[%d]", i)
+			errs = multierror.Append(errs, newError(name, "invalid header name"))
+		}
+	}
+	for key, value := range c.CustomHeaders {
+		name := fmt.Sprintf("CustomHeaders.%s", key)
+		if !httpguts.ValidHeaderFieldName(key) {
+			errs = multierror.Append(errs, newError(name, "invalid header name"))
+		} else if !httpguts.ValidHeaderFieldValue(value) {
+			errs = multierror.Append(errs, newError(name, "invalid header value"))
+		}
+	}
+	for i, cidr := range c.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			name := fmt.Sprintf("AllowedNetworks[%d]", i)
+			errs = multierror.Append(errs, wrapError(name, err))
+		}
+	}
 
 	return errs.ErrorOrNil()
 }
@@ -200,10 +407,50 @@ func (c *ProcessorConfig) verify() error {
 	if c.SizeLimit <= 0 {
 		errs = multierror.Append(errs, wrapError("SizeLimit", errRange))
 	}
+	switch c.ContentEncoding {
+	case "", "gzip", "deflate":
+	default:
+		errs = multierror.Append(errs, newError("ContentEncoding", `must be "gzip", "deflate", or empty`))
+	}
+	if c.PreloadLCPImages < 0 {
+		errs = multierror.Append(errs, wrapError("PreloadLCPImages", errRange))
+	}
+	if c.LCPImageBudget < 0 {
+		errs = multierror.Append(errs, wrapError("LCPImageBudget", errRange))
+	}
+	if _, err := htmlproc.ParseAMPProfile(c.AMPProfile); err != nil {
+		errs = multierror.Append(errs, wrapError("AMPProfile", err))
+	}
+	for i, pc := range c.Plugin {
+		if err := pc.verify(); err != nil {
+			errs = multierror.Append(errs, wrapError(fmt.Sprintf("Plugin[%d]", i), err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *PluginConfig) verify() error {
+	var errs *multierror.Error
+
+	if c.Command == "" {
+		errs = multierror.Append(errs, wrapError("Command", errEmpty))
+	}
+	for i, mt := range c.MediaTypes {
+		if mediatype.Candidates(mt) == nil || mt != strings.ToLower(mt) {
+			name := fmt.Sprintf("MediaTypes[%d]", i)
+			errs = multierror.Append(errs, newError(name, "must be a lowercase media type"))
+		}
+	}
+	if _, err := parsePositiveDuration(c.Timeout); err != nil {
+		errs = multierror.Append(errs, wrapError("Timeout", err))
+	}
 
 	return errs.ErrorOrNil()
 }
 
+// verifyPreloadHost checks host is a bare hostname covered by one of
+// the [[Sign]] sections, so the preloaded resources can be fetched and signed.
 func verifyParamName(value string) error {
 	if value == "" {
 		return errEmpty
@@ -285,3 +532,16 @@ func verifyCertURL(value string) error {
 	}
 	return verifyURLImpl(value, verifyCertURLMessage)
 }
+
+func (c *AdminConfig) verify() error {
+	var errs *multierror.Error
+
+	if c.Port < 0 || c.Port >= 65536 {
+		errs = multierror.Append(errs, wrapError("Port", errRange))
+	}
+	if c.Enable && c.TokenFile == "" {
+		errs = multierror.Append(errs, wrapError("TokenFile", errEmpty))
+	}
+
+	return errs.ErrorOrNil()
+}
@@ -20,11 +20,15 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/WICG/webpackage/go/signedexchange"
 	"github.com/google/webpackager/exchange"
+	"github.com/google/webpackager/internal/sri"
+	"github.com/google/webpackager/processor/commonproc"
 	"github.com/google/webpackager/resource"
+	"github.com/google/webpackager/resource/preload"
 	multierror "github.com/hashicorp/go-multierror"
 	"golang.org/x/xerrors"
 )
@@ -41,34 +45,70 @@ var (
 	errReferenceLoop = errors.New("detected cyclic reference")
 )
 
+// maxNumPreloads is the maximum number of preload links in a signed exchange.
+// See docs/cache_requirements.md.
+const maxNumPreloads = 20
+
 type packagerTaskRunner struct {
 	*Packager
 
-	date       time.Time
-	sxgFactory *exchange.Factory
-	errs       *multierror.Error
-	active     map[string]bool // Keyed by URLs.
+	date      time.Time
+	factory   *exchange.Factory            // nil with URLFactoryProvider.
+	factories map[string]*exchange.Factory // Keyed by hostnames.
+	errs      *multierror.Error
+	active    map[string]bool // Keyed by URLs.
 }
 
 func newTaskRunner(p *Packager, date time.Time) (*packagerTaskRunner, error) {
-	ef, err := p.ExchangeFactory.Get()
-	if err != nil {
-		return nil, xerrors.Errorf("creating task runner: %w", err)
+	var ef *exchange.Factory
+	// URLFactoryProvider is asked for the Factory per hostname on demand.
+	// Otherwise the same Factory is used throughout the run.
+	if _, ok := p.ExchangeFactory.(exchange.URLFactoryProvider); !ok {
+		var err error
+		ef, err = p.ExchangeFactory.Get()
+		if err != nil {
+			return nil, xerrors.Errorf("creating task runner: %w", err)
+		}
 	}
 	return &packagerTaskRunner{
 		p,
 		date,
 		ef,
+		make(map[string]*exchange.Factory),
 		new(multierror.Error),
 		make(map[string]bool),
 	}, nil
 }
 
+// getFactory returns the exchange.Factory to sign the resource at u. With
+// URLFactoryProvider, it fails if the certificate of the Factory is not valid
+// for the hostname of u, since the signed exchange would never be valid.
+func (runner *packagerTaskRunner) getFactory(u *url.URL) (*exchange.Factory, error) {
+	if runner.factory != nil {
+		return runner.factory, nil
+	}
+	host := u.Hostname()
+	if ef, ok := runner.factories[host]; ok {
+		return ef, nil
+	}
+	ef, err := runner.ExchangeFactory.(exchange.URLFactoryProvider).GetForURL(u)
+	if err != nil {
+		return nil, err
+	}
+	if err := ef.VerifyHostname(host); err != nil {
+		return nil, xerrors.Errorf("certificate not valid for %q: %w", host, err)
+	}
+	runner.factories[host] = ef
+	return ef, nil
+}
+
 func (runner *packagerTaskRunner) err() error {
 	return runner.errs.ErrorOrNil()
 }
 
-func (runner *packagerTaskRunner) run(parent *packagerTask, req *http.Request, r *resource.Resource) {
+// run runs the packaging process for r. p is the Preload which r is loaded
+// with, or nil for the main resource.
+func (runner *packagerTaskRunner) run(parent *packagerTask, req *http.Request, r *resource.Resource, p *preload.Preload) {
 	url := r.RequestURL.String()
 	var err error
 
@@ -77,7 +117,12 @@ func (runner *packagerTaskRunner) run(parent *packagerTask, req *http.Request, r
 	} else {
 		log.Printf("processing %v ...", url)
 		runner.active[url] = true
-		err = (&packagerTask{runner, parent, req, r}).run()
+		task := &packagerTask{runner, parent, req, r, "", false, nil}
+		if p != nil {
+			task.integrity = p.Integrity
+			task.module = p.Module
+		}
+		err = task.run()
 		delete(runner.active, url)
 	}
 
@@ -91,9 +136,12 @@ func (runner *packagerTaskRunner) run(parent *packagerTask, req *http.Request, r
 type packagerTask struct {
 	*packagerTaskRunner
 
-	parent   *packagerTask
-	request  *http.Request
-	resource *resource.Resource
+	parent     *packagerTask
+	request    *http.Request
+	resource   *resource.Resource
+	integrity  string // Empty to not verify the payload.
+	module     bool
+	sxgFactory *exchange.Factory
 }
 
 func (task *packagerTask) parentRequest() *http.Request {
@@ -106,17 +154,28 @@ func (task *packagerTask) parentRequest() *http.Request {
 func (task *packagerTask) run() error {
 	r := task.resource
 
+	sxgFactory, err := task.getFactory(r.RequestURL)
+	if err != nil {
+		return err
+	}
+	task.sxgFactory = sxgFactory
+
 	req := task.request
 	if err := task.RequestTweaker.Tweak(req, task.parentRequest()); err != nil {
 		return err
 	}
+	r.VaryHeader = task.varyHeader(req)
 
 	cached, err := task.ResourceCache.Lookup(req)
 	if err != nil {
 		return err
 	}
 	if cached != nil {
-		if _, err := task.sxgFactory.Verify(cached.Exchange, task.date); err == nil {
+		payload, err := task.sxgFactory.Verify(cached.Exchange, task.date)
+		if err == nil {
+			err = task.verifyIntegrity(cached.Exchange.ResponseHeaders, payload)
+		}
+		if err == nil {
 			log.Printf("reusing the existing signed exchange for %s", r.RequestURL)
 			*r = *cached
 			return nil
@@ -130,17 +189,21 @@ func (task *packagerTask) run() error {
 		return err
 	}
 	if isRedirectCode[rawResp.StatusCode] {
+		// The body must be closed to let FetchClient release the resources,
+		// e.g. the concurrency slot in fetch.WithPoliteness.
+		rawResp.Body.Close()
 		dest, err := rawResp.Location()
 		if err != nil {
 			return err
 		}
 		r.RedirectURL = dest
 		// TODO(yuizumi): Consider allowing redirects for main resources.
-		return fmt.Errorf("redirected to %v", dest)
+		return &RedirectError{rawResp.StatusCode, dest}
 	}
 
 	purl, err := task.getPhysicalURL(r, rawResp)
 	if err != nil {
+		rawResp.Body.Close()
 		return err
 	}
 	r.PhysicalURL = purl
@@ -158,6 +221,18 @@ func (task *packagerTask) run() error {
 	return task.ResourceCache.Store(r)
 }
 
+func (task *packagerTask) varyHeader(req *http.Request) http.Header {
+	if len(task.CacheVaryHeaders) == 0 {
+		return nil
+	}
+	vary := make(http.Header, len(task.CacheVaryHeaders))
+	for _, key := range task.CacheVaryHeaders {
+		key = http.CanonicalHeaderKey(key)
+		vary[key] = append([]string(nil), req.Header[key]...)
+	}
+	return vary
+}
+
 func (task *packagerTask) getPhysicalURL(r *resource.Resource, resp *http.Response) (*url.URL, error) {
 	u := new(url.URL)
 	*u = *r.RequestURL
@@ -170,9 +245,15 @@ func (task *packagerTask) createExchange(rawResp *http.Response) (*signedexchang
 	if err != nil {
 		return nil, err
 	}
+	if task.module {
+		sxgResp.ExtraData.Set(exchange.ScriptType, "module")
+	}
 	if err := task.Processor.Process(sxgResp); err != nil {
 		return nil, err
 	}
+	if err := task.verifyIntegrity(sxgResp.Header, sxgResp.Payload); err != nil {
+		return nil, err
+	}
 
 	vp := task.ValidPeriodRule.Get(sxgResp, task.date)
 
@@ -183,15 +264,51 @@ func (task *packagerTask) createExchange(rawResp *http.Response) (*signedexchang
 	}
 	task.resource.ValidityURL = vu
 
-	for _, p := range sxgResp.Preloads {
+	if task.parent != nil {
+		// Browsers discover the imports of a module only after loading it.
+		// Leave them to the main resource, which will then process them,
+		// along with their own imports, as if they were its own.
+		task.resource.Dependencies = nil
+		preloads := sxgResp.Preloads[:0]
+		for _, p := range sxgResp.Preloads {
+			if p.Module {
+				task.resource.Dependencies = append(task.resource.Dependencies, p.Link)
+			} else {
+				preloads = append(preloads, p)
+			}
+		}
+		sxgResp.Preloads = preloads
+	}
+
+	// The loop is index-based as sxgResp.Preloads grows with dependencies.
+	for i := 0; i < len(sxgResp.Preloads); i++ {
+		p := sxgResp.Preloads[i]
 		for _, r := range p.Resources {
 			req, err := newGetRequest(r.RequestURL)
 			if err != nil {
 				return nil, err
 			}
-			task.packagerTaskRunner.run(task, req, r)
+			task.packagerTaskRunner.run(task, req, r, p)
+			task.addDependencies(sxgResp, r)
+		}
+	}
+
+	preloads := sxgResp.Preloads[:0]
+	for _, p := range sxgResp.Preloads {
+		if p.Budget != nil {
+			size, ok := preloadSize(p)
+			if !ok {
+				log.Printf("dropping preload %v: not signed, thus not measurable for the byte budget", p.Link.URL)
+				continue
+			}
+			if !p.Budget.Consume(size) {
+				log.Printf("dropping preload %v: exceeds the byte budget", p.Link.URL)
+				continue
+			}
 		}
+		preloads = append(preloads, p)
 	}
+	sxgResp.Preloads = preloads
 
 	sxg, err := task.sxgFactory.NewExchange(sxgResp, vp, vu)
 	if err != nil {
@@ -203,3 +320,81 @@ func (task *packagerTask) createExchange(rawResp *http.Response) (*signedexchang
 
 	return sxg, nil
 }
+
+// addDependencies adds r.Dependencies to sxgResp.Preloads as long as the
+// number of preloads is within maxNumPreloads.
+func (task *packagerTask) addDependencies(sxgResp *exchange.Response, r *resource.Resource) {
+	for _, link := range r.Dependencies {
+		p := preload.NewPreloadForLink(link)
+		p.Module = true // Dependencies are all module imports.
+		if len(sxgResp.Preloads) >= maxNumPreloads {
+			log.Printf("dropping preload %v: too many preloads", link.URL)
+			continue
+		}
+		sxgResp.AddPreload(p)
+	}
+}
+
+// verifyIntegrity verifies the payload against task.integrity. header is
+// the response header of the payload: the payload is decoded before the
+// verification if it has Content-Encoding (see Config.ContentEncoding in
+// complexproc), since Subresource Integrity applies to the decoded content.
+func (task *packagerTask) verifyIntegrity(header http.Header, payload []byte) error {
+	if task.integrity == "" {
+		return nil
+	}
+	m, err := sri.Parse(task.integrity)
+	if err != nil {
+		return xerrors.Errorf("invalid integrity %q: %w", task.integrity, err)
+	}
+	if codings := contentCodings(header); len(codings) > 0 {
+		resp := &exchange.Response{
+			Response: &http.Response{Header: http.Header{}},
+			Payload:  payload,
+		}
+		resp.Header.Set("Content-Encoding", strings.Join(codings, ","))
+		if err := commonproc.DecodeContent(-1).Process(resp); err != nil {
+			return err
+		}
+		payload = resp.Payload
+	}
+	if !m.Match(payload) {
+		return fmt.Errorf("payload does not match integrity %q", task.integrity)
+	}
+	return nil
+}
+
+// contentCodings returns the content-codings in header, except mi-sha256,
+// which is already decoded in the payload verified by exchange.Factory.
+func contentCodings(header http.Header) []string {
+	var codings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.TrimSpace(coding)
+			if coding == "" || strings.HasPrefix(strings.ToLower(coding), "mi-sha256") {
+				continue
+			}
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// preloadSize returns the size of the largest payload in p.Resources, which
+// approximates the bytes transferred by the preload: browsers choose only one
+// of p.Resources when they have more than one. The payload is measured as
+// signed, i.e. after Content-Encoding if any, because that is what is sent.
+// It reports false if any of p.Resources has no signed exchange, thus its
+// size is unknown.
+func preloadSize(p *preload.Preload) (int, bool) {
+	size := 0
+	for _, r := range p.Resources {
+		if r.Exchange == nil {
+			return 0, false
+		}
+		if len(r.Exchange.Payload) > size {
+			size = len(r.Exchange.Payload)
+		}
+	}
+	return size, true
+}